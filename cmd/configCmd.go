@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gateixeira/gei-migration-helper/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with configuration files",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate <file>",
+	Short: "Validate a configuration file",
+	Long: `Checks a configuration file and reports every problem found with the
+	path of the offending key: unknown keys, values of the wrong type and values
+	the commands do not accept. Environment variables referenced by the file that
+	are not set are reported as warnings.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := config.Load(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		for _, missing := range c.MissingEnv() {
+			fmt.Fprintln(os.Stderr, "warning: "+missing)
+		}
+
+		fmt.Println(args[0] + " is valid")
+	},
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema <file>",
+	Short: "Write the JSON schema of configuration files",
+	Long: `Writes the JSON schema of configuration files, which editors can use to
+	complete and check the file.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := os.WriteFile(args[0], config.Schema, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+// applyConfigFile sets the flags that were not set on the command line to
+// the values of the configuration file. Empty values are skipped and keep the
+// default of the flag, except for the redirect texts, which an empty value
+// clears.
+func applyConfigFile(cmd *cobra.Command, path string) error {
+	c, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	if missing := c.MissingEnv(); len(missing) > 0 {
+		return fmt.Errorf("%s:\n%s", path, strings.Join(missing, "\n"))
+	}
+
+	env := func(names ...string) []string {
+		var values []string
+		for _, name := range names {
+			if name != "" {
+				values = append(values, os.Getenv(name))
+			}
+		}
+		return values
+	}
+
+	apps := func(apps []config.App) []string {
+		var values []string
+		for _, app := range apps {
+			values = append(values, app.Flag())
+		}
+		return values
+	}
+
+	var organizations []string
+	for _, organization := range c.Enterprise.Organizations {
+		organizations = append(organizations, organization.Flag())
+	}
+
+	pairs := func(mappings map[string]string) []string {
+		var values []string
+		for source, target := range mappings {
+			values = append(values, source+"="+target)
+		}
+		return values
+	}
+
+	values := map[string][]string{
+		sourceTypeFlagName:   {c.Source.Type},
+		sourceOrgFlagName:    {c.Source.Org},
+		sourceAPIURLFlagName: {c.Source.APIURL},
+		sourceGitURLFlagName: {c.Source.GitURL},
+		sourceTokenFlagName:  {strings.Join(env(c.Source.TokenEnv...), ",")},
+		sourceAppFlagName:    apps(c.Source.Apps),
+		targetOrgFlagName:    {c.Target.Org},
+		targetAPIURLFlagName: {c.Target.APIURL},
+		targetGitURLFlagName: {c.Target.GitURL},
+		targetTokenFlagName:  {strings.Join(env(c.Target.TokenEnv...), ",")},
+		targetAppFlagName:    apps(c.Target.Apps),
+
+		adoTeamProjectFlagName:   {c.Source.ADO.TeamProject},
+		adoPATFlagName:           env(c.Source.ADO.PATEnv),
+		adoServerURLFlagName:     {c.Source.ADO.ServerURL},
+		bbsServerURLFlagName:     {c.Source.BBS.ServerURL},
+		bbsUsernameFlagName:      env(c.Source.BBS.UsernameEnv),
+		bbsPasswordFlagName:      env(c.Source.BBS.PasswordEnv),
+		bbsSSHUserFlagName:       {c.Source.BBS.SSHUser},
+		bbsSSHPrivateKeyFlagName: {c.Source.BBS.SSHPrivateKeyFile},
+
+		archiveStorageFlagName:               {c.Storage.Stage},
+		azureStorageConnectionStringFlagName: env(c.Storage.AzureConnectionStringEnv),
+		awsBucketNameFlagName:                {c.Storage.AWSBucketName},
+		awsRegionFlagName:                    {c.Storage.AWSRegion},
+		awsEndpointURLFlagName:               {c.Storage.AWSEndpointURL},
+		archiveDirFlagName:                   {c.Storage.ArchiveDir},
+		archiveBaseURLFlagName:               {c.Storage.ArchiveBaseURL},
+
+		includeFlagName:           c.Filters.Include,
+		excludeFlagName:           c.Filters.Exclude,
+		skipStepFlagName:          c.SkipSteps(),
+		enableStepFlagName:        c.EnableSteps(),
+		repositoryMappingFlagName: pairs(c.Mappings.Repositories),
+		propertyMappingFlagName:   pairs(c.Mappings.Properties),
+		orgMappingFlagName:        pairs(c.Mappings.Organizations),
+		teamMappingFlagName:       pairs(c.Mappings.Teams),
+		rewriteModeFlagName:       {c.RewriteMode},
+		routingFileFlagName:       {c.RoutingFile},
+		driftPolicyFlagName:       {c.DriftPolicy},
+		lockModeFlagName:          {c.Lock.Mode},
+
+		redirectReadmeBannerFlagName:       {c.Redirect.ReadmeBanner},
+		redirectIssueTitleFlagName:         {c.Redirect.Issue.Title},
+		redirectIssueBodyFlagName:          {c.Redirect.Issue.Body},
+		redirectDiscussionCategoryFlagName: {c.Redirect.Issue.DiscussionCategory},
+		lockReleaseFlagName:                {c.Lock.Release},
+		outputDirFlagName:                  {c.Output.Directory},
+
+		orgPairFlagName:          organizations,
+		sourceEnterpriseFlagName: {c.Enterprise.Source},
+	}
+
+	// an empty text leaves the source as it is, unlike a text that is not
+	// in the file
+	clearable := map[string]*string{
+		redirectDescriptionFlagName: c.Redirect.Description,
+		redirectHomepageFlagName:    c.Redirect.Homepage,
+		redirectTopicFlagName:       c.Redirect.Topic,
+	}
+	for flagName, value := range clearable {
+		if value != nil {
+			values[flagName] = []string{*value}
+		}
+	}
+
+	if c.Source.BBS.SSHPort != 0 {
+		values[bbsSSHPortFlagName] = []string{strconv.Itoa(c.Source.BBS.SSHPort)}
+	}
+	if c.Workers != 0 {
+		values[workersFlagName] = []string{strconv.Itoa(c.Workers)}
+	}
+	if c.MinWorkers != 0 {
+		values[minWorkersFlagName] = []string{strconv.Itoa(c.MinWorkers)}
+	}
+	if c.JobTimeout != 0 {
+		values[jobTimeoutFlagName] = []string{c.JobTimeout.String()}
+	}
+	if c.Busy.Timeout != 0 {
+		values[busyTimeoutFlagName] = []string{c.Busy.Timeout.String()}
+	}
+	if c.Busy.QuietPeriod != nil {
+		values[quietPeriodFlagName] = []string{c.Busy.QuietPeriod.String()}
+	}
+	if c.MaxRetries != 0 {
+		values[maxRetriesFlagName] = []string{strconv.Itoa(c.MaxRetries)}
+	}
+	for flagName, set := range map[string]bool{
+		useGitHubStorageFlagName: c.Storage.UseGitHubStorage,
+		keepArchiveFlagName:      c.Storage.KeepArchive,
+		noSSLVerifyFlagName:      c.Storage.NoSSLVerify,
+
+		verifyGitFlagName:          c.Verification.Git,
+		deferBusyFlagName:          c.Busy.Defer,
+		redirectPinIssueFlagName:   c.Redirect.Issue.Pin,
+		prefixRepositoriesFlagName: c.Enterprise.PrefixRepositories,
+	} {
+		if set {
+			values[flagName] = []string{"true"}
+		}
+	}
+
+	for flagName, flagValues := range values {
+		flag := cmd.Flags().Lookup(flagName)
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		for _, value := range flagValues {
+			if _, ok := clearable[flagName]; value == "" && !ok {
+				continue
+			}
+			if err := cmd.Flags().Set(flagName, value); err != nil {
+				return fmt.Errorf("%s: invalid value for --%s: %w", path, flagName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+}
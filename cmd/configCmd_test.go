@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+	"github.com/spf13/cobra"
+)
+
+func TestApplyConfigFile(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		env     map[string]string
+		args    []string
+		// want maps flag names to their expected values
+		want map[string]string
+		err  string
+	}{
+		{
+			name:    "values of the file",
+			content: "source:\n  org: source\nworkers: 8\nfilters:\n  include: [api, web]\n",
+			want:    map[string]string{sourceOrgFlagName: "source", workersFlagName: "8", includeFlagName: "[api,web]"},
+		},
+		{
+			name:    "flags take precedence",
+			content: "source:\n  org: source\nworkers: 8\n",
+			args:    []string{"--" + sourceOrgFlagName, "other", "--" + workersFlagName, "2"},
+			want:    map[string]string{sourceOrgFlagName: "other", workersFlagName: "2"},
+		},
+		{
+			name:    "environment variables",
+			content: "source:\n  tokenEnv: [SOURCE_TOKEN_1, SOURCE_TOKEN_2]\n",
+			env:     map[string]string{"SOURCE_TOKEN_1": "one", "SOURCE_TOKEN_2": "two"},
+			want:    map[string]string{sourceTokenFlagName: "one,two"},
+		},
+		{
+			name:    "missing environment variable",
+			content: "source:\n  tokenEnv: [SOURCE_TOKEN_1]\n",
+			err:     "source.tokenEnv[0]: environment variable SOURCE_TOKEN_1 is not set",
+		},
+		{
+			name:    "empty values keep the default",
+			content: "source:\n  org: \"\"\nworkers: 0\n",
+			want:    map[string]string{sourceOrgFlagName: "", workersFlagName: "5", redirectDescriptionFlagName: migration.DefaultRedirectDescription},
+		},
+		{
+			name:    "empty redirect description",
+			content: "redirect:\n  description: \"\"\n",
+			want:    map[string]string{redirectDescriptionFlagName: ""},
+		},
+		{
+			name:    "unknown key",
+			content: "source:\n  organization: source\n",
+			err:     "field organization not found",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
+			path := filepath.Join(t.TempDir(), "migration.yaml")
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String(sourceOrgFlagName, "", "")
+			cmd.Flags().String(sourceTokenFlagName, "", "")
+			cmd.Flags().Int(workersFlagName, 5, "")
+			cmd.Flags().StringSlice(includeFlagName, nil, "")
+			cmd.Flags().String(redirectDescriptionFlagName, migration.DefaultRedirectDescription, "")
+			if err := cmd.ParseFlags(tc.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyConfigFile(cmd, path)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for flagName, want := range tc.want {
+				if got := cmd.Flags().Lookup(flagName).Value.String(); got != want {
+					t.Errorf("got --%s %q, want %q", flagName, got, want)
+				}
+			}
+		})
+	}
+}
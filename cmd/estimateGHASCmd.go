@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+	"github.com/spf13/cobra"
+)
+
+const ghasEstimateFileName = "ghas-estimate.json"
+
+var estimateGHASCmd = &cobra.Command{
+	Use:   "estimate-ghas",
+	Short: "Estimate the GHAS licenses a migration would use at target",
+	Long: `Estimates the GitHub Advanced Security licenses that the migrated
+	repositories would use at the target organization.
+
+	The unique active committers of the private and internal repositories to
+	migrate are read from the GHAS billing of the source and compared with the
+	committers that already use a license at target. Repositories without GHAS
+	at source have no committer data and are listed separately.
+
+	The estimate is saved to ghas-estimate.json. The same comparison runs in
+	preflight, which fails if the target would exceed its purchased seats.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := connectionFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
+
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		orgMigration, err := migration.NewOrgMigration(ctx, conn, options)
+		if err != nil {
+			slog.Error("error creating migration", "error", err)
+			os.Exit(1)
+		}
+
+		estimate, err := orgMigration.EstimateGHAS(ctx)
+		if err != nil {
+			slog.Error("error estimating GHAS licenses", "error", err)
+			os.Exit(1)
+		}
+
+		if err := writeResultFile(cmd, ghasEstimateFileName, estimate); err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(estimateGHASCmd)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatFlagName    = "format"
+	inventoryFileName = "inventory"
+)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Export an inventory of the source organization",
+	Long: `Writes one row per repository of the source organization with the data
+	the migration works on: size, visibility, archived and fork state, default
+	branch, last push, GHAS, secret scanning and push protection state, and the
+	number of code scanning analyses, active workflows, branch protection rules,
+	environments, webhooks, secrets, collaborators, teams and open pull requests,
+	and whether Git LFS is used.
+
+	The inventory is written to inventory.csv or, with --format json, to
+	inventory.json. Values that could not be read, e.g. secrets without admin
+	access, are listed in the errors column. Only source credentials are needed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conn := migration.Connection{}
+		conn.SourceOrg, _ = cmd.Flags().GetString(sourceOrgFlagName)
+		conn.SourceAPIURL, _ = cmd.Flags().GetString(sourceAPIURLFlagName)
+		if conn.SourceOrg == "" {
+			slog.Error(fmt.Sprintf("--%s is required", sourceOrgFlagName))
+			os.Exit(1)
+		}
+		if sourceType, _ := cmd.Flags().GetString(sourceTypeFlagName); sourceType != sourceTypeGitHub {
+			slog.Error("inventory only supports GitHub sources")
+			os.Exit(1)
+		}
+		if _, _, err := github.APIURLs(conn.SourceAPIURL); err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+
+		var err error
+		conn.SourceCredentials, err = credentialPool(cmd, "source", sourceTokenFlagName, sourceAppFlagName, conn.SourceAPIURL)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
+
+		format, _ := cmd.Flags().GetString(formatFlagName)
+		if format != "csv" && format != "json" {
+			slog.Error(fmt.Sprintf("unknown format %q, expected csv or json", format))
+			os.Exit(1)
+		}
+
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		rows, err := migration.Inventory(ctx, conn, options)
+		interrupted := errors.Is(err, migration.ErrInterrupted)
+		if err != nil && !interrupted {
+			slog.Error("error reading inventory", "error", err)
+			os.Exit(1)
+		}
+
+		if format == "json" {
+			if err := writeResultFile(cmd, inventoryFileName+".json", rows); err != nil {
+				os.Exit(1)
+			}
+		} else if err := writeInventoryCSV(cmd, rows); err != nil {
+			slog.Error("failed to write inventory", "error", err)
+			os.Exit(1)
+		}
+
+		if interrupted {
+			slog.Warn("inventory was interrupted and is incomplete")
+			os.Exit(exitCodeInterrupted)
+		}
+	},
+}
+
+// writeInventoryCSV writes the inventory to inventory.csv in the output
+// directory
+func writeInventoryCSV(cmd *cobra.Command, rows interface{ WriteCSV(w io.Writer) error }) error {
+	outputDir, _ := cmd.Flags().GetString(outputDirFlagName)
+	fileName := filepath.Join(outputDir, inventoryFileName+".csv")
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := rows.WriteCSV(f); err != nil {
+		return err
+	}
+
+	slog.Info("inventory saved to " + fileName)
+
+	return f.Close()
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+
+	inventoryCmd.Flags().String(formatFlagName, "csv", "[OPTIONAL] Format of the inventory, csv or json.")
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+	"github.com/spf13/cobra"
+)
+
+const workflowLintResultFileName = "workflow-lint-result.json"
+
+var lintWorkflowsCmd = &cobra.Command{
+	Use:   "lint-workflows",
+	Short: "Check the workflows of migrated repositories against the settings of the target",
+	Long: `Parses every workflow of the migrated repositories at target and checks
+	it against the Actions settings of the target organization and repository:
+	self-hosted runner labels and runner groups the repository cannot use,
+	secrets and variables that are referenced but not defined, actions that the
+	allowed actions policy does not permit and environments that do not exist.
+
+	Repositories with findings are listed as degraded in
+	workflow-lint-result.json. reactivate-target-workflows runs the same checks
+	and leaves workflows with findings disabled.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := connectionFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		repository, _ := cmd.Flags().GetString(repositoryFlagName)
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
+
+		slog.Info(fmt.Sprintf("linting workflows migrated from %s to %s", conn.SourceOrg, conn.TargetOrg))
+
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		migrationData, err := migration.NewMigration(ctx, conn, options)
+		if err != nil {
+			slog.Error("error creating migration", "error", err)
+			os.Exit(1)
+		}
+
+		result, err := migrationData.LintWorkflows(ctx, repository)
+		if err != nil {
+			slog.Error("error linting workflows", "error", err)
+			os.Exit(1)
+		}
+
+		if err := writeResultFile(cmd, workflowLintResultFileName, result); err != nil {
+			os.Exit(1)
+		}
+
+		if result.Interrupted {
+			os.Exit(exitCodeInterrupted)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintWorkflowsCmd)
+
+	lintWorkflowsCmd.Flags().String(repositoryFlagName, "", "[OPTIONAL] The repository to lint. If not provided, the workflows of all repositories of the organization are linted.")
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+	"github.com/spf13/cobra"
+)
+
+const (
+	orgPairFlagName            = "org-pair"
+	sourceEnterpriseFlagName   = "source-enterprise"
+	prefixRepositoriesFlagName = "prefix-repositories"
+	enterpriseResultFileName   = "enterprise-migration-result.json"
+)
+
+var migrateEnterpriseCmd = &cobra.Command{
+	Use:   "migrate-enterprise",
+	Short: "Migrate several organizations at once",
+	Long: `This script migrates the repositories of several organizations.
+
+	The organizations are either listed with --org-pair or discovered in the
+	source enterprise given with --source-enterprise. All organizations share
+	the --workers budget. Every target organization gets one migration-status
+	repository, also when several sources are consolidated into it.
+
+	When several sources are migrated to the same target, use prefixes to avoid
+	name collisions: --org-pair source:target:prefix or --prefix-repositories.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initial := time.Now()
+
+		conn, err := connectionSettingsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
+
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		pairs, err := orgPairsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid organizations", "error", err)
+			os.Exit(1)
+		}
+
+		enterprise, _ := cmd.Flags().GetString(sourceEnterpriseFlagName)
+		if len(pairs) == 0 && enterprise == "" {
+			slog.Error(fmt.Sprintf("either --%s or --%s is required", orgPairFlagName, sourceEnterpriseFlagName))
+			os.Exit(1)
+		}
+
+		if enterprise != "" {
+			prefix, _ := cmd.Flags().GetBool(prefixRepositoriesFlagName)
+			discovered, err := migration.DiscoverOrganizations(ctx, conn, enterprise, conn.TargetOrg, prefix)
+			if err != nil {
+				slog.Error("error listing organizations of enterprise "+enterprise, "error", err)
+				os.Exit(1)
+			}
+			pairs = append(pairs, discovered...)
+		}
+
+		enterpriseMigration, err := migration.NewEnterpriseMigration(ctx, conn, options, pairs)
+		if err != nil {
+			slog.Error("error creating migration", "error", err)
+			os.Exit(1)
+		}
+
+		result, err := enterpriseMigration.Migrate(ctx)
+		interrupted := errors.Is(err, migration.ErrInterrupted)
+		if err != nil && !interrupted {
+			slog.Error("error migrating", "error", err)
+			os.Exit(1)
+		}
+
+		if err := writeResultFile(cmd, enterpriseResultFileName, result); err != nil {
+			os.Exit(1)
+		}
+
+		if interrupted {
+			slog.Warn("migration was interrupted, resume every organization with migrate-organization --retry-failed <source>.<target>/migration-checkpoint.json")
+			os.Exit(exitCodeInterrupted)
+		}
+
+		slog.Info(fmt.Sprintf("migration took %s", time.Since(initial)))
+	},
+}
+
+// orgPairsFromFlags parses the --org-pair flags. With --prefix-repositories,
+// pairs without a prefix get the name of their source organization as prefix.
+func orgPairsFromFlags(cmd *cobra.Command) ([]migration.OrgPair, error) {
+	values, _ := cmd.Flags().GetStringArray(orgPairFlagName)
+	prefixRepositories, _ := cmd.Flags().GetBool(prefixRepositoriesFlagName)
+
+	var pairs []migration.OrgPair
+	for _, value := range values {
+		parts := strings.Split(value, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid organization pair %q, expected <source>:<target>[:<prefix>]", value)
+		}
+
+		pair := migration.OrgPair{Source: parts[0], Target: parts[1]}
+		if len(parts) == 3 {
+			pair.Prefix = parts[2]
+		} else if prefixRepositories {
+			pair.Prefix = pair.Source + "-"
+		}
+		pairs = append(pairs, pair)
+	}
+
+	return pairs, nil
+}
+
+func init() {
+	rootCmd.AddCommand(migrateEnterpriseCmd)
+
+	migrateEnterpriseCmd.Flags().StringArray(orgPairFlagName, nil, "[OPTIONAL] An organization to migrate as <source>:<target>[:<prefix>]. The prefix is prepended to the repository names at target. Can be repeated.")
+	migrateEnterpriseCmd.Flags().String(sourceEnterpriseFlagName, "", "[OPTIONAL] Migrate all organizations of this source enterprise, each to an organization of the same name or, with --target-org, all into one organization.")
+	migrateEnterpriseCmd.Flags().Bool(prefixRepositoriesFlagName, false, "[OPTIONAL] Prefix the repository names at target with the name of their source organization, e.g. my-org-my-repo.")
+}
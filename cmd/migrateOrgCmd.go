@@ -1,8 +1,7 @@
 package cmd
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -12,6 +11,12 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const (
+	retryFailedFlagName   = "retry-failed"
+	skipPreflightFlagName = "skip-preflight"
+	resultFileName        = "migration-result.json"
+)
+
 var migrateOrgCmd = &cobra.Command{
 	Use:   "migrate-organization",
 	Short: "Migrate all repositories from one organization to another",
@@ -19,55 +24,82 @@ var migrateOrgCmd = &cobra.Command{
 
 	The target organization has to exist at destination.
 
-	This script will not migrate the .github repository.`,
+	This script will not migrate the .github repository.
+
+	Use --retry-failed with the result file of a previous run to migrate only
+	the repositories that failed in that run.
+
+	The checks of the preflight command run before a migration starts and the
+	migration is not started if one fails. Use --skip-preflight to skip them.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		initial := time.Now()
 
-		sourceOrg, _ := cmd.Flags().GetString(sourceOrgFlagName)
-		targetOrg, _ := cmd.Flags().GetString(targetOrgFlagName)
-		sourceToken, _ := cmd.Flags().GetString(sourceTokenFlagName)
-		targetToken, _ := cmd.Flags().GetString(targetTokenFlagName)
-		maxRetries, _ := cmd.Flags().GetInt(maxRetriesFlagName)
-		workers, _ := cmd.Flags().GetInt(workersFlagName)
+		conn, err := connectionFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		sourceOrg, targetOrg := conn.SourceOrg, conn.TargetOrg
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
+		retryFailed, _ := cmd.Flags().GetString(retryFailedFlagName)
 
 		slog.Info("migrating", "source", sourceOrg, "destination", targetOrg)
 
-		ctx := context.Background()
-		migration, err := migration.NewOrgMigration(
-			ctx, sourceOrg, targetOrg, sourceToken, targetToken, maxRetries, workers)
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		orgMigration, err := migration.NewOrgMigration(ctx, conn, options)
 
 		if err != nil {
-			slog.Error("error creating migration", err)
+			slog.Error("error creating migration", "error", err)
 			os.Exit(1)
 		}
 
-		migrationResult, err := migration.Migrate(ctx)
+		var migrationResult interface{ IsZero() bool }
+		if retryFailed != "" {
+			slog.Info("retrying failed repositories", "file", retryFailed)
 
-		if err != nil {
-			slog.Error("error migrating", err)
-			os.Exit(1)
-		}
+			previous, loadErr := migration.LoadMigrationResult(retryFailed)
+			if loadErr != nil {
+				slog.Error("error reading result file", "error", loadErr)
+				os.Exit(1)
+			}
 
-		jsonData, err := json.MarshalIndent(migrationResult, "", "  ")
-		if err != nil {
-			slog.Error("failed to parse result", err)
-			os.Exit(1)
+			migrationResult, err = orgMigration.RetryFailed(ctx, previous)
+		} else {
+			if skipPreflight, _ := cmd.Flags().GetBool(skipPreflightFlagName); !skipPreflight && !runPreflight(ctx, cmd, orgMigration) {
+				slog.Error("preflight checks failed, see " + preflightReportFileName + " or use --" + skipPreflightFlagName)
+				os.Exit(1)
+			}
+
+			migrationResult, err = orgMigration.Migrate(ctx)
 		}
 
-		f, err := os.Create("migration-result.json")
-		if err != nil {
-			slog.Error("failed to create results file", err)
+		interrupted := errors.Is(err, migration.ErrInterrupted)
+		if err != nil && !interrupted {
+			slog.Error("error migrating", "error", err)
+			// repositories processed before the error are kept for --retry-failed
+			if !migrationResult.IsZero() {
+				writeResultFile(cmd, resultFileName, migrationResult)
+			}
+			if ctx.Err() != nil {
+				os.Exit(exitCodeInterrupted)
+			}
 			os.Exit(1)
 		}
-		defer f.Close()
 
-		_, err = f.Write(jsonData)
-		if err != nil {
-			slog.Error("failed to write to results file", err)
+		if err := writeResultFile(cmd, resultFileName, migrationResult); err != nil {
 			os.Exit(1)
 		}
 
-		slog.Info("migration result saved to migration-result.json")
+		if interrupted {
+			slog.Warn("migration was interrupted, use --retry-failed " + resultFileName + " to resume")
+			os.Exit(exitCodeInterrupted)
+		}
 
 		slog.Info(fmt.Sprintf("migration took %s", time.Since(initial)))
 	},
@@ -75,4 +107,7 @@ var migrateOrgCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(migrateOrgCmd)
+
+	migrateOrgCmd.Flags().String(retryFailedFlagName, "", "[OPTIONAL] A result file of a previous run. Only the repositories that failed or were not processed in that run are migrated and the outcome is merged into a new result.")
+	migrateOrgCmd.Flags().Bool(skipPreflightFlagName, false, "[OPTIONAL] Start the migration without running the preflight checks.")
 }
@@ -1,7 +1,7 @@
 package cmd
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -21,23 +21,36 @@ var migrateRepoCmd = &cobra.Command{
 
 	The target organization has to exist at destination.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		sourceOrg, _ := cmd.Flags().GetString(sourceOrgFlagName)
-		targetOrg, _ := cmd.Flags().GetString(targetOrgFlagName)
-		sourceToken, _ := cmd.Flags().GetString(sourceTokenFlagName)
-		targetToken, _ := cmd.Flags().GetString(targetTokenFlagName)
+		conn, err := connectionFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		sourceOrg, targetOrg := conn.SourceOrg, conn.TargetOrg
 		repository, _ := cmd.Flags().GetString(repositoryFlagName)
-		maxRetries, _ := cmd.Flags().GetInt(maxRetriesFlagName)
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
 
 		slog.Info(fmt.Sprintf("migrating repository %s from %s to %s", repository, sourceOrg, targetOrg))
 
-		ctx := context.Background()
-		migration, err := migration.NewRepoMigration(ctx, repository, sourceOrg, targetOrg, sourceToken, targetToken, maxRetries)
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		repoMigration, err := migration.NewRepoMigration(ctx, repository, conn, options)
 		if err != nil {
 			slog.Error("error migrating repository: " + repository)
 			os.Exit(1)
 		}
 
-		err = migration.Migrate(ctx)
+		err = repoMigration.Migrate(ctx)
+
+		if errors.Is(err, migration.ErrInterrupted) {
+			slog.Warn("migration of repository " + repository + " was interrupted and rolled back")
+			os.Exit(exitCodeInterrupted)
+		}
 
 		if err != nil {
 			slog.Error("error migrating repository: " + repository)
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,32 +9,51 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const secretScanningResultFileName = "secret-scanning-result.json"
+
 var migrateSecretScanningCmd = &cobra.Command{
 	Use:   "migrate-secret-scanning",
 	Short: "Migrate secret scanning remediations for a repository",
 	Run: func(cmd *cobra.Command, args []string) {
-		sourceOrg, _ := cmd.Flags().GetString(sourceOrgFlagName)
-		targetOrg, _ := cmd.Flags().GetString(targetOrgFlagName)
-		sourceToken, _ := cmd.Flags().GetString(sourceTokenFlagName)
-		targetToken, _ := cmd.Flags().GetString(targetTokenFlagName)
+		conn, err := connectionFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		sourceOrg, targetOrg := conn.SourceOrg, conn.TargetOrg
 		repository, _ := cmd.Flags().GetString(repositoryFlagName)
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
 
 		slog.Info(fmt.Sprintf("migrating secret scanning for repository %s from %s to %s", repository, sourceOrg, targetOrg))
 
-		ctx := context.Background()
-		migration, err := migration.NewSecretScanningMigration(ctx, sourceOrg, targetOrg, sourceToken, targetToken)
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		migration, err := migration.NewSecretScanningMigration(ctx, conn, options)
 		if err != nil {
 			slog.Error("error migrating repository: " + repository)
 			os.Exit(1)
 		}
 
-		err = migration.Migrate(ctx, repository)
+		result, err := migration.Migrate(ctx, repository)
 
 		if err != nil {
 			slog.Error("error migrating repository: " + repository)
 			os.Exit(1)
 		}
 
+		if err := writeResultFile(cmd, secretScanningResultFileName, result); err != nil {
+			os.Exit(1)
+		}
+
+		if result.Interrupted {
+			os.Exit(exitCodeInterrupted)
+		}
+
 	},
 }
 
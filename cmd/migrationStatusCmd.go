@@ -15,21 +15,27 @@ var migrationStatusCmd = &cobra.Command{
 	Use:   "migration-status",
 	Short: "Check status for organization migration",
 	Run: func(cmd *cobra.Command, args []string) {
-		sourceOrg, _ := cmd.Flags().GetString(sourceOrgFlagName)
-		targetOrg, _ := cmd.Flags().GetString(targetOrgFlagName)
-		sourceToken, _ := cmd.Flags().GetString(sourceTokenFlagName)
-		targetToken, _ := cmd.Flags().GetString(targetTokenFlagName)
+		conn, err := connectionFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		sourceOrg, targetOrg := conn.SourceOrg, conn.TargetOrg
+		if conn.Provider != nil {
+			slog.Error("migration-status only supports GitHub sources")
+			os.Exit(1)
+		}
 
 		ctx := context.Background()
-		sourceGC, err := github.NewGitHubClient(ctx, slog.Default(), sourceToken)
+		sourceGC, err := github.NewGitHubClient(ctx, slog.Default(), conn.SourceCredentials, github.ClientOptions{Name: "source", APIURL: conn.SourceAPIURL})
 		if err != nil {
-			slog.Info("error initializing source GitHub Client", err)
+			slog.Info("error initializing source GitHub Client", "error", err)
 			os.Exit(1)
 		}
 
-		targetGC, err := github.NewGitHubClient(ctx, slog.Default(), targetToken)
+		targetGC, err := github.NewGitHubClient(ctx, slog.Default(), conn.TargetCredentials, github.ClientOptions{Name: "target", APIURL: conn.TargetAPIURL})
 		if err != nil {
-			slog.Info("error initializing source GitHub Client", err)
+			slog.Info("error initializing source GitHub Client", "error", err)
 			os.Exit(1)
 		}
 
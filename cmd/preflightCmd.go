@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+	"github.com/spf13/cobra"
+)
+
+const preflightReportFileName = "preflight-report.json"
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check that an organization migration can run",
+	Long: `Checks for problems that would make migrate-organization fail halfway
+	through and reports every check as pass, warn or fail:
+
+	gh and the gh gei extension are installed and gei is recent enough, the
+	tokens of both sides have the required scopes, the target organization
+	exists and the caller is an owner, GHAS is licensed at target, repository
+	names do not collide (also case insensitively), repositories are below the
+	GEI size limit and no migration-status repository is left at target.
+
+	The report is saved to preflight-report.json. The command exits with 1 if
+	a check failed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := connectionFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
+
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		orgMigration, err := migration.NewOrgMigration(ctx, conn, options)
+		if err != nil {
+			slog.Error("error creating migration", "error", err)
+			os.Exit(1)
+		}
+
+		if !runPreflight(ctx, cmd, orgMigration) {
+			os.Exit(1)
+		}
+	},
+}
+
+// runPreflight runs the pre-flight checks, saves the report and returns
+// false if a check failed
+func runPreflight(ctx context.Context, cmd *cobra.Command, orgMigration migration.OrgMigration) bool {
+	slog.Info("running preflight checks")
+
+	report := orgMigration.Preflight(ctx)
+	if err := writeResultFile(cmd, preflightReportFileName, report); err != nil {
+		return false
+	}
+
+	return !report.Failed()
+}
+
+func init() {
+	rootCmd.AddCommand(preflightCmd)
+}
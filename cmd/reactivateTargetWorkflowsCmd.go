@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,32 +9,59 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const (
+	workflowReactivationResultFileName = "workflow-reactivation-result.json"
+	skipWorkflowLintFlagName           = "skip-workflow-lint"
+)
+
 var reactivateTargetWorkflowsCmd = &cobra.Command{
 	Use:   "reactivate-target-workflows",
 	Short: "Reactivate workflows for a migrated repository based on source",
+	Long: `Enables at target the workflows that are active at source. Workflows
+	are checked like with lint-workflows first, the ones with findings stay
+	disabled and their repositories are listed as degraded in
+	workflow-reactivation-result.json.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		sourceOrg, _ := cmd.Flags().GetString(sourceOrgFlagName)
-		targetOrg, _ := cmd.Flags().GetString(targetOrgFlagName)
-		sourceToken, _ := cmd.Flags().GetString(sourceTokenFlagName)
-		targetToken, _ := cmd.Flags().GetString(targetTokenFlagName)
+		conn, err := connectionFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		sourceOrg, targetOrg := conn.SourceOrg, conn.TargetOrg
 		repository, _ := cmd.Flags().GetString(repositoryFlagName)
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
+		options.SkipWorkflowLint, _ = cmd.Flags().GetBool(skipWorkflowLintFlagName)
 
 		slog.Info(fmt.Sprintf("reactivating target workflows for repository %s from %s to %s", repository, sourceOrg, targetOrg))
 
-		ctx := context.Background()
-		migrationData, err := migration.NewMigration(ctx, sourceOrg, targetOrg, sourceToken, targetToken)
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		migrationData, err := migration.NewMigration(ctx, conn, options)
 		if err != nil {
 			slog.Error("error migrating repository: " + repository)
 			os.Exit(1)
 		}
 
-		err = migrationData.ReactivateTargetWorkflows(ctx, repository)
+		result, err := migrationData.ReactivateTargetWorkflows(ctx, repository)
 
 		if err != nil {
 			slog.Error("error migrating repository: " + repository)
 			os.Exit(1)
 		}
 
+		if err := writeResultFile(cmd, workflowReactivationResultFileName, result); err != nil {
+			os.Exit(1)
+		}
+
+		if result.Interrupted {
+			os.Exit(exitCodeInterrupted)
+		}
+
 	},
 }
 
@@ -43,4 +69,5 @@ func init() {
 	rootCmd.AddCommand(reactivateTargetWorkflowsCmd)
 
 	reactivateTargetWorkflowsCmd.Flags().String(repositoryFlagName, "", "The repository to reactivate. If not provided, reactivation will be done for all repositories in the organization.")
+	reactivateTargetWorkflowsCmd.Flags().Bool(skipWorkflowLintFlagName, false, "[OPTIONAL] Reactivate the workflows without checking them against the settings of the target.")
 }
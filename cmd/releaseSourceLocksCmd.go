@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+	"github.com/spf13/cobra"
+)
+
+var releaseSourceLocksCmd = &cobra.Command{
+	Use:   "release-source-locks",
+	Short: "Restore source repositories left locked by a migration",
+	Long: `Restores every source repository recorded in source-lock-journal.json
+	in the output directory: archived repositories are unarchived and downgraded
+	teams and collaborators get their permissions back.
+
+	Migrations with --enable-step lock-source release their locks themselves,
+	this is needed only if one crashed or was killed. Only source credentials are
+	needed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conn := migration.Connection{}
+		conn.SourceAPIURL, _ = cmd.Flags().GetString(sourceAPIURLFlagName)
+		if _, _, err := github.APIURLs(conn.SourceAPIURL); err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+
+		var err error
+		conn.SourceCredentials, err = credentialPool(cmd, "source", sourceTokenFlagName, sourceAppFlagName, conn.SourceAPIURL)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
+
+		if err := migration.ReleaseSourceLocks(context.Background(), conn, options); err != nil {
+			slog.Error("not all source locks were released, they are kept in "+migration.LockJournalFileName, "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(releaseSourceLocksCmd)
+}
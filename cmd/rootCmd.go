@@ -3,8 +3,18 @@ package cmd
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
 	"github.com/gateixeira/gei-migration-helper/pkg/logging"
 	"github.com/spf13/cobra"
 )
@@ -16,8 +26,80 @@ const (
 	targetOrgFlagName   = "target-org"
 	sourceTokenFlagName = "source-token"
 	targetTokenFlagName = "target-token"
+	sourceAppFlagName   = "source-app"
+	targetAppFlagName   = "target-app"
 	maxRetriesFlagName  = "max-retries"
 	workersFlagName     = "workers"
+	minWorkersFlagName  = "min-workers"
+	jobTimeoutFlagName  = "job-timeout"
+
+	sourceAPIURLFlagName                 = "source-api-url"
+	targetAPIURLFlagName                 = "target-api-url"
+	sourceGitURLFlagName                 = "source-git-url"
+	targetGitURLFlagName                 = "target-git-url"
+	azureStorageConnectionStringFlagName = "azure-storage-connection-string"
+	awsBucketNameFlagName                = "aws-bucket-name"
+	awsRegionFlagName                    = "aws-region"
+	useGitHubStorageFlagName             = "use-github-storage"
+	noSSLVerifyFlagName                  = "no-ssl-verify"
+	keepArchiveFlagName                  = "keep-archive"
+	archiveStorageFlagName               = "archive-storage"
+	awsEndpointURLFlagName               = "aws-endpoint-url"
+	archiveDirFlagName                   = "archive-dir"
+	archiveBaseURLFlagName               = "archive-base-url"
+
+	sourceTypeFlagName       = "source-type"
+	adoTeamProjectFlagName   = "ado-team-project"
+	adoPATFlagName           = "ado-pat"
+	adoServerURLFlagName     = "ado-server-url"
+	bbsServerURLFlagName     = "bbs-server-url"
+	bbsUsernameFlagName      = "bbs-username"
+	bbsPasswordFlagName      = "bbs-password"
+	bbsSSHUserFlagName       = "bbs-ssh-user"
+	bbsSSHPrivateKeyFlagName = "bbs-ssh-private-key"
+	bbsSSHPortFlagName       = "bbs-ssh-port"
+
+	configFlagName                     = "config"
+	includeFlagName                    = "include"
+	excludeFlagName                    = "exclude"
+	skipStepFlagName                   = "skip-step"
+	enableStepFlagName                 = "enable-step"
+	verifyGitFlagName                  = "verify-git"
+	driftPolicyFlagName                = "drift-policy"
+	busyTimeoutFlagName                = "busy-timeout"
+	lockModeFlagName                   = "lock-mode"
+	redirectDescriptionFlagName        = "redirect-description"
+	redirectHomepageFlagName           = "redirect-homepage"
+	redirectTopicFlagName              = "redirect-topic"
+	redirectReadmeBannerFlagName       = "redirect-readme-banner"
+	redirectIssueTitleFlagName         = "redirect-issue-title"
+	redirectIssueBodyFlagName          = "redirect-issue-body"
+	redirectPinIssueFlagName           = "redirect-pin-issue"
+	redirectDiscussionCategoryFlagName = "redirect-discussion-category"
+	lockReleaseFlagName                = "lock-release"
+	quietPeriodFlagName                = "quiet-period"
+	deferBusyFlagName                  = "defer-busy"
+	repositoryMappingFlagName          = "repository-mapping"
+	propertyMappingFlagName            = "property-mapping"
+	orgMappingFlagName                 = "org-mapping"
+	teamMappingFlagName                = "team-mapping"
+	rewriteModeFlagName                = "rewrite-mode"
+	outputDirFlagName                  = "output-dir"
+	routingFileFlagName                = "routing-file"
+)
+
+// source types
+const (
+	sourceTypeGitHub = "github"
+	sourceTypeADO    = "ado"
+	sourceTypeBBS    = "bbs"
+)
+
+const (
+	// exitCodeInterrupted is used when a migration stopped after SIGINT/SIGTERM
+	exitCodeInterrupted = 130
+	// exitCodeForced is used when a second signal forced an immediate stop
+	exitCodeForced = 131
 )
 
 //go:embed banner.txt
@@ -30,10 +112,366 @@ func initLogger(cmd *cobra.Command, args []string) {
 	logging.NewLoggerFromContext(ctx, enableDebug)
 }
 
+// preRun sets up logging and applies the configuration file, if one is given
+func preRun(cmd *cobra.Command, args []string) error {
+	initLogger(cmd, args)
+
+	configFile, _ := cmd.Flags().GetString(configFlagName)
+	if configFile == "" {
+		return nil
+	}
+
+	// errors of the file are not usage errors
+	cmd.SilenceUsage = true
+
+	return applyConfigFile(cmd, configFile)
+}
+
+// newInterruptibleContext returns a context that is cancelled on the first
+// SIGINT or SIGTERM. A second signal exits the process immediately.
+func newInterruptibleContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		}
+
+		slog.Warn("interrupt received, waiting for running migrations to finish or roll back. Interrupt again to force stop")
+		cancel()
+
+		<-signals
+		slog.Error("forced stop, repositories being migrated may be left in an inconsistent state")
+		os.Exit(exitCodeForced)
+	}()
+
+	return ctx, cancel
+}
+
+// connectionFromFlags builds the source and target of a migration from the
+// organization, credential, API URL and GEI storage flags
+func connectionFromFlags(cmd *cobra.Command) (migration.Connection, error) {
+	sourceOrg, _ := cmd.Flags().GetString(sourceOrgFlagName)
+	targetOrg, _ := cmd.Flags().GetString(targetOrgFlagName)
+	if sourceOrg == "" || targetOrg == "" {
+		return migration.Connection{}, fmt.Errorf("--%s and --%s are required", sourceOrgFlagName, targetOrgFlagName)
+	}
+
+	return connectionSettingsFromFlags(cmd)
+}
+
+// connectionSettingsFromFlags is connectionFromFlags without requiring the
+// organizations, for commands that work on several of them
+func connectionSettingsFromFlags(cmd *cobra.Command) (migration.Connection, error) {
+	conn := migration.Connection{}
+	conn.SourceOrg, _ = cmd.Flags().GetString(sourceOrgFlagName)
+	conn.TargetOrg, _ = cmd.Flags().GetString(targetOrgFlagName)
+	conn.SourceAPIURL, _ = cmd.Flags().GetString(sourceAPIURLFlagName)
+	conn.TargetAPIURL, _ = cmd.Flags().GetString(targetAPIURLFlagName)
+
+	for _, apiURL := range []string{conn.SourceAPIURL, conn.TargetAPIURL} {
+		if _, _, err := github.APIURLs(apiURL); err != nil {
+			return migration.Connection{}, err
+		}
+	}
+
+	conn.SourceGitURL, _ = cmd.Flags().GetString(sourceGitURLFlagName)
+	conn.TargetGitURL, _ = cmd.Flags().GetString(targetGitURLFlagName)
+	for _, gitURL := range []string{conn.SourceGitURL, conn.TargetGitURL} {
+		if gitURL == "" {
+			continue
+		}
+		if _, err := github.NewGitHostAt(gitURL, nil); err != nil {
+			return migration.Connection{}, err
+		}
+	}
+
+	sourceType, _ := cmd.Flags().GetString(sourceTypeFlagName)
+
+	var err error
+	if sourceType == sourceTypeGitHub {
+		conn.SourceCredentials, err = credentialPool(cmd, "source", sourceTokenFlagName, sourceAppFlagName, conn.SourceAPIURL)
+		if err != nil {
+			return migration.Connection{}, err
+		}
+	}
+
+	conn.TargetCredentials, err = credentialPool(cmd, "target", targetTokenFlagName, targetAppFlagName, conn.TargetAPIURL)
+	if err != nil {
+		return migration.Connection{}, err
+	}
+
+	conn.GEI.AzureStorageConnectionString, _ = cmd.Flags().GetString(azureStorageConnectionStringFlagName)
+	if conn.GEI.AzureStorageConnectionString == "" {
+		conn.GEI.AzureStorageConnectionString = os.Getenv("AZURE_STORAGE_CONNECTION_STRING")
+	}
+	conn.GEI.AWSBucketName, _ = cmd.Flags().GetString(awsBucketNameFlagName)
+	conn.GEI.AWSRegion, _ = cmd.Flags().GetString(awsRegionFlagName)
+	conn.GEI.UseGitHubStorage, _ = cmd.Flags().GetBool(useGitHubStorageFlagName)
+	conn.GEI.NoSSLVerify, _ = cmd.Flags().GetBool(noSSLVerifyFlagName)
+	conn.GEI.KeepArchive, _ = cmd.Flags().GetBool(keepArchiveFlagName)
+
+	conn.Provider, err = sourceProviderFromFlags(cmd, sourceType, conn)
+	if err != nil {
+		return migration.Connection{}, err
+	}
+
+	if conn.Provider != nil {
+		return conn, nil
+	}
+
+	conn.ArchiveStorage, err = archiveStorageFromFlags(cmd, conn.GEI)
+	if err != nil {
+		return migration.Connection{}, err
+	}
+
+	if conn.SourceAPIURL != "" && github.IsEnterpriseServer(conn.SourceAPIURL) && conn.ArchiveStorage == nil &&
+		conn.GEI.AzureStorageConnectionString == "" && conn.GEI.AWSBucketName == "" && !conn.GEI.UseGitHubStorage {
+		return migration.Connection{}, fmt.Errorf("a GitHub Enterprise Server source needs blob storage: set --%s, --%s, --%s or --%s",
+			archiveStorageFlagName, azureStorageConnectionStringFlagName, awsBucketNameFlagName, useGitHubStorageFlagName)
+	}
+
+	return conn, nil
+}
+
+// sourceProviderFromFlags returns the provider of an Azure DevOps or
+// Bitbucket Server source, or nil for GitHub sources
+func sourceProviderFromFlags(cmd *cobra.Command, sourceType string, conn migration.Connection) (migration.SourceProvider, error) {
+	geiOptions := conn.GEI
+	geiOptions.TargetAPIURL = conn.TargetAPIURL
+
+	switch sourceType {
+	case sourceTypeGitHub:
+		return nil, nil
+	case sourceTypeADO:
+		project, _ := cmd.Flags().GetString(adoTeamProjectFlagName)
+		token := flagOrEnv(cmd, adoPATFlagName, "ADO_PAT")
+		serverURL, _ := cmd.Flags().GetString(adoServerURLFlagName)
+		if project == "" || token == "" {
+			return nil, fmt.Errorf("--%s and --%s are required for Azure DevOps sources", adoTeamProjectFlagName, adoPATFlagName)
+		}
+		return github.NewADO(conn.SourceOrg, project, token, serverURL, conn.TargetOrg, conn.TargetCredentials, conn.TargetAPIURL), nil
+	case sourceTypeBBS:
+		options := github.BBSOptions{
+			Username: flagOrEnv(cmd, bbsUsernameFlagName, "BBS_USERNAME"),
+			Password: flagOrEnv(cmd, bbsPasswordFlagName, "BBS_PASSWORD"),
+		}
+		options.ServerURL, _ = cmd.Flags().GetString(bbsServerURLFlagName)
+		options.SSHUser, _ = cmd.Flags().GetString(bbsSSHUserFlagName)
+		options.SSHPrivateKey, _ = cmd.Flags().GetString(bbsSSHPrivateKeyFlagName)
+		options.SSHPort, _ = cmd.Flags().GetInt(bbsSSHPortFlagName)
+		if options.ServerURL == "" || options.Username == "" || options.Password == "" {
+			return nil, fmt.Errorf("--%s, --%s and --%s are required for Bitbucket Server sources", bbsServerURLFlagName, bbsUsernameFlagName, bbsPasswordFlagName)
+		}
+		return github.NewBBS(conn.SourceOrg, options, conn.TargetOrg, conn.TargetCredentials, geiOptions), nil
+	}
+
+	return nil, fmt.Errorf("unknown source type %q, expected github, ado or bbs", sourceType)
+}
+
+// flagOrEnv returns the value of a string flag or, if it is not set, of an
+// environment variable
+func flagOrEnv(cmd *cobra.Command, flagName, envName string) string {
+	if value, _ := cmd.Flags().GetString(flagName); value != "" {
+		return value
+	}
+	return os.Getenv(envName)
+}
+
+// archiveStorageFromFlags returns the storage selected with --archive-storage
+// or nil if GEI should stage the archives itself
+func archiveStorageFromFlags(cmd *cobra.Command, options github.GEIOptions) (github.ArchiveStorage, error) {
+	backend, _ := cmd.Flags().GetString(archiveStorageFlagName)
+
+	switch backend {
+	case "":
+		return nil, nil
+	case "azure":
+		return github.NewAzureStorage(options.AzureStorageConnectionString)
+	case "s3":
+		endpoint, _ := cmd.Flags().GetString(awsEndpointURLFlagName)
+		return github.NewS3Storage(options.AWSBucketName, options.AWSRegion, endpoint)
+	case "local":
+		dir, _ := cmd.Flags().GetString(archiveDirFlagName)
+		baseURL, _ := cmd.Flags().GetString(archiveBaseURLFlagName)
+		if dir == "" {
+			return nil, fmt.Errorf("--%s is required for local archive storage", archiveDirFlagName)
+		}
+		return github.NewLocalStorage(dir, baseURL)
+	}
+
+	return nil, fmt.Errorf("unknown archive storage %q, expected azure, s3 or local", backend)
+}
+
+func credentialPool(cmd *cobra.Command, side, tokenFlagName, appFlagName, apiURL string) (*github.CredentialPool, error) {
+	tokens, _ := cmd.Flags().GetString(tokenFlagName)
+	apps, _ := cmd.Flags().GetStringArray(appFlagName)
+
+	var credentials []github.Credential
+	for i, token := range strings.Split(tokens, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			credentials = append(credentials, github.NewPATCredential(fmt.Sprintf("%s-pat-%d", side, i+1), token))
+		}
+	}
+
+	for _, app := range apps {
+		credential, err := github.ParseAppCredential(app, apiURL)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	if len(credentials) == 0 {
+		return nil, fmt.Errorf("either --%s or --%s is required", tokenFlagName, appFlagName)
+	}
+
+	return github.NewCredentialPool(credentials...)
+}
+
+// mappingsFromFlag reads the <source>=<target> pairs of a repeatable flag.
+// With allowEmpty, <source>= maps to an empty target.
+func mappingsFromFlag(cmd *cobra.Command, flagName, kind string, allowEmpty bool) (map[string]string, error) {
+	pairs, _ := cmd.Flags().GetStringArray(flagName)
+
+	var mappings map[string]string
+	for _, pair := range pairs {
+		source, target, ok := strings.Cut(pair, "=")
+		source, target = strings.TrimSpace(source), strings.TrimSpace(target)
+		if !ok || source == "" || (target == "" && !allowEmpty) {
+			if allowEmpty {
+				return nil, fmt.Errorf("invalid %s mapping %q, expected <source>=<target> or <source>=", kind, pair)
+			}
+			return nil, fmt.Errorf("invalid %s mapping %q, expected <source>=<target>", kind, pair)
+		}
+		if mappings == nil {
+			mappings = make(map[string]string)
+		}
+		mappings[source] = target
+	}
+
+	return mappings, nil
+}
+
+// optionsFromFlags reads the worker, retry, filter, step and mapping
+// settings shared by all commands
+func optionsFromFlags(cmd *cobra.Command) (migration.Options, error) {
+	options := migration.Options{}
+	options.MaxRetries, _ = cmd.Flags().GetInt(maxRetriesFlagName)
+	options.Concurrency.MaxWorkers, _ = cmd.Flags().GetInt(workersFlagName)
+	options.Concurrency.MinWorkers, _ = cmd.Flags().GetInt(minWorkersFlagName)
+	options.Concurrency.JobTimeout, _ = cmd.Flags().GetDuration(jobTimeoutFlagName)
+	options.Filter.Include, _ = cmd.Flags().GetStringSlice(includeFlagName)
+	options.Filter.Exclude, _ = cmd.Flags().GetStringSlice(excludeFlagName)
+	options.SkipSteps, _ = cmd.Flags().GetStringSlice(skipStepFlagName)
+	options.EnableSteps, _ = cmd.Flags().GetStringSlice(enableStepFlagName)
+	options.VerifyGit, _ = cmd.Flags().GetBool(verifyGitFlagName)
+	options.DriftPolicy, _ = cmd.Flags().GetString(driftPolicyFlagName)
+	options.Redirect.Description, _ = cmd.Flags().GetString(redirectDescriptionFlagName)
+	options.Redirect.Homepage, _ = cmd.Flags().GetString(redirectHomepageFlagName)
+	options.Redirect.Topic, _ = cmd.Flags().GetString(redirectTopicFlagName)
+	options.Redirect.ReadmeBanner, _ = cmd.Flags().GetString(redirectReadmeBannerFlagName)
+	options.Redirect.IssueTitle, _ = cmd.Flags().GetString(redirectIssueTitleFlagName)
+	options.Redirect.IssueBody, _ = cmd.Flags().GetString(redirectIssueBodyFlagName)
+	options.Redirect.PinIssue, _ = cmd.Flags().GetBool(redirectPinIssueFlagName)
+	options.Redirect.DiscussionCategory, _ = cmd.Flags().GetString(redirectDiscussionCategoryFlagName)
+	options.References.Mode, _ = cmd.Flags().GetString(rewriteModeFlagName)
+	options.Lock.Mode, _ = cmd.Flags().GetString(lockModeFlagName)
+	options.Lock.Release, _ = cmd.Flags().GetString(lockReleaseFlagName)
+	options.Busy.Timeout, _ = cmd.Flags().GetDuration(busyTimeoutFlagName)
+	options.Busy.QuietPeriod, _ = cmd.Flags().GetDuration(quietPeriodFlagName)
+	options.Busy.Defer, _ = cmd.Flags().GetBool(deferBusyFlagName)
+	options.OutputDir, _ = cmd.Flags().GetString(outputDirFlagName)
+
+	if err := options.Filter.Validate(); err != nil {
+		return migration.Options{}, err
+	}
+
+	for _, step := range options.SkipSteps {
+		if err := migration.ValidateStep(step); err != nil {
+			return migration.Options{}, err
+		}
+	}
+	if err := migration.ValidateDriftPolicy(options.DriftPolicy); err != nil {
+		return migration.Options{}, err
+	}
+	if err := options.Lock.Validate(); err != nil {
+		return migration.Options{}, err
+	}
+	if err := options.Redirect.Validate(); err != nil {
+		return migration.Options{}, err
+	}
+	if err := options.References.Validate(); err != nil {
+		return migration.Options{}, err
+	}
+	for _, step := range options.EnableSteps {
+		if err := migration.ValidateOptInStep(step); err != nil {
+			return migration.Options{}, err
+		}
+	}
+
+	var err error
+	if options.RepositoryMappings, err = mappingsFromFlag(cmd, repositoryMappingFlagName, "repository", false); err != nil {
+		return migration.Options{}, err
+	}
+	if options.Provenance.PropertyMappings, err = mappingsFromFlag(cmd, propertyMappingFlagName, "property", true); err != nil {
+		return migration.Options{}, err
+	}
+	if options.References.OrgMappings, err = mappingsFromFlag(cmd, orgMappingFlagName, "organization", false); err != nil {
+		return migration.Options{}, err
+	}
+	if options.References.TeamMappings, err = mappingsFromFlag(cmd, teamMappingFlagName, "team", false); err != nil {
+		return migration.Options{}, err
+	}
+
+	if routingFile, _ := cmd.Flags().GetString(routingFileFlagName); routingFile != "" {
+		routing, err := migration.LoadRouting(routingFile)
+		if err != nil {
+			return migration.Options{}, err
+		}
+		options.Routing = routing
+	}
+
+	if options.OutputDir != "" {
+		if err := os.MkdirAll(options.OutputDir, 0755); err != nil {
+			return migration.Options{}, err
+		}
+	}
+
+	return options, nil
+}
+
+// writeResultFile writes result as indented JSON to the given file in the
+// output directory
+func writeResultFile(cmd *cobra.Command, fileName string, result interface{}) error {
+	jsonData, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		slog.Error("failed to parse result", "error", err)
+		return err
+	}
+
+	outputDir, _ := cmd.Flags().GetString(outputDirFlagName)
+	fileName = filepath.Join(outputDir, fileName)
+
+	if err := os.WriteFile(fileName, jsonData, 0644); err != nil {
+		slog.Error("failed to write to results file", "error", err)
+		return err
+	}
+
+	slog.Info("result saved to " + fileName)
+
+	return nil
+}
+
 var rootCmd = &cobra.Command{
-	Use:              "gei-migration-helper",
-	PersistentPreRun: initLogger,
-	Short:            "Wrapper application to the GEI extension that orchestrates steps necessary to migrate reposistories and GHAS features",
+	Use:               "gei-migration-helper",
+	PersistentPreRunE: preRun,
+	Short:             "Wrapper application to the GEI extension that orchestrates steps necessary to migrate reposistories and GHAS features",
 }
 
 func Execute() {
@@ -52,18 +490,73 @@ func init() {
 
 	rootCmd.PersistentFlags().BoolVar(&enableDebug, "debug", os.Getenv("DEBUG") == "true", "Enable debug mode")
 
-	rootCmd.PersistentFlags().String(sourceOrgFlagName, "", "The source organization.")
-	rootCmd.MarkPersistentFlagRequired(sourceOrgFlagName)
+	rootCmd.PersistentFlags().String(configFlagName, "", "[OPTIONAL] A YAML configuration file. Flags that are set take precedence over the values of the file.")
 
+	rootCmd.PersistentFlags().String(sourceOrgFlagName, "", "The source organization.")
 	rootCmd.PersistentFlags().String(targetOrgFlagName, "", "The target organization.")
-	rootCmd.MarkPersistentFlagRequired(targetOrgFlagName)
 
-	rootCmd.PersistentFlags().String(sourceTokenFlagName, "", "The token of the source organization.")
-	rootCmd.MarkPersistentFlagRequired(sourceTokenFlagName)
+	rootCmd.PersistentFlags().String(sourceTokenFlagName, "", "The token of the source organization. Separate several tokens with commas to spread requests across them.")
+	rootCmd.PersistentFlags().String(targetTokenFlagName, "", "The token of the target organization. Separate several tokens with commas to spread requests across them.")
 
-	rootCmd.PersistentFlags().String(targetTokenFlagName, "", "The token of the target organization.")
-	rootCmd.MarkPersistentFlagRequired(targetTokenFlagName)
+	rootCmd.PersistentFlags().StringArray(sourceAppFlagName, nil, "[OPTIONAL] A GitHub App installation for the source organization as <app id>:<installation id>:<private key file>. Can be repeated and combined with --source-token.")
+	rootCmd.PersistentFlags().StringArray(targetAppFlagName, nil, "[OPTIONAL] A GitHub App installation for the target organization as <app id>:<installation id>:<private key file>. Can be repeated and combined with --target-token.")
 
 	rootCmd.PersistentFlags().Int(maxRetriesFlagName, 5, "[OPTIONAL] The maximum number of retries for a failed operation. Default: 5")
 	rootCmd.PersistentFlags().Int(workersFlagName, 5, "[OPTIONAL] The number of workers to use for parallel operations. Default: 5")
+	rootCmd.PersistentFlags().Int(minWorkersFlagName, 1, "[OPTIONAL] The number of workers to scale down to when the rate limit budget runs low. Set to the number of workers to disable scaling. Default: 1")
+	rootCmd.PersistentFlags().String(sourceAPIURLFlagName, "", "[OPTIONAL] The API URL of the source, e.g. https://ghes.example.com/api/v3 for GitHub Enterprise Server. Default: https://api.github.com")
+	rootCmd.PersistentFlags().String(targetAPIURLFlagName, "", "[OPTIONAL] The API URL of the target, e.g. https://api.example.ghe.com for GitHub Enterprise Cloud with data residency. Default: https://api.github.com")
+	rootCmd.PersistentFlags().String(sourceGitURLFlagName, "", "[OPTIONAL] The URL the source serves git under, e.g. https://git.example.com, or file:///srv/git to clone local bare repositories <org>/<repo>.git with --verify-git. Default: derived from the source API URL")
+	rootCmd.PersistentFlags().String(targetGitURLFlagName, "", "[OPTIONAL] The URL the target serves git under, e.g. https://git.example.com, or file:///srv/git to clone local bare repositories <org>/<repo>.git with --verify-git. Default: derived from the target API URL")
+	rootCmd.PersistentFlags().String(azureStorageConnectionStringFlagName, "", "[OPTIONAL] The Azure Blob Storage connection string used for GitHub Enterprise Server migration archives. Default: $AZURE_STORAGE_CONNECTION_STRING")
+	rootCmd.PersistentFlags().String(awsBucketNameFlagName, "", "[OPTIONAL] The AWS S3 bucket used for GitHub Enterprise Server migration archives. Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.")
+	rootCmd.PersistentFlags().String(awsRegionFlagName, "", "[OPTIONAL] The region of the AWS S3 bucket.")
+	rootCmd.PersistentFlags().Bool(useGitHubStorageFlagName, false, "[OPTIONAL] Upload GitHub Enterprise Server migration archives to GitHub-owned storage.")
+	rootCmd.PersistentFlags().Bool(noSSLVerifyFlagName, false, "[OPTIONAL] Skip SSL verification when GEI downloads migration archives from GitHub Enterprise Server.")
+	rootCmd.PersistentFlags().Bool(keepArchiveFlagName, false, "[OPTIONAL] Keep the GitHub Enterprise Server migration archives after the migration.")
+
+	rootCmd.PersistentFlags().String(archiveStorageFlagName, "", "[OPTIONAL] Stage GitHub Enterprise Server migration archives with this tool instead of GEI: azure, s3 or local. Default: GEI stages the archives")
+	rootCmd.PersistentFlags().String(awsEndpointURLFlagName, "", "[OPTIONAL] The endpoint of an S3 compatible service such as MinIO, e.g. http://localhost:9000. Only used with --archive-storage s3.")
+	rootCmd.PersistentFlags().String(archiveDirFlagName, "", "[OPTIONAL] The directory archives are written to with --archive-storage local.")
+	rootCmd.PersistentFlags().String(archiveBaseURLFlagName, "", "[OPTIONAL] The URL --archive-dir is served at. Default: file URLs")
+
+	rootCmd.PersistentFlags().String(sourceTypeFlagName, sourceTypeGitHub, "[OPTIONAL] The type of the source: github, ado (Azure DevOps) or bbs (Bitbucket Server). For ado, --source-org is the Azure DevOps organization, for bbs the project key. Default: github")
+	rootCmd.PersistentFlags().String(adoTeamProjectFlagName, "", "[OPTIONAL] The Azure DevOps team project to migrate.")
+	rootCmd.PersistentFlags().String(adoPATFlagName, "", "[OPTIONAL] The Azure DevOps personal access token. Default: $ADO_PAT")
+	rootCmd.PersistentFlags().String(adoServerURLFlagName, "", "[OPTIONAL] The URL of an Azure DevOps Server. Default: https://dev.azure.com")
+	rootCmd.PersistentFlags().String(bbsServerURLFlagName, "", "[OPTIONAL] The URL of the Bitbucket Server.")
+	rootCmd.PersistentFlags().String(bbsUsernameFlagName, "", "[OPTIONAL] The Bitbucket Server username. Default: $BBS_USERNAME")
+	rootCmd.PersistentFlags().String(bbsPasswordFlagName, "", "[OPTIONAL] The Bitbucket Server password. Default: $BBS_PASSWORD")
+	rootCmd.PersistentFlags().String(bbsSSHUserFlagName, "", "[OPTIONAL] The SSH user bbs2gh downloads the export archives with.")
+	rootCmd.PersistentFlags().String(bbsSSHPrivateKeyFlagName, "", "[OPTIONAL] The SSH private key file of --bbs-ssh-user.")
+	rootCmd.PersistentFlags().Int(bbsSSHPortFlagName, 0, "[OPTIONAL] The SSH port of the Bitbucket Server. Default: 22")
+
+	rootCmd.PersistentFlags().Duration(jobTimeoutFlagName, 0, "[OPTIONAL] The maximum time a single repository may take, e.g. 2h. Default: no limit")
+
+	rootCmd.PersistentFlags().StringSlice(includeFlagName, nil, "[OPTIONAL] Only process repositories whose name matches one of these patterns, e.g. 'team-*'. Default: all repositories")
+	rootCmd.PersistentFlags().StringSlice(excludeFlagName, nil, "[OPTIONAL] Skip repositories whose name matches one of these patterns.")
+	rootCmd.PersistentFlags().StringSlice(skipStepFlagName, nil, "[OPTIONAL] Optional steps to skip: "+strings.Join(migration.Steps, ", "))
+	rootCmd.PersistentFlags().StringSlice(enableStepFlagName, nil, "[OPTIONAL] Opt-in steps to run: "+strings.Join(migration.OptInSteps, ", "))
+	rootCmd.PersistentFlags().String(redirectDescriptionFlagName, migration.DefaultRedirectDescription, "[OPTIONAL] With --enable-step redirect-notice: template of the source description, empty to keep it. Default: "+migration.DefaultRedirectDescription)
+	rootCmd.PersistentFlags().String(redirectHomepageFlagName, "{{.TargetURL}}", "[OPTIONAL] With --enable-step redirect-notice: template of the source homepage, empty to keep it. Default: {{.TargetURL}}")
+	rootCmd.PersistentFlags().String(redirectTopicFlagName, "migrated", "[OPTIONAL] With --enable-step redirect-notice: topic added to the source, empty for none. Default: migrated")
+	rootCmd.PersistentFlags().String(redirectReadmeBannerFlagName, "", "[OPTIONAL] With --enable-step redirect-notice: template of a banner committed to the top of the README of the default branch of the source.")
+	rootCmd.PersistentFlags().String(redirectIssueTitleFlagName, "", "[OPTIONAL] With --enable-step redirect-notice: template of the title of an issue opened at source.")
+	rootCmd.PersistentFlags().String(redirectIssueBodyFlagName, migration.DefaultRedirectIssueBody, "[OPTIONAL] With --redirect-issue-title: template of the body of the issue.")
+	rootCmd.PersistentFlags().Bool(redirectPinIssueFlagName, false, "[OPTIONAL] With --redirect-issue-title: pin the issue.")
+	rootCmd.PersistentFlags().String(redirectDiscussionCategoryFlagName, "", "[OPTIONAL] With --redirect-issue-title: open a discussion in this category instead of an issue.")
+	rootCmd.PersistentFlags().String(lockModeFlagName, migration.LockModeArchive, "[OPTIONAL] With --enable-step lock-source: archive the source while GEI migrates it, or downgrade all teams and collaborators to read with permissions, which leaves organization owners, organization-wide roles and the base permission of the organization able to push. Default: archive")
+	rootCmd.PersistentFlags().String(lockReleaseFlagName, migration.LockReleaseArchive, "[OPTIONAL] With --enable-step lock-source: archive a migrated source, or restore it and point its description to the target with restore. Default: archive")
+	rootCmd.PersistentFlags().Duration(busyTimeoutFlagName, 30*time.Minute, "[OPTIONAL] With --enable-step wait-for-idle: how long to wait for workflow runs and pushes at source before a repository fails. Default: 30m")
+	rootCmd.PersistentFlags().Duration(quietPeriodFlagName, 5*time.Minute, "[OPTIONAL] With --enable-step wait-for-idle: a repository pushed to within this period is busy, 0 ignores pushes. Default: 5m")
+	rootCmd.PersistentFlags().Bool(deferBusyFlagName, false, "[OPTIONAL] With --enable-step wait-for-idle: move a busy repository to the back of the queue once before waiting for it.")
+	rootCmd.PersistentFlags().String(driftPolicyFlagName, migration.DriftPolicyFail, "[OPTIONAL] What to do with repositories whose source branches changed while they were migrated: fail, or remigrate to delete the target repository and migrate them again, which needs the delete_repo scope at target. Default: fail")
+	rootCmd.PersistentFlags().Bool(verifyGitFlagName, false, "[OPTIONAL] Also compare all git refs, including tags and notes, of bare mirror clones of source and target when verifying. Needs git and disk space for both clones.")
+	rootCmd.PersistentFlags().StringArray(repositoryMappingFlagName, nil, "[OPTIONAL] Migrate a repository under another name as <source>=<target>. Can be repeated.")
+	rootCmd.PersistentFlags().StringArray(orgMappingFlagName, nil, "[OPTIONAL] With --enable-step rewrite-references: rewrite references to another source organization as <source>=<target>. Can be repeated.")
+	rootCmd.PersistentFlags().StringArray(teamMappingFlagName, nil, "[OPTIONAL] With --enable-step rewrite-references: rewrite a team of the source organization to another team slug as <source>=<target>. Can be repeated.")
+	rootCmd.PersistentFlags().String(rewriteModeFlagName, migration.RewriteModePullRequest, "[OPTIONAL] With --enable-step rewrite-references: open a pull-request with the rewritten references or commit them to the default branch with commit. Default: pull-request")
+	rootCmd.PersistentFlags().StringArray(propertyMappingFlagName, nil, "[OPTIONAL] With --enable-step tag-provenance: copy a custom property of the source under another name as <source>=<target>, or not at all as <source>=. Can be repeated.")
+	rootCmd.PersistentFlags().String(routingFileFlagName, "", "[OPTIONAL] A YAML or CSV file that routes repositories to other target organizations than --target-org.")
+	rootCmd.PersistentFlags().String(outputDirFlagName, "", "[OPTIONAL] The directory result and checkpoint files are written to. Default: the working directory")
 }
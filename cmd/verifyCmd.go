@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+	"github.com/spf13/cobra"
+)
+
+const verificationResultFileName = "verification-result.json"
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Compare migrated repositories with their source",
+	Long: `Compares every migrated repository with its source: branch and tag
+	counts and heads, default branch, commits on the default branch, issue, pull
+	request and release counts, code scanning analyses and alerts by state and
+	secret scanning alerts by resolution.
+
+	Every check is reported as pass, fail or skipped, if it could not be read on
+	one side. Repositories with a failed check are listed as degraded in
+	verification-result.json.
+
+	Run it after migrate-secret-scanning to include secret scanning alerts. The
+	same comparison, without secret scanning, runs at the end of every
+	repository migration with --enable-step verify.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := connectionFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid connection settings", "error", err)
+			os.Exit(1)
+		}
+		repository, _ := cmd.Flags().GetString(repositoryFlagName)
+		options, err := optionsFromFlags(cmd)
+		if err != nil {
+			slog.Error("invalid migration settings", "error", err)
+			os.Exit(1)
+		}
+
+		slog.Info(fmt.Sprintf("verifying migration from %s to %s", conn.SourceOrg, conn.TargetOrg))
+
+		ctx, cancel := newInterruptibleContext()
+		defer cancel()
+
+		orgMigration, err := migration.NewOrgMigration(ctx, conn, options)
+		if err != nil {
+			slog.Error("error creating migration", "error", err)
+			os.Exit(1)
+		}
+
+		result, err := orgMigration.Verify(ctx, repository)
+		if err != nil {
+			slog.Error("error verifying migration", "error", err)
+			os.Exit(1)
+		}
+
+		if err := writeResultFile(cmd, verificationResultFileName, result); err != nil {
+			os.Exit(1)
+		}
+
+		if result.Interrupted {
+			os.Exit(exitCodeInterrupted)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().String(repositoryFlagName, "", "[OPTIONAL] The repository to verify. If not provided, all repositories of the organization are verified.")
+}
@@ -0,0 +1,472 @@
+// Package config reads the YAML configuration file that can be passed to
+// every command with --config. Values of the file are defaults for the
+// command line flags: a flag that is set explicitly takes precedence.
+package config
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is the JSON schema of the configuration file, for use in editors
+//
+//go:embed schema.json
+var Schema []byte
+
+// Config is the content of a configuration file. Secrets are not part of the
+// file, it names the environment variables they are read from instead.
+type Config struct {
+	Source     Source        `yaml:"source"`
+	Target     Target        `yaml:"target"`
+	Storage    Storage       `yaml:"storage"`
+	Workers    int           `yaml:"workers"`
+	MinWorkers int           `yaml:"minWorkers"`
+	JobTimeout time.Duration `yaml:"jobTimeout"`
+	MaxRetries int           `yaml:"maxRetries"`
+	Filters    Filters       `yaml:"filters"`
+	// Steps enables or disables the optional steps of a repository
+	// migration, see migration.Steps and migration.OptInSteps. Optional
+	// steps that are not listed run, opt-in steps that are not listed do not.
+	Steps        map[string]bool `yaml:"steps"`
+	Verification Verification    `yaml:"verification"`
+	Busy         Busy            `yaml:"busy"`
+	Lock         Lock            `yaml:"lock"`
+	Redirect     Redirect        `yaml:"redirect"`
+	// DriftPolicy is fail or remigrate, see --drift-policy
+	DriftPolicy string `yaml:"driftPolicy"`
+	// RewriteMode is pull-request or commit, see --rewrite-mode
+	RewriteMode string   `yaml:"rewriteMode"`
+	Mappings    Mappings `yaml:"mappings"`
+	// RoutingFile is a routing table, see --routing-file
+	RoutingFile string     `yaml:"routingFile"`
+	Output      Output     `yaml:"output"`
+	Enterprise  Enterprise `yaml:"enterprise"`
+}
+
+// Verification configures the comparison of migrated repositories with their
+// source
+type Verification struct {
+	// Git also compares all refs of mirror clones, see --verify-git
+	Git bool `yaml:"git"`
+}
+
+// Busy configures the wait-for-idle step
+type Busy struct {
+	Timeout time.Duration `yaml:"timeout"`
+	// QuietPeriod is a pointer as 0 turns the check for pushes off
+	QuietPeriod *time.Duration `yaml:"quietPeriod"`
+	Defer       bool           `yaml:"defer"`
+}
+
+// Lock configures the lock-source step
+type Lock struct {
+	// Mode is archive or permissions, see --lock-mode
+	Mode string `yaml:"mode"`
+	// Release is archive or restore, see --lock-release
+	Release string `yaml:"release"`
+}
+
+// Redirect configures the redirect-notice step. The texts are templates, see
+// migration.RedirectNotice.
+type Redirect struct {
+	// Description, Homepage and Topic are pointers as an empty string leaves
+	// the source as it is instead of using the default
+	Description  *string       `yaml:"description"`
+	Homepage     *string       `yaml:"homepage"`
+	Topic        *string       `yaml:"topic"`
+	ReadmeBanner string        `yaml:"readmeBanner"`
+	Issue        RedirectIssue `yaml:"issue"`
+}
+
+type RedirectIssue struct {
+	Title string `yaml:"title"`
+	Body  string `yaml:"body"`
+	Pin   bool   `yaml:"pin"`
+	// DiscussionCategory opens a discussion in this category instead
+	DiscussionCategory string `yaml:"discussionCategory"`
+}
+
+type Source struct {
+	// Type is github, ado or bbs
+	Type     string   `yaml:"type"`
+	Org      string   `yaml:"org"`
+	APIURL   string   `yaml:"apiUrl"`
+	GitURL   string   `yaml:"gitUrl"`
+	TokenEnv []string `yaml:"tokenEnv"`
+	Apps     []App    `yaml:"apps"`
+	ADO      ADO      `yaml:"ado"`
+	BBS      BBS      `yaml:"bbs"`
+}
+
+type Target struct {
+	Org      string   `yaml:"org"`
+	APIURL   string   `yaml:"apiUrl"`
+	GitURL   string   `yaml:"gitUrl"`
+	TokenEnv []string `yaml:"tokenEnv"`
+	Apps     []App    `yaml:"apps"`
+}
+
+// App is a GitHub App installation used as credential
+type App struct {
+	AppID          int64  `yaml:"appId"`
+	InstallationID int64  `yaml:"installationId"`
+	PrivateKeyFile string `yaml:"privateKeyFile"`
+}
+
+type ADO struct {
+	TeamProject string `yaml:"teamProject"`
+	PATEnv      string `yaml:"patEnv"`
+	ServerURL   string `yaml:"serverUrl"`
+}
+
+type BBS struct {
+	ServerURL         string `yaml:"serverUrl"`
+	UsernameEnv       string `yaml:"usernameEnv"`
+	PasswordEnv       string `yaml:"passwordEnv"`
+	SSHUser           string `yaml:"sshUser"`
+	SSHPrivateKeyFile string `yaml:"sshPrivateKeyFile"`
+	SSHPort           int    `yaml:"sshPort"`
+}
+
+// Storage holds the settings of the storage migration archives are staged
+// in
+type Storage struct {
+	// Stage is azure, s3 or local to stage archives with this tool, see
+	// --archive-storage
+	Stage                    string `yaml:"stage"`
+	AzureConnectionStringEnv string `yaml:"azureConnectionStringEnv"`
+	AWSBucketName            string `yaml:"awsBucketName"`
+	AWSRegion                string `yaml:"awsRegion"`
+	AWSEndpointURL           string `yaml:"awsEndpointUrl"`
+	UseGitHubStorage         bool   `yaml:"useGitHubStorage"`
+	ArchiveDir               string `yaml:"archiveDir"`
+	ArchiveBaseURL           string `yaml:"archiveBaseUrl"`
+	KeepArchive              bool   `yaml:"keepArchive"`
+	NoSSLVerify              bool   `yaml:"noSslVerify"`
+}
+
+type Filters struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+type Mappings struct {
+	// Repositories maps source repository names to target repository names
+	Repositories map[string]string `yaml:"repositories"`
+	// Properties maps custom properties of the source to custom properties of
+	// the target, an empty name drops the property
+	Properties map[string]string `yaml:"properties"`
+	// Organizations and Teams map other source organizations and the teams
+	// of the source organization for the rewrite-references step
+	Organizations map[string]string `yaml:"organizations"`
+	Teams         map[string]string `yaml:"teams"`
+}
+
+// Enterprise lists the organizations migrated by migrate-enterprise
+type Enterprise struct {
+	// Source is the slug of a source enterprise whose organizations are
+	// all migrated
+	Source             string         `yaml:"source"`
+	PrefixRepositories bool           `yaml:"prefixRepositories"`
+	Organizations      []Organization `yaml:"organizations"`
+}
+
+type Organization struct {
+	Source string `yaml:"source"`
+	Target string `yaml:"target"`
+	Prefix string `yaml:"prefix"`
+}
+
+// Flag returns the organization in the format of the --org-pair flag
+func (o Organization) Flag() string {
+	if o.Prefix != "" {
+		return o.Source + ":" + o.Target + ":" + o.Prefix
+	}
+	return o.Source + ":" + o.Target
+}
+
+type Output struct {
+	// Directory the result and checkpoint files are written to
+	Directory string `yaml:"directory"`
+}
+
+// Load reads and validates a configuration file. Unknown keys are an error.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config Config
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%s:\n%w", path, err)
+	}
+
+	return &config, nil
+}
+
+// Validate checks the values of the configuration and returns all problems
+// found, each prefixed with the path of the offending key
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(path, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	sourceType := c.Source.Type
+	if sourceType == "" {
+		sourceType = "github"
+	}
+	if !slices.Contains([]string{"github", "ado", "bbs"}, sourceType) {
+		fail("source.type", "must be one of github, ado, bbs, got %q", c.Source.Type)
+	}
+
+	if c.Source.APIURL != "" {
+		if _, _, err := github.APIURLs(c.Source.APIURL); err != nil {
+			fail("source.apiUrl", "%v", err)
+		}
+	}
+	if c.Target.APIURL != "" {
+		if _, _, err := github.APIURLs(c.Target.APIURL); err != nil {
+			fail("target.apiUrl", "%v", err)
+		}
+	}
+	if c.Source.GitURL != "" {
+		if _, err := github.NewGitHostAt(c.Source.GitURL, nil); err != nil {
+			fail("source.gitUrl", "%v", err)
+		}
+	}
+	if c.Target.GitURL != "" {
+		if _, err := github.NewGitHostAt(c.Target.GitURL, nil); err != nil {
+			fail("target.gitUrl", "%v", err)
+		}
+	}
+
+	validateApps := func(path string, apps []App) {
+		for i, app := range apps {
+			if app.AppID <= 0 {
+				fail(fmt.Sprintf("%s[%d].appId", path, i), "is required")
+			}
+			if app.InstallationID <= 0 {
+				fail(fmt.Sprintf("%s[%d].installationId", path, i), "is required")
+			}
+			if app.PrivateKeyFile == "" {
+				fail(fmt.Sprintf("%s[%d].privateKeyFile", path, i), "is required")
+			}
+		}
+	}
+	validateApps("source.apps", c.Source.Apps)
+	validateApps("target.apps", c.Target.Apps)
+
+	switch sourceType {
+	case "ado":
+		if c.Source.ADO.TeamProject == "" {
+			fail("source.ado.teamProject", "is required for Azure DevOps sources")
+		}
+	case "bbs":
+		if c.Source.BBS.ServerURL == "" {
+			fail("source.bbs.serverUrl", "is required for Bitbucket Server sources")
+		}
+		if c.Source.BBS.SSHPort < 0 || c.Source.BBS.SSHPort > 65535 {
+			fail("source.bbs.sshPort", "must be a port number, got %d", c.Source.BBS.SSHPort)
+		}
+	}
+
+	switch c.Storage.Stage {
+	case "", "azure":
+	case "s3":
+		if c.Storage.AWSBucketName == "" {
+			fail("storage.awsBucketName", "is required when storage.stage is s3")
+		}
+	case "local":
+		if c.Storage.ArchiveDir == "" {
+			fail("storage.archiveDir", "is required when storage.stage is local")
+		}
+	default:
+		fail("storage.stage", "must be one of azure, s3, local, got %q", c.Storage.Stage)
+	}
+
+	if c.Workers < 0 {
+		fail("workers", "must not be negative")
+	}
+	if c.MinWorkers < 0 {
+		fail("minWorkers", "must not be negative")
+	}
+	if c.Workers > 0 && c.MinWorkers > c.Workers {
+		fail("minWorkers", "must not be greater than workers (%d)", c.Workers)
+	}
+	if c.JobTimeout < 0 {
+		fail("jobTimeout", "must not be negative")
+	}
+	if c.Busy.Timeout < 0 {
+		fail("busy.timeout", "must not be negative")
+	}
+	if c.Busy.QuietPeriod != nil && *c.Busy.QuietPeriod < 0 {
+		fail("busy.quietPeriod", "must not be negative")
+	}
+	if c.MaxRetries < 0 {
+		fail("maxRetries", "must not be negative")
+	}
+
+	for i, pattern := range c.Filters.Include {
+		if err := (migration.RepositoryFilter{Include: []string{pattern}}).Validate(); err != nil {
+			fail(fmt.Sprintf("filters.include[%d]", i), "%v", err)
+		}
+	}
+	for i, pattern := range c.Filters.Exclude {
+		if err := (migration.RepositoryFilter{Exclude: []string{pattern}}).Validate(); err != nil {
+			fail(fmt.Sprintf("filters.exclude[%d]", i), "%v", err)
+		}
+	}
+
+	for step := range c.Steps {
+		if migration.ValidateStep(step) != nil && migration.ValidateOptInStep(step) != nil {
+			fail("steps."+step, "unknown step %q, expected one of %s", step, strings.Join(append(slices.Clone(migration.Steps), migration.OptInSteps...), ", "))
+		}
+	}
+
+	if err := (migration.SourceLock{Mode: c.Lock.Mode}).Validate(); err != nil {
+		fail("lock.mode", "%v", err)
+	}
+	if err := (migration.SourceLock{Release: c.Lock.Release}).Validate(); err != nil {
+		fail("lock.release", "%v", err)
+	}
+
+	if err := (migration.RedirectNotice{
+		Description:  value(c.Redirect.Description),
+		Homepage:     value(c.Redirect.Homepage),
+		Topic:        value(c.Redirect.Topic),
+		ReadmeBanner: c.Redirect.ReadmeBanner,
+		IssueTitle:   c.Redirect.Issue.Title,
+		IssueBody:    c.Redirect.Issue.Body,
+	}).Validate(); err != nil {
+		fail("redirect", "%v", err)
+	}
+
+	if err := (migration.ReferenceRewrite{Mode: c.RewriteMode}).Validate(); err != nil {
+		fail("rewriteMode", "%v", err)
+	}
+
+	if c.DriftPolicy != "" {
+		if err := migration.ValidateDriftPolicy(c.DriftPolicy); err != nil {
+			fail("driftPolicy", "%v", err)
+		}
+	}
+
+	sources := make([]string, 0, len(c.Mappings.Repositories))
+	for source := range c.Mappings.Repositories {
+		sources = append(sources, source)
+	}
+	slices.Sort(sources)
+
+	targets := make(map[string]string)
+	for _, source := range sources {
+		target := c.Mappings.Repositories[source]
+		if target == "" {
+			fail("mappings.repositories."+source, "target name must not be empty")
+			continue
+		}
+		if other, ok := targets[strings.ToLower(target)]; ok {
+			fail("mappings.repositories."+source, "target %q is also the target of %s", target, other)
+		}
+		targets[strings.ToLower(target)] = source
+	}
+
+	if c.RoutingFile != "" {
+		if _, err := migration.LoadRouting(c.RoutingFile); err != nil {
+			fail("routingFile", "%v", err)
+		}
+	}
+
+	for i, organization := range c.Enterprise.Organizations {
+		for key, value := range map[string]string{"source": organization.Source, "target": organization.Target} {
+			if value == "" {
+				fail(fmt.Sprintf("enterprise.organizations[%d].%s", i, key), "is required")
+			} else if strings.Contains(value, ":") {
+				fail(fmt.Sprintf("enterprise.organizations[%d].%s", i, key), "must not contain ':'")
+			}
+		}
+	}
+
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+
+	return errors.Join(errs...)
+}
+
+// value returns the string s points to, or an empty string
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// MissingEnv returns the referenced environment variables that are not set,
+// each with the path of the key that references it
+func (c *Config) MissingEnv() []string {
+	var missing []string
+	check := func(path, name string) {
+		if name != "" && os.Getenv(name) == "" {
+			missing = append(missing, fmt.Sprintf("%s: environment variable %s is not set", path, name))
+		}
+	}
+
+	for i, name := range c.Source.TokenEnv {
+		check(fmt.Sprintf("source.tokenEnv[%d]", i), name)
+	}
+	for i, name := range c.Target.TokenEnv {
+		check(fmt.Sprintf("target.tokenEnv[%d]", i), name)
+	}
+	check("source.ado.patEnv", c.Source.ADO.PATEnv)
+	check("source.bbs.usernameEnv", c.Source.BBS.UsernameEnv)
+	check("source.bbs.passwordEnv", c.Source.BBS.PasswordEnv)
+	check("storage.azureConnectionStringEnv", c.Storage.AzureConnectionStringEnv)
+
+	return missing
+}
+
+// SkipSteps returns the steps that are disabled, in the order of
+// migration.Steps
+func (c *Config) SkipSteps() []string {
+	var skip []string
+	for _, step := range migration.Steps {
+		if enabled, ok := c.Steps[step]; ok && !enabled {
+			skip = append(skip, step)
+		}
+	}
+	return skip
+}
+
+// EnableSteps returns the opt-in steps that are enabled, in the order of
+// migration.OptInSteps
+func (c *Config) EnableSteps() []string {
+	var enable []string
+	for _, step := range migration.OptInSteps {
+		if c.Steps[step] {
+			enable = append(enable, step)
+		}
+	}
+	return enable
+}
+
+// Flag returns the app in the format of the --source-app and --target-app
+// flags
+func (a App) Flag() string {
+	return fmt.Sprintf("%d:%d:%s", a.AppID, a.InstallationID, a.PrivateKeyFile)
+}
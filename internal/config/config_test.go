@@ -0,0 +1,303 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/migration"
+)
+
+// writeConfig writes content to a configuration file in a temporary
+// directory and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "migration.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		// errors lists parts of the expected error, nil for a valid file
+		errors []string
+	}{
+		{
+			name: "valid",
+			content: `
+source:
+  org: source
+  tokenEnv: [SOURCE_TOKEN]
+target:
+  org: target
+workers: 4
+jobTimeout: 3h
+steps:
+  archive-source: false
+  verify: true
+redirect:
+  description: ""
+`,
+		},
+		{"empty", "", []string{"EOF"}},
+		{"unknown key", "workerz: 4\n", []string{"field workerz not found"}},
+		{"unknown nested key", "source:\n  organization: source\n", []string{"field organization not found"}},
+		{"wrong type", "workers: many\n", []string{"cannot unmarshal"}},
+		{"invalid duration", "jobTimeout: soon\n", []string{"soon"}},
+		{"unknown step", "steps:\n  bogus: true\n", []string{`steps.bogus: unknown step "bogus"`}},
+		{
+			name:    "every problem",
+			content: "workers: 2\nminWorkers: 3\ndriftPolicy: ignore\nstorage:\n  stage: s3\n",
+			errors:  []string{"driftPolicy: ", "minWorkers: must not be greater than workers (2)", "storage.awsBucketName: is required"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Load(writeConfig(t, tc.content))
+
+			if tc.errors == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if c == nil {
+					t.Fatal("no configuration returned")
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, part := range tc.errors {
+				if !strings.Contains(err.Error(), part) {
+					t.Errorf("error %q does not contain %q", err, part)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadKeepsEmptyRedirectTexts(t *testing.T) {
+	c, err := Load(writeConfig(t, "redirect:\n  description: \"\"\n  topic: moved\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Redirect.Description == nil || *c.Redirect.Description != "" {
+		t.Errorf("got description %v, want an empty string", c.Redirect.Description)
+	}
+	if c.Redirect.Homepage != nil {
+		t.Errorf("got homepage %q, want none", *c.Redirect.Homepage)
+	}
+	if c.Redirect.Topic == nil || *c.Redirect.Topic != "moved" {
+		t.Errorf("got topic %v, want moved", c.Redirect.Topic)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	negative := -time.Minute
+
+	for _, tc := range []struct {
+		name   string
+		config Config
+		// errors lists the expected errors by key path, nil for a valid
+		// configuration
+		errors []string
+	}{
+		{"empty", Config{}, nil},
+		{"source type", Config{Source: Source{Type: "gitlab"}}, []string{"source.type"}},
+		{"ado without team project", Config{Source: Source{Type: "ado"}}, []string{"source.ado.teamProject"}},
+		{"bbs", Config{Source: Source{Type: "bbs", BBS: BBS{SSHPort: 70000}}}, []string{"source.bbs.serverUrl", "source.bbs.sshPort"}},
+		{"api url", Config{Target: Target{APIURL: "://"}}, []string{"target.apiUrl"}},
+		{
+			name:   "incomplete app",
+			config: Config{Source: Source{Apps: []App{{AppID: 1}}}},
+			errors: []string{"source.apps[0].installationId", "source.apps[0].privateKeyFile"},
+		},
+		{"local storage", Config{Storage: Storage{Stage: "local"}}, []string{"storage.archiveDir"}},
+		{"unknown storage", Config{Storage: Storage{Stage: "gcs"}}, []string{"storage.stage"}},
+		{"workers", Config{Workers: -1, MinWorkers: -1}, []string{"minWorkers", "workers"}},
+		{"durations", Config{JobTimeout: negative, Busy: Busy{Timeout: negative, QuietPeriod: &negative}}, []string{"busy.quietPeriod", "busy.timeout", "jobTimeout"}},
+		{"filter", Config{Filters: Filters{Exclude: []string{"["}}}, []string{"filters.exclude[0]"}},
+		{"steps", Config{Steps: map[string]bool{migration.StepArchiveSource: false, migration.StepVerify: true}}, nil},
+		{"lock", Config{Lock: Lock{Mode: "freeze", Release: "delete"}}, []string{"lock.mode", "lock.release"}},
+		{"rewrite mode", Config{RewriteMode: "push"}, []string{"rewriteMode"}},
+		{
+			name:   "repository mappings",
+			config: Config{Mappings: Mappings{Repositories: map[string]string{"a": "api", "b": "API", "c": ""}}},
+			errors: []string{"mappings.repositories.b", "mappings.repositories.c"},
+		},
+		{
+			name:   "enterprise organizations",
+			config: Config{Enterprise: Enterprise{Organizations: []Organization{{Source: "a:b", Target: "c"}, {Source: "d"}}}},
+			errors: []string{"enterprise.organizations[0].source", "enterprise.organizations[1].target"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+
+			var got []string
+			if err != nil {
+				for _, line := range strings.Split(err.Error(), "\n") {
+					got = append(got, strings.SplitN(line, ":", 2)[0])
+				}
+			}
+			if !slices.Equal(got, tc.errors) {
+				t.Errorf("got errors for %q, want %q: %v", got, tc.errors, err)
+			}
+		})
+	}
+}
+
+// schemaNode is a node of the JSON schema
+type schemaNode map[string]interface{}
+
+func loadSchema(t *testing.T) schemaNode {
+	t.Helper()
+
+	var schema schemaNode
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	return schema
+}
+
+// resolve follows a $ref to the definitions of the schema
+func (n schemaNode) resolve(root schemaNode) schemaNode {
+	ref, ok := n["$ref"].(string)
+	if !ok {
+		return n
+	}
+
+	node := root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		node = schemaNode(node[part].(map[string]interface{}))
+	}
+	return node
+}
+
+func (n schemaNode) properties() map[string]interface{} {
+	properties, _ := n["properties"].(map[string]interface{})
+	return properties
+}
+
+// property returns the named property of n, nil if there is none
+func (n schemaNode) property(root schemaNode, name string) schemaNode {
+	property, _ := n.properties()[name].(map[string]interface{})
+	return schemaNode(property).resolve(root)
+}
+
+func (n schemaNode) enum() []string {
+	values, _ := n["enum"].([]interface{})
+
+	var enum []string
+	for _, value := range values {
+		enum = append(enum, value.(string))
+	}
+	return enum
+}
+
+// compareWithSchema fails if the YAML keys of a struct type and the
+// properties of its schema node differ, and descends into nested objects
+func compareWithSchema(t *testing.T, root, node schemaNode, typ reflect.Type, path string) {
+	t.Helper()
+
+	if node["additionalProperties"] != false {
+		t.Errorf("%s: schema allows unknown keys", path)
+	}
+
+	var keys []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		keys = append(keys, key)
+
+		if _, ok := node.properties()[key]; !ok {
+			continue
+		}
+		child := node.property(root, key)
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Struct {
+			child = schemaNode(child["items"].(map[string]interface{})).resolve(root)
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct && fieldType != reflect.TypeOf(time.Duration(0)) {
+			compareWithSchema(t, root, child, fieldType, strings.TrimPrefix(path+"."+key, "."))
+		}
+	}
+
+	var properties []string
+	for property := range node.properties() {
+		properties = append(properties, property)
+	}
+
+	slices.Sort(keys)
+	slices.Sort(properties)
+	if !slices.Equal(keys, properties) {
+		t.Errorf("%s: Config has keys %q, schema has %q", path, keys, properties)
+	}
+}
+
+func TestSchemaMatchesConfig(t *testing.T) {
+	schema := loadSchema(t)
+
+	compareWithSchema(t, schema, schema, reflect.TypeOf(Config{}), "")
+}
+
+func TestSchemaMatchesSteps(t *testing.T) {
+	schema := loadSchema(t)
+	steps := schema.property(schema, "steps")
+
+	var got []string
+	for step := range steps.properties() {
+		got = append(got, step)
+	}
+	want := append(slices.Clone(migration.Steps), migration.OptInSteps...)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("schema has steps %q, want %q", got, want)
+	}
+
+	for _, step := range migration.OptInSteps {
+		if _, ok := steps.properties()[step]; !ok {
+			continue
+		}
+		if description, _ := steps.property(schema, step)["description"].(string); !strings.HasPrefix(description, "Opt-in:") {
+			t.Errorf("steps.%s: description %q does not mark it as opt-in", step, description)
+		}
+	}
+}
+
+func TestSchemaMatchesEnums(t *testing.T) {
+	schema := loadSchema(t)
+
+	for _, tc := range []struct {
+		path []string
+		want []string
+	}{
+		{[]string{"driftPolicy"}, migration.DriftPolicies},
+		{[]string{"rewriteMode"}, migration.RewriteModes},
+		{[]string{"lock", "mode"}, migration.LockModes},
+		{[]string{"lock", "release"}, migration.LockReleases},
+	} {
+		node := schema
+		for _, name := range tc.path {
+			node = node.property(schema, name)
+		}
+
+		if got := node.enum(); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: schema allows %q, want %q", strings.Join(tc.path, "."), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package github
+
+import (
+	"context"
+
+	"github.com/google/go-github/v59/github"
+)
+
+// OrgActionsValue is an Actions secret or variable of an organization
+type OrgActionsValue struct {
+	Name string
+	// Visibility is all, private or selected
+	Visibility string
+	// SelectedRepositoryIDs are the repositories that can use a value with
+	// selected visibility
+	SelectedRepositoryIDs []int64
+}
+
+// RunnerGroup is a runner group of an organization with the labels of its
+// self-hosted runners
+type RunnerGroup struct {
+	Name string
+	// Visibility is all, private or selected
+	Visibility               string
+	AllowsPublicRepositories bool
+	SelectedRepositoryIDs    []int64
+	// Runners holds the labels of every runner of the group
+	Runners [][]string
+}
+
+// ActionsPolicy is the Actions policy of an organization or repository
+type ActionsPolicy struct {
+	Enabled bool
+	// AllowedActions is all, local_only or selected
+	AllowedActions     string
+	GitHubOwnedAllowed bool
+	VerifiedAllowed    bool
+	PatternsAllowed    []string
+}
+
+// GetOrgSecrets returns the Actions secrets of an organization
+func (gc *GitHubClient) GetOrgSecrets(ctx context.Context, org string) ([]OrgActionsValue, error) {
+	var values []OrgActionsValue
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		secrets, response, err := gc.clientV3.Actions.ListOrgSecrets(ctx, org, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, secret := range secrets.Secrets {
+			value := OrgActionsValue{Name: secret.Name, Visibility: secret.Visibility}
+			if value.Visibility == "selected" {
+				if value.SelectedRepositoryIDs, err = gc.selectedRepositories(ctx, func(opt *github.ListOptions) (*github.SelectedReposList, *github.Response, error) {
+					return gc.clientV3.Actions.ListSelectedReposForOrgSecret(ctx, org, secret.Name, opt)
+				}); err != nil {
+					return nil, err
+				}
+			}
+			values = append(values, value)
+		}
+
+		if response.NextPage == 0 {
+			return values, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+// GetOrgVariables returns the Actions variables of an organization
+func (gc *GitHubClient) GetOrgVariables(ctx context.Context, org string) ([]OrgActionsValue, error) {
+	var values []OrgActionsValue
+	opt := &github.ListOptions{PerPage: 30}
+	for {
+		variables, response, err := gc.clientV3.Actions.ListOrgVariables(ctx, org, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, variable := range variables.Variables {
+			value := OrgActionsValue{Name: variable.Name, Visibility: variable.GetVisibility()}
+			if value.Visibility == "selected" {
+				if value.SelectedRepositoryIDs, err = gc.selectedRepositories(ctx, func(opt *github.ListOptions) (*github.SelectedReposList, *github.Response, error) {
+					return gc.clientV3.Actions.ListSelectedReposForOrgVariable(ctx, org, variable.Name, opt)
+				}); err != nil {
+					return nil, err
+				}
+			}
+			values = append(values, value)
+		}
+
+		if response.NextPage == 0 {
+			return values, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+func (gc *GitHubClient) selectedRepositories(ctx context.Context, list func(opt *github.ListOptions) (*github.SelectedReposList, *github.Response, error)) ([]int64, error) {
+	var ids []int64
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		repositories, response, err := list(opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repository := range repositories.Repositories {
+			ids = append(ids, repository.GetID())
+		}
+
+		if response.NextPage == 0 {
+			return ids, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+// GetRepoSecretNames returns the names of the Actions secrets of a
+// repository
+func (gc *GitHubClient) GetRepoSecretNames(ctx context.Context, org string, repository string) ([]string, error) {
+	return listSecretNames(func(opt *github.ListOptions) (*github.Secrets, *github.Response, error) {
+		return gc.clientV3.Actions.ListRepoSecrets(ctx, org, repository, opt)
+	})
+}
+
+// GetEnvironmentSecretNames returns the names of the secrets of an
+// environment of a repository
+func (gc *GitHubClient) GetEnvironmentSecretNames(ctx context.Context, repositoryID int64, environment string) ([]string, error) {
+	return listSecretNames(func(opt *github.ListOptions) (*github.Secrets, *github.Response, error) {
+		return gc.clientV3.Actions.ListEnvSecrets(ctx, int(repositoryID), environment, opt)
+	})
+}
+
+func listSecretNames(list func(opt *github.ListOptions) (*github.Secrets, *github.Response, error)) ([]string, error) {
+	var names []string
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		secrets, response, err := list(opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, secret := range secrets.Secrets {
+			names = append(names, secret.Name)
+		}
+
+		if response.NextPage == 0 {
+			return names, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+// GetRepoVariableNames returns the names of the Actions variables of a
+// repository
+func (gc *GitHubClient) GetRepoVariableNames(ctx context.Context, org string, repository string) ([]string, error) {
+	return listVariableNames(func(opt *github.ListOptions) (*github.ActionsVariables, *github.Response, error) {
+		return gc.clientV3.Actions.ListRepoVariables(ctx, org, repository, opt)
+	})
+}
+
+// GetEnvironmentVariableNames returns the names of the variables of an
+// environment of a repository
+func (gc *GitHubClient) GetEnvironmentVariableNames(ctx context.Context, repositoryID int64, environment string) ([]string, error) {
+	return listVariableNames(func(opt *github.ListOptions) (*github.ActionsVariables, *github.Response, error) {
+		return gc.clientV3.Actions.ListEnvVariables(ctx, int(repositoryID), environment, opt)
+	})
+}
+
+func listVariableNames(list func(opt *github.ListOptions) (*github.ActionsVariables, *github.Response, error)) ([]string, error) {
+	var names []string
+	opt := &github.ListOptions{PerPage: 30}
+	for {
+		variables, response, err := list(opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, variable := range variables.Variables {
+			names = append(names, variable.Name)
+		}
+
+		if response.NextPage == 0 {
+			return names, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+// GetEnvironmentNames returns the names of the environments of a repository
+func (gc *GitHubClient) GetEnvironmentNames(ctx context.Context, org string, repository string) ([]string, error) {
+	var names []string
+	opt := &github.EnvironmentListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		environments, response, err := gc.clientV3.Repositories.ListEnvironments(ctx, org, repository, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, environment := range environments.Environments {
+			names = append(names, environment.GetName())
+		}
+
+		if response.NextPage == 0 {
+			return names, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+// GetRunnerGroups returns the runner groups of an organization with their
+// self-hosted runners
+func (gc *GitHubClient) GetRunnerGroups(ctx context.Context, org string) ([]RunnerGroup, error) {
+	var groups []RunnerGroup
+	opt := &github.ListOrgRunnerGroupOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runnerGroups, response, err := gc.clientV3.Actions.ListOrganizationRunnerGroups(ctx, org, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, runnerGroup := range runnerGroups.RunnerGroups {
+			group := RunnerGroup{
+				Name:                     runnerGroup.GetName(),
+				Visibility:               runnerGroup.GetVisibility(),
+				AllowsPublicRepositories: runnerGroup.GetAllowsPublicRepositories(),
+			}
+
+			if group.Visibility == "selected" {
+				if group.SelectedRepositoryIDs, err = gc.runnerGroupRepositories(ctx, org, runnerGroup.GetID()); err != nil {
+					return nil, err
+				}
+			}
+
+			if group.Runners, err = listRunnerLabels(func(opt *github.ListOptions) (*github.Runners, *github.Response, error) {
+				return gc.clientV3.Actions.ListRunnerGroupRunners(ctx, org, runnerGroup.GetID(), opt)
+			}); err != nil {
+				return nil, err
+			}
+
+			groups = append(groups, group)
+		}
+
+		if response.NextPage == 0 {
+			return groups, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+func (gc *GitHubClient) runnerGroupRepositories(ctx context.Context, org string, groupID int64) ([]int64, error) {
+	var ids []int64
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		repositories, response, err := gc.clientV3.Actions.ListRepositoryAccessRunnerGroup(ctx, org, groupID, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repository := range repositories.Repositories {
+			ids = append(ids, repository.GetID())
+		}
+
+		if response.NextPage == 0 {
+			return ids, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+// GetRepoRunnerLabels returns the labels of every self-hosted runner of a
+// repository
+func (gc *GitHubClient) GetRepoRunnerLabels(ctx context.Context, org string, repository string) ([][]string, error) {
+	return listRunnerLabels(func(opt *github.ListOptions) (*github.Runners, *github.Response, error) {
+		return gc.clientV3.Actions.ListRunners(ctx, org, repository, opt)
+	})
+}
+
+func listRunnerLabels(list func(opt *github.ListOptions) (*github.Runners, *github.Response, error)) ([][]string, error) {
+	var runners [][]string
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, response, err := list(opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, runner := range page.Runners {
+			labels := make([]string, 0, len(runner.Labels))
+			for _, label := range runner.Labels {
+				labels = append(labels, label.GetName())
+			}
+			runners = append(runners, labels)
+		}
+
+		if response.NextPage == 0 {
+			return runners, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+// GetOrgActionsPolicy returns the Actions policy of an organization
+func (gc *GitHubClient) GetOrgActionsPolicy(ctx context.Context, org string) (ActionsPolicy, error) {
+	permissions, _, err := gc.clientV3.Actions.GetActionsPermissions(ctx, org)
+	if err != nil {
+		return ActionsPolicy{}, err
+	}
+
+	policy := ActionsPolicy{
+		Enabled:        permissions.GetEnabledRepositories() != "none",
+		AllowedActions: permissions.GetAllowedActions(),
+	}
+	if policy.AllowedActions != "selected" {
+		return policy, nil
+	}
+
+	allowed, _, err := gc.clientV3.Actions.GetActionsAllowed(ctx, org)
+	if err != nil {
+		return ActionsPolicy{}, err
+	}
+
+	return withAllowedActions(policy, allowed), nil
+}
+
+// GetRepoActionsPolicy returns the Actions policy of a repository
+func (gc *GitHubClient) GetRepoActionsPolicy(ctx context.Context, org string, repository string) (ActionsPolicy, error) {
+	permissions, _, err := gc.clientV3.Repositories.GetActionsPermissions(ctx, org, repository)
+	if err != nil {
+		return ActionsPolicy{}, err
+	}
+
+	policy := ActionsPolicy{
+		Enabled:        permissions.GetEnabled(),
+		AllowedActions: permissions.GetAllowedActions(),
+	}
+	if policy.AllowedActions != "selected" {
+		return policy, nil
+	}
+
+	allowed, _, err := gc.clientV3.Repositories.GetActionsAllowed(ctx, org, repository)
+	if err != nil {
+		return ActionsPolicy{}, err
+	}
+
+	return withAllowedActions(policy, allowed), nil
+}
+
+func withAllowedActions(policy ActionsPolicy, allowed *github.ActionsAllowed) ActionsPolicy {
+	policy.GitHubOwnedAllowed = allowed.GetGithubOwnedAllowed()
+	policy.VerifiedAllowed = allowed.GetVerifiedAllowed()
+	policy.PatternsAllowed = allowed.PatternsAllowed
+	return policy
+}
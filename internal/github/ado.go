@@ -0,0 +1,235 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+)
+
+const defaultADOURL = "https://dev.azure.com"
+
+// invalidRepositoryNameChars matches the characters GitHub replaces with a
+// dash in repository names
+var invalidRepositoryNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// ADO migrates repositories of an Azure DevOps team project with gh ado2gh
+type ADO struct {
+	organization string
+	project      string
+	token        string
+	baseURL      string
+
+	targetOrg         string
+	targetCredentials *CredentialPool
+	targetAPIURL      string
+
+	httpClient *http.Client
+
+	mu sync.Mutex
+	// sourceNames maps GitHub repository names to Azure DevOps repository
+	// names, which may contain characters that are not valid on GitHub
+	sourceNames map[string]string
+}
+
+// NewADO creates a source for an Azure DevOps team project. baseURL is empty
+// for Azure DevOps Services.
+func NewADO(organization, project, token, baseURL, targetOrg string, targetCredentials *CredentialPool, targetAPIURL string) *ADO {
+	if baseURL == "" {
+		baseURL = defaultADOURL
+	}
+
+	return &ADO{
+		organization:      organization,
+		project:           project,
+		token:             token,
+		baseURL:           strings.TrimSuffix(baseURL, "/"),
+		targetOrg:         targetOrg,
+		targetCredentials: targetCredentials,
+		targetAPIURL:      targetAPIURL,
+		httpClient:        &http.Client{Timeout: 60 * time.Second},
+		sourceNames:       make(map[string]string),
+	}
+}
+
+func (a *ADO) Name() string { return "Azure DevOps" }
+
+func (a *ADO) Extension() string { return "ado2gh" }
+
+type adoRepository struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	DefaultBranch string `json:"defaultBranch"`
+	IsDisabled    bool   `json:"isDisabled"`
+}
+
+// GetRepositories returns the enabled repositories of the team project
+func (a *ADO) GetRepositories(ctx context.Context) ([]Repository, error) {
+	var response struct {
+		Value []adoRepository `json:"value"`
+	}
+
+	if err := a.get(ctx, "_apis/git/repositories", &response); err != nil {
+		return nil, err
+	}
+
+	var repositories []Repository
+	for _, repo := range response.Value {
+		if !repo.IsDisabled {
+			repositories = append(repositories, a.toRepository(repo))
+		}
+	}
+
+	return repositories, nil
+}
+
+// GetRepository returns a repository by its GitHub or Azure DevOps name
+func (a *ADO) GetRepository(ctx context.Context, name string) (Repository, error) {
+	var repo adoRepository
+
+	err := a.get(ctx, "_apis/git/repositories/"+url.PathEscape(a.sourceName(name)), &repo)
+	if err != nil {
+		if StatusCode(err) == http.StatusNotFound {
+			return nil, ErrRepositoryNotFound
+		}
+		return nil, err
+	}
+
+	return a.toRepository(repo), nil
+}
+
+// MigrateRepo migrates a repository as targetRepository and returns the
+// migration ID
+func (a *ADO) MigrateRepo(ctx context.Context, repository, targetRepository string) (string, error) {
+	targetToken, err := a.targetCredentials.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"ado2gh", "migrate-repo", "--ado-org", a.organization, "--ado-team-project", a.project,
+		"--ado-repo", a.sourceName(repository), "--github-org", a.targetOrg, "--github-repo", targetRepository}
+	if a.targetAPIURL != "" {
+		args = append(args, "--target-api-url", strings.TrimSuffix(a.targetAPIURL, "/"))
+	}
+	if a.baseURL != defaultADOURL {
+		args = append(args, "--ado-server-url", a.baseURL)
+	}
+
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	cmd.Env = a.environment("GH_PAT=" + targetToken)
+
+	output, err := cmd.CombinedOutput()
+	migrationID := migrationIDPattern.FindString(string(output))
+	if err != nil {
+		return migrationID, fmt.Errorf("ado2gh migrate-repo failed: %w", err)
+	}
+
+	return migrationID, nil
+}
+
+// DisableRepo disables a repository so that it can no longer be used after
+// the migration
+func (a *ADO) DisableRepo(ctx context.Context, repository string) error {
+	args := []string{"ado2gh", "disable-ado-repo", "--ado-org", a.organization, "--ado-team-project", a.project,
+		"--ado-repo", a.sourceName(repository)}
+	if a.baseURL != defaultADOURL {
+		args = append(args, "--ado-server-url", a.baseURL)
+	}
+
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	cmd.Env = a.environment()
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ado2gh disable-ado-repo failed: %w", err)
+	}
+
+	return nil
+}
+
+// environment returns the environment of the gh ado2gh process. Tokens are
+// passed as ADO_PAT and GH_PAT so they do not show up in process listings.
+func (a *ADO) environment(extra ...string) []string {
+	return append(append(os.Environ(), "ADO_PAT="+a.token), extra...)
+}
+
+func (a *ADO) sourceName(name string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if sourceName, ok := a.sourceNames[name]; ok {
+		return sourceName
+	}
+	return name
+}
+
+func (a *ADO) toRepository(repo adoRepository) Repository {
+	name := invalidRepositoryNameChars.ReplaceAllString(repo.Name, "-")
+
+	a.mu.Lock()
+	a.sourceNames[name] = repo.Name
+	a.mu.Unlock()
+
+	return newExternalRepository(repo.ID, name, strings.TrimPrefix(repo.DefaultBranch, "refs/heads/"))
+}
+
+func (a *ADO) get(ctx context.Context, path string, v interface{}) error {
+	u := fmt.Sprintf("%s/%s/%s/%s?api-version=7.0", a.baseURL, url.PathEscape(a.organization), url.PathEscape(a.project), path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("", a.token)
+
+	return doJSON(a.httpClient, req, v)
+}
+
+// newExternalRepository describes a repository of a source other than GitHub
+// in the form the migration works with. The ID is derived from the ID at the
+// source. Such repositories are never archived and have no GHAS settings.
+func newExternalRepository(sourceID, name, defaultBranch string) Repository {
+	hash := fnv.New64a()
+	hash.Write([]byte(sourceID))
+
+	return &github.Repository{
+		ID:            github.Int64(int64(hash.Sum64() >> 1)),
+		Name:          github.String(name),
+		DefaultBranch: github.String(defaultBranch),
+		Archived:      github.Bool(false),
+		Visibility:    github.String("private"),
+	}
+}
+
+// doJSON sends req and decodes the JSON response into v. Non-2xx responses
+// are returned as *github.ErrorResponse so that StatusCode works on them.
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &github.ErrorResponse{Response: resp, Message: strings.TrimSpace(string(message))}
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,110 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+)
+
+// archiveExportPollInterval is how often the state of an archive export is
+// checked
+const archiveExportPollInterval = 10 * time.Second
+
+// startArchiveExport is the body of an organization migration request. The
+// git data and the metadata of a repository are exported to separate archives
+// as expected by GEI.
+type startArchiveExport struct {
+	Repositories         []string `json:"repositories"`
+	LockRepositories     bool     `json:"lock_repositories"`
+	ExcludeMetadata      bool     `json:"exclude_metadata"`
+	ExcludeGitData       bool     `json:"exclude_git_data"`
+	ExcludeReleases      bool     `json:"exclude_releases"`
+	ExcludeOwnerProjects bool     `json:"exclude_owner_projects"`
+}
+
+// StartArchiveExport starts the export of the git data or, if metadata is
+// true, the metadata of a repository and returns the ID of the export
+func (gc *GitHubClient) StartArchiveExport(ctx context.Context, organization string, repository string, metadata bool) (int64, error) {
+	body := startArchiveExport{
+		Repositories:         []string{repository},
+		ExcludeMetadata:      !metadata,
+		ExcludeGitData:       metadata,
+		ExcludeOwnerProjects: true,
+	}
+
+	req, err := gc.clientV3.NewRequest(http.MethodPost, fmt.Sprintf("orgs/%s/migrations", organization), body)
+	if err != nil {
+		return 0, err
+	}
+	// older GitHub Enterprise Server versions still require the preview header
+	req.Header.Set("Accept", "application/vnd.github.wyandotte-preview+json")
+
+	export := &github.Migration{}
+	if _, err := gc.clientV3.Do(ctx, req, export); err != nil {
+		return 0, err
+	}
+
+	return export.GetID(), nil
+}
+
+// WaitForArchiveExport blocks until an export is finished
+func (gc *GitHubClient) WaitForArchiveExport(ctx context.Context, organization string, id int64) error {
+	for {
+		export, _, err := gc.clientV3.Migrations.MigrationStatus(ctx, organization, id)
+		if err != nil {
+			return err
+		}
+
+		switch export.GetState() {
+		case "exported":
+			return nil
+		case "failed":
+			return fmt.Errorf("archive export %d of %s failed", id, organization)
+		}
+
+		gc.logger.Debug("waiting for archive export", "id", id, "state", export.GetState())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(archiveExportPollInterval):
+		}
+	}
+}
+
+// DownloadArchive writes the archive of a finished export to w
+func (gc *GitHubClient) DownloadArchive(ctx context.Context, organization string, id int64, w io.Writer) error {
+	archiveURL, err := gc.clientV3.Migrations.MigrationArchiveURL(ctx, organization, id)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return err
+	}
+
+	// the archive URL is pre-signed, so the request must not carry the token
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error downloading archive of export %d: %s", id, resp.Status)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// DeleteArchive deletes the archive of an export from the server
+func (gc *GitHubClient) DeleteArchive(ctx context.Context, organization string, id int64) error {
+	_, err := gc.clientV3.Migrations.DeleteMigration(ctx, organization, id)
+	return err
+}
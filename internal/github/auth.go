@@ -0,0 +1,386 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultAPIURL = "https://api.github.com/"
+
+// installationTokenRefreshMargin is how long before expiry an installation
+// token is replaced
+const installationTokenRefreshMargin = 5 * time.Minute
+
+var ErrNoCredentials = errors.New("no credentials configured")
+
+// Credential provides the token for a personal access token or a GitHub App
+// installation
+type Credential interface {
+	// Name identifies the credential in logs; it never contains the token
+	Name() string
+	Token(ctx context.Context) (string, error)
+}
+
+type patCredential struct {
+	name  string
+	token string
+}
+
+func NewPATCredential(name, token string) Credential {
+	return &patCredential{name, token}
+}
+
+func (c *patCredential) Name() string { return c.name }
+
+func (c *patCredential) Token(ctx context.Context) (string, error) { return c.token, nil }
+
+// appCredential authenticates as a GitHub App installation. Installation
+// tokens are requested with a JWT signed by the app private key and refreshed
+// before they expire.
+type appCredential struct {
+	appID, installationID int64
+	key                   *rsa.PrivateKey
+	apiURL                string
+	httpClient            *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewAppCredential creates a credential for a GitHub App installation. apiURL
+// is the API URL of the instance the app is installed on, as accepted by
+// ClientOptions.APIURL.
+func NewAppCredential(appID, installationID int64, privateKeyPEM []byte, apiURL string) (Credential, error) {
+	key, err := parsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key for app %d: %w", appID, err)
+	}
+
+	restURL, _, err := APIURLs(apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appCredential{
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		apiURL:         restURL,
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// ParseAppCredential reads an app credential in the form
+// <app id>:<installation id>:<private key file>
+func ParseAppCredential(spec, apiURL string) (Credential, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid app credential %q, expected <app id>:<installation id>:<private key file>", spec)
+	}
+
+	appID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid app id %q", parts[0])
+	}
+
+	installationID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid installation id %q", parts[1])
+	}
+
+	key, err := os.ReadFile(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAppCredential(appID, installationID, key, apiURL)
+}
+
+func (c *appCredential) Name() string {
+	return fmt.Sprintf("app-%d-%d", c.appID, c.installationID)
+}
+
+func (c *appCredential) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Until(c.expiry) > installationTokenRefreshMargin {
+		return c.token, nil
+	}
+
+	jwt, err := c.jwt(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%sapp/installations/%d/access_tokens", c.apiURL, c.installationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("error creating installation token for %s: %s: %s", c.Name(), resp.Status, body)
+	}
+
+	var installationToken struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&installationToken); err != nil {
+		return "", err
+	}
+
+	slog.Debug("installation token refreshed", "credential", c.Name(), "expiresAt", installationToken.ExpiresAt)
+	c.token = installationToken.Token
+	c.expiry = installationToken.ExpiresAt
+
+	return c.token, nil
+}
+
+// jwt returns the app JWT. It is backdated by a minute to allow for clock
+// drift and is valid for the maximum of 10 minutes.
+func (c *appCredential) jwt(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(c.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+type credentialContextKey struct{}
+
+// CredentialPool spreads requests across several credentials of the same
+// side. A credential whose rate limit is exhausted is skipped until its
+// budget resets.
+type CredentialPool struct {
+	credentials []Credential
+
+	mu             sync.Mutex
+	next           int
+	exhaustedUntil []time.Time
+}
+
+func NewCredentialPool(credentials ...Credential) (*CredentialPool, error) {
+	if len(credentials) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	return &CredentialPool{
+		credentials:    credentials,
+		exhaustedUntil: make([]time.Time, len(credentials)),
+	}, nil
+}
+
+// Len returns the number of credentials in the pool
+func (p *CredentialPool) Len() int {
+	return len(p.credentials)
+}
+
+// Credentials returns the credentials of the pool
+func (p *CredentialPool) Credentials() []Credential {
+	return append([]Credential(nil), p.credentials...)
+}
+
+// Token returns the token of the next available credential
+func (p *CredentialPool) Token(ctx context.Context) (string, error) {
+	_, credential := p.pick(-1)
+	return credential.Token(ctx)
+}
+
+// pick returns the next credential in round robin order that is not
+// exhausted, skipping the credential at index skip. If all credentials are
+// exhausted, the one that resets first is returned.
+func (p *CredentialPool) pick(skip int) (int, Credential) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	soonest := -1
+	for range p.credentials {
+		i := p.next
+		p.next = (p.next + 1) % len(p.credentials)
+
+		if i == skip && len(p.credentials) > 1 {
+			continue
+		}
+
+		if now.After(p.exhaustedUntil[i]) {
+			return i, p.credentials[i]
+		}
+
+		if soonest == -1 || p.exhaustedUntil[i].Before(p.exhaustedUntil[soonest]) {
+			soonest = i
+		}
+	}
+
+	if soonest == -1 {
+		soonest = 0
+	}
+
+	return soonest, p.credentials[soonest]
+}
+
+func (p *CredentialPool) available() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, until := range p.exhaustedUntil {
+		if now.After(until) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CredentialPool) markExhausted(i int, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if until.After(p.exhaustedUntil[i]) {
+		p.exhaustedUntil[i] = until
+		slog.Warn("credential rate limit exhausted, rotating", "credential", p.credentials[i].Name(), "until", until.Format(time.TimeOnly))
+	}
+}
+
+// Transport returns a transport that authenticates every request with a
+// credential of the pool
+func (p *CredentialPool) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &credentialTransport{pool: p, base: base}
+}
+
+type credentialTransport struct {
+	pool *CredentialPool
+	base http.RoundTripper
+}
+
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	i, resp, err := t.roundTrip(req, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// retry once with another credential if this one ran out of budget
+	rewindable := req.Body == nil || req.GetBody != nil
+	if rateLimited(resp) && t.pool.Len() > 1 && t.pool.available() && rewindable {
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp.Body.Close()
+		_, resp, err = t.roundTrip(req, i)
+	}
+
+	return resp, err
+}
+
+func (t *credentialTransport) roundTrip(req *http.Request, skip int) (int, *http.Response, error) {
+	i, credential := t.pool.pick(skip)
+
+	token, err := credential.Token(req.Context())
+	if err != nil {
+		return i, nil, err
+	}
+
+	authenticated := req.Clone(context.WithValue(req.Context(), credentialContextKey{}, credential.Name()))
+	authenticated.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := t.base.RoundTrip(authenticated)
+	if err != nil {
+		return i, nil, err
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			t.pool.markExhausted(i, time.Unix(reset, 0))
+		}
+	} else if rateLimited(resp) {
+		retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil {
+			retryAfter = 60
+		}
+		t.pool.markExhausted(i, time.Now().Add(time.Duration(retryAfter)*time.Second))
+	}
+
+	return i, resp, nil
+}
+
+func rateLimited(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	return resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""
+}
@@ -0,0 +1,276 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	azureAPIVersion = "2021-08-06"
+	// azureContainerName is the container archives are staged in. It is
+	// created on the first upload.
+	azureContainerName = "gei-migration-archives"
+
+	// the well-known account of the Azurite storage emulator
+	azuriteAccountName = "devstoreaccount1"
+	azuriteAccountKey  = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	azuriteBlobURL     = "http://127.0.0.1:10000/devstoreaccount1"
+)
+
+// AzureStorage stages archives in Azure Blob Storage. Requests are
+// authorized with the account key and archives are shared with service SAS
+// URLs.
+type AzureStorage struct {
+	accountName string
+	accountKey  []byte
+	endpoint    *url.URL
+
+	httpClient *http.Client
+
+	// containerMu guards containerCreated. Creating the container is retried
+	// by the next upload if it fails.
+	containerMu      sync.Mutex
+	containerCreated bool
+}
+
+// NewAzureStorage creates a storage from a connection string as shown in the
+// Azure portal. UseDevelopmentStorage=true connects to a local Azurite.
+func NewAzureStorage(connectionString string) (*AzureStorage, error) {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(connectionString, ";") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			settings[strings.ToLower(key)] = value
+		}
+	}
+
+	if settings["usedevelopmentstorage"] == "true" {
+		settings["accountname"] = azuriteAccountName
+		settings["accountkey"] = azuriteAccountKey
+		settings["blobendpoint"] = azuriteBlobURL
+	}
+
+	accountName := settings["accountname"]
+	if accountName == "" || settings["accountkey"] == "" {
+		return nil, errors.New("the Azure storage connection string needs an AccountName and an AccountKey")
+	}
+
+	accountKey, err := base64.StdEncoding.DecodeString(settings["accountkey"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Azure storage account key: %w", err)
+	}
+
+	blobEndpoint := settings["blobendpoint"]
+	if blobEndpoint == "" {
+		protocol := settings["defaultendpointsprotocol"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		suffix := settings["endpointsuffix"]
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+		blobEndpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, accountName, suffix)
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(blobEndpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AzureStorage{
+		accountName: accountName,
+		accountKey:  accountKey,
+		endpoint:    endpoint,
+		httpClient:  &http.Client{},
+	}, nil
+}
+
+func (s *AzureStorage) Name() string { return "azure" }
+
+func (s *AzureStorage) blobURL(name string, query url.Values) *url.URL {
+	u := *s.endpoint
+	u.Path += "/" + azureContainerName
+	if name != "" {
+		u.Path += "/" + name
+	}
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+func (s *AzureStorage) Upload(ctx context.Context, name string, r io.ReaderAt, size int64) error {
+	if err := s.createContainer(ctx); err != nil {
+		return err
+	}
+
+	var blockList bytes.Buffer
+	blockList.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+
+	for offset, number := int64(0), 0; offset < size; offset, number = offset+uploadPartSize, number+1 {
+		blockSize := min(uploadPartSize, size-offset)
+		blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", number)))
+		query := url.Values{"comp": {"block"}, "blockid": {blockID}}
+
+		if err := s.do(ctx, http.MethodPut, name, query, io.NewSectionReader(r, offset, blockSize), blockSize); err != nil {
+			return err
+		}
+
+		blockList.WriteString("<Latest>")
+		xml.EscapeText(&blockList, []byte(blockID))
+		blockList.WriteString("</Latest>")
+	}
+
+	blockList.WriteString("</BlockList>")
+
+	return s.do(ctx, http.MethodPut, name, url.Values{"comp": {"blocklist"}}, bytes.NewReader(blockList.Bytes()), int64(blockList.Len()))
+}
+
+func (s *AzureStorage) createContainer(ctx context.Context) error {
+	s.containerMu.Lock()
+	defer s.containerMu.Unlock()
+
+	if s.containerCreated {
+		return nil
+	}
+
+	// a conflict means the container exists already
+	if err := s.do(ctx, http.MethodPut, "", url.Values{"restype": {"container"}}, nil, 0, http.StatusConflict); err != nil {
+		return err
+	}
+
+	s.containerCreated = true
+	return nil
+}
+
+// URL returns a read-only service SAS URL for the blob
+func (s *AzureStorage) URL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return s.sas(name, time.Now().UTC().Add(expiry)), nil
+}
+
+func (s *AzureStorage) sas(name string, expiry time.Time) string {
+	const sasVersion = "2020-12-06"
+	expiresAt := expiry.UTC().Format(time.RFC3339)
+
+	stringToSign := strings.Join([]string{
+		"r",
+		"",
+		expiresAt,
+		"/blob/" + s.accountName + "/" + azureContainerName + "/" + name,
+		"", // signed identifier
+		"", // signed IP
+		"", // signed protocol
+		sasVersion,
+		"b",
+		"",                 // snapshot time
+		"",                 // encryption scope
+		"", "", "", "", "", // response headers
+	}, "\n")
+
+	query := url.Values{
+		"sv":  {sasVersion},
+		"sp":  {"r"},
+		"sr":  {"b"},
+		"se":  {expiresAt},
+		"sig": {base64.StdEncoding.EncodeToString(hmacSHA256(s.accountKey, stringToSign))},
+	}
+
+	return s.blobURL(name, query).String()
+}
+
+func (s *AzureStorage) Delete(ctx context.Context, name string) error {
+	return s.do(ctx, http.MethodDelete, name, nil, nil, 0, http.StatusNotFound)
+}
+
+// do sends a request authorized with the account key. An empty name
+// addresses the container. Responses with an ignored status are not treated
+// as errors.
+func (s *AzureStorage) do(ctx context.Context, method, name string, query url.Values, body io.Reader, size int64, ignored ...int) error {
+	u := s.blobURL(name, query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+
+	req.Header.Set("Authorization", "SharedKey "+s.accountName+":"+s.sign(req, query))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if (resp.StatusCode < 200 || resp.StatusCode > 299) && !slices.Contains(ignored, resp.StatusCode) {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Azure %s %s: %s: %s", method, u.Path, resp.Status, message)
+	}
+
+	return nil
+}
+
+// sign returns the shared key signature of a request
+func (s *AzureStorage) sign(req *http.Request, query url.Values) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	var msHeaders []string
+	for key := range req.Header {
+		if key := strings.ToLower(key); strings.HasPrefix(key, "x-ms-") {
+			msHeaders = append(msHeaders, key)
+		}
+	}
+	sort.Strings(msHeaders)
+
+	var canonicalized strings.Builder
+	for _, key := range msHeaders {
+		canonicalized.WriteString(key + ":" + strings.TrimSpace(req.Header.Get(key)) + "\n")
+	}
+
+	canonicalized.WriteString("/" + s.accountName + req.URL.EscapedPath())
+
+	var params []string
+	for key := range query {
+		params = append(params, key)
+	}
+	sort.Strings(params)
+	for _, key := range params {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		canonicalized.WriteString("\n" + strings.ToLower(key) + ":" + strings.Join(values, ","))
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalized.String(),
+	}, "\n")
+
+	return base64.StdEncoding.EncodeToString(hmacSHA256(s.accountKey, stringToSign))
+}
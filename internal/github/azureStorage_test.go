@@ -0,0 +1,231 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// azureSignature signs a string with the Azurite account key
+func azureSignature(t *testing.T, stringToSign string) string {
+	t.Helper()
+
+	key, err := base64.StdEncoding.DecodeString(azuriteAccountKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func azuriteStorage(t *testing.T, blobEndpoint string) *AzureStorage {
+	t.Helper()
+
+	connectionString := "UseDevelopmentStorage=true"
+	if blobEndpoint != "" {
+		connectionString = "AccountName=" + azuriteAccountName + ";AccountKey=" + azuriteAccountKey + ";BlobEndpoint=" + blobEndpoint
+	}
+
+	s, err := NewAzureStorage(connectionString)
+	if err != nil {
+		t.Fatalf("NewAzureStorage: %v", err)
+	}
+	return s
+}
+
+// The strings to sign follow the examples of
+// https://learn.microsoft.com/rest/api/storageservices/authorize-with-shared-key
+func TestAzureSharedKeyStringToSign(t *testing.T) {
+	s := azuriteStorage(t, "")
+	s.accountName = "myaccount"
+
+	for _, tc := range []struct {
+		name         string
+		method       string
+		url          string
+		headers      map[string]string
+		length       int64
+		stringToSign string
+	}{
+		{
+			name:   "container metadata",
+			method: http.MethodGet,
+			url:    "https://myaccount.blob.core.windows.net/mycontainer?restype=container&comp=metadata",
+			headers: map[string]string{
+				"x-ms-date":    "Fri, 26 Jun 2015 23:39:12 GMT",
+				"x-ms-version": "2015-02-21",
+			},
+			stringToSign: "GET\n\n\n\n\n\n\n\n\n\n\n\n" +
+				"x-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\nx-ms-version:2015-02-21\n" +
+				"/myaccount/mycontainer\ncomp:metadata\nrestype:container",
+		},
+		{
+			name:   "put blob",
+			method: http.MethodPut,
+			url:    "https://myaccount.blob.core.windows.net/mycontainer/my%20blob.txt?timeout=20",
+			headers: map[string]string{
+				"Content-Type":   "text/plain; charset=UTF-8",
+				"x-ms-blob-type": "BlockBlob",
+				"x-ms-date":      "Fri, 26 Jun 2015 23:39:12 GMT",
+				"x-ms-version":   "2015-02-21",
+			},
+			length: 11,
+			stringToSign: "PUT\n\n\n11\n\ntext/plain; charset=UTF-8\n\n\n\n\n\n\n" +
+				"x-ms-blob-type:BlockBlob\nx-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\nx-ms-version:2015-02-21\n" +
+				"/myaccount/mycontainer/my%20blob.txt\ntimeout:20",
+		},
+		{
+			name:   "block list with a block id",
+			method: http.MethodPut,
+			url:    "https://myaccount.blob.core.windows.net/mycontainer/blob?comp=block&blockid=MDAwMDAwMDA%3D",
+			headers: map[string]string{
+				"x-ms-date":    "Fri, 26 Jun 2015 23:39:12 GMT",
+				"x-ms-version": "2015-02-21",
+			},
+			stringToSign: "PUT\n\n\n\n\n\n\n\n\n\n\n\n" +
+				"x-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\nx-ms-version:2015-02-21\n" +
+				"/myaccount/mycontainer/blob\nblockid:MDAwMDAwMDA=\ncomp:block",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.ContentLength = tc.length
+			for key, value := range tc.headers {
+				req.Header.Set(key, value)
+			}
+
+			if got, want := s.sign(req, req.URL.Query()), azureSignature(t, tc.stringToSign); got != want {
+				t.Errorf("got signature %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// The string to sign follows the service SAS format of version 2020-12-06,
+// https://learn.microsoft.com/rest/api/storageservices/create-service-sas
+func TestAzureServiceSAS(t *testing.T) {
+	s := azuriteStorage(t, "")
+
+	u, err := url.Parse(s.sas("org-repo-git-1.tar.gz", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "/devstoreaccount1/gei-migration-archives/org-repo-git-1.tar.gz"; u.Host != "127.0.0.1:10000" || u.Path != want {
+		t.Errorf("got %s, want a URL of %s at Azurite", u, want)
+	}
+
+	stringToSign := "r\n" +
+		"\n" +
+		"2024-01-02T03:04:05Z\n" +
+		"/blob/devstoreaccount1/gei-migration-archives/org-repo-git-1.tar.gz\n" +
+		"\n\n\n" +
+		"2020-12-06\n" +
+		"b\n" +
+		"\n\n" +
+		"\n\n\n\n"
+
+	query := u.Query()
+	want := url.Values{
+		"sv":  {"2020-12-06"},
+		"sp":  {"r"},
+		"sr":  {"b"},
+		"se":  {"2024-01-02T03:04:05Z"},
+		"sig": {azureSignature(t, stringToSign)},
+	}
+	for key := range want {
+		if query.Get(key) != want.Get(key) {
+			t.Errorf("got %s=%q, want %q", key, query.Get(key), want.Get(key))
+		}
+	}
+	if len(query) != len(want) {
+		t.Errorf("got parameters %v, want %v", query, want)
+	}
+}
+
+func TestAzureRequestsAreAuthorized(t *testing.T) {
+	var authorized atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := azuriteStorage(t, "http://"+r.Host+"/"+azuriteAccountName)
+		want := "SharedKey " + azuriteAccountName + ":" + s.sign(r, r.URL.Query())
+		authorized.Store(r.Header.Get("Authorization") == want && r.Header.Get("x-ms-date") != "")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	s := azuriteStorage(t, server.URL+"/"+azuriteAccountName)
+	if err := s.Delete(context.Background(), "archive.tar.gz"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if !authorized.Load() {
+		t.Error("the request was not signed with the account key")
+	}
+}
+
+func TestAzureContainerCreationIsRetried(t *testing.T) {
+	var containerRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("restype") != "container" {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		switch containerRequests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Error("the container was created again")
+		}
+	}))
+	defer server.Close()
+
+	s := azuriteStorage(t, server.URL+"/"+azuriteAccountName)
+	archive := []byte("archive")
+
+	err := s.Upload(context.Background(), "archive.tar.gz", bytes.NewReader(archive), int64(len(archive)))
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("got %v, want the error of the container request", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.Upload(context.Background(), "archive.tar.gz", bytes.NewReader(archive), int64(len(archive))); err != nil {
+			t.Fatalf("Upload %d: %v", i+2, err)
+		}
+	}
+	if n := containerRequests.Load(); n != 2 {
+		t.Errorf("got %d container requests, want 2", n)
+	}
+}
+
+func TestAzureExistingContainer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("restype") == "container" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	s := azuriteStorage(t, server.URL+"/"+azuriteAccountName)
+	archive := []byte("archive")
+	if err := s.Upload(context.Background(), "archive.tar.gz", bytes.NewReader(archive), int64(len(archive))); err != nil {
+		t.Errorf("Upload: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BBSOptions holds the settings of a Bitbucket Server source
+type BBSOptions struct {
+	ServerURL string
+	Username  string
+	Password  string
+
+	// SSH access to the server is used by bbs2gh to download the export
+	// archives
+	SSHUser       string
+	SSHPrivateKey string
+	SSHPort       int
+}
+
+// BBS migrates repositories of a Bitbucket Server project with gh bbs2gh
+type BBS struct {
+	project string
+	options BBSOptions
+
+	targetOrg         string
+	targetCredentials *CredentialPool
+	// geiOptions holds the target API URL and the storage the archives are
+	// uploaded to
+	geiOptions GEIOptions
+
+	httpClient *http.Client
+}
+
+func NewBBS(project string, options BBSOptions, targetOrg string, targetCredentials *CredentialPool, geiOptions GEIOptions) *BBS {
+	options.ServerURL = strings.TrimSuffix(options.ServerURL, "/")
+
+	return &BBS{
+		project:           project,
+		options:           options,
+		targetOrg:         targetOrg,
+		targetCredentials: targetCredentials,
+		geiOptions:        geiOptions,
+		httpClient:        &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (b *BBS) Name() string { return "Bitbucket Server" }
+
+func (b *BBS) Extension() string { return "bbs2gh" }
+
+type bbsRepository struct {
+	ID       int64  `json:"id"`
+	Slug     string `json:"slug"`
+	Archived bool   `json:"archived"`
+}
+
+// GetRepositories returns the repositories of the project that are not
+// archived
+func (b *BBS) GetRepositories(ctx context.Context) ([]Repository, error) {
+	var repositories []Repository
+
+	for start := 0; ; {
+		var page struct {
+			Values        []bbsRepository `json:"values"`
+			IsLastPage    bool            `json:"isLastPage"`
+			NextPageStart int             `json:"nextPageStart"`
+		}
+
+		path := fmt.Sprintf("repos?start=%d&limit=100", start)
+		if err := b.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+			return nil, err
+		}
+
+		for _, repo := range page.Values {
+			if !repo.Archived {
+				repositories = append(repositories, b.toRepository(repo))
+			}
+		}
+
+		if page.IsLastPage {
+			return repositories, nil
+		}
+		start = page.NextPageStart
+	}
+}
+
+// GetRepository returns a repository by its slug
+func (b *BBS) GetRepository(ctx context.Context, name string) (Repository, error) {
+	var repo bbsRepository
+
+	if err := b.do(ctx, http.MethodGet, "repos/"+url.PathEscape(name), nil, &repo); err != nil {
+		if StatusCode(err) == http.StatusNotFound {
+			return nil, ErrRepositoryNotFound
+		}
+		return nil, err
+	}
+
+	return b.toRepository(repo), nil
+}
+
+// MigrateRepo migrates a repository as targetRepository and returns the
+// migration ID
+func (b *BBS) MigrateRepo(ctx context.Context, repository, targetRepository string) (string, error) {
+	targetToken, err := b.targetCredentials.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"bbs2gh", "migrate-repo", "--bbs-server-url", b.options.ServerURL,
+		"--bbs-project", b.project, "--bbs-repo", repository, "--github-org", b.targetOrg, "--github-repo", targetRepository}
+
+	if b.options.SSHUser != "" {
+		args = append(args, "--ssh-user", b.options.SSHUser, "--ssh-private-key", b.options.SSHPrivateKey)
+		if b.options.SSHPort != 0 {
+			args = append(args, "--ssh-port", strconv.Itoa(b.options.SSHPort))
+		}
+	}
+
+	if b.geiOptions.AWSBucketName != "" {
+		args = append(args, "--aws-bucket-name", b.geiOptions.AWSBucketName)
+		if b.geiOptions.AWSRegion != "" {
+			args = append(args, "--aws-region", b.geiOptions.AWSRegion)
+		}
+	}
+	if b.geiOptions.UseGitHubStorage {
+		args = append(args, "--use-github-storage")
+	}
+	if b.geiOptions.KeepArchive {
+		args = append(args, "--keep-archive")
+	}
+	if b.geiOptions.TargetAPIURL != "" {
+		args = append(args, "--target-api-url", strings.TrimSuffix(b.geiOptions.TargetAPIURL, "/"))
+	}
+
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	// credentials are passed through the environment so they do not show up
+	// in process listings
+	cmd.Env = append(os.Environ(), "BBS_USERNAME="+b.options.Username, "BBS_PASSWORD="+b.options.Password, "GH_PAT="+targetToken)
+	if b.geiOptions.AzureStorageConnectionString != "" {
+		cmd.Env = append(cmd.Env, "AZURE_STORAGE_CONNECTION_STRING="+b.geiOptions.AzureStorageConnectionString)
+	}
+
+	output, err := cmd.CombinedOutput()
+	migrationID := migrationIDPattern.FindString(string(output))
+	if err != nil {
+		return migrationID, fmt.Errorf("bbs2gh migrate-repo failed: %w", err)
+	}
+
+	return migrationID, nil
+}
+
+// DisableRepo archives a repository so that it can no longer be pushed to
+// after the migration. Archiving needs Bitbucket Server 8.0 or later.
+func (b *BBS) DisableRepo(ctx context.Context, repository string) error {
+	return b.do(ctx, http.MethodPut, "repos/"+url.PathEscape(repository), map[string]bool{"archived": true}, nil)
+}
+
+func (b *BBS) toRepository(repo bbsRepository) Repository {
+	return newExternalRepository(strconv.FormatInt(repo.ID, 10), repo.Slug, "")
+}
+
+// do sends a request to the REST API of the project
+func (b *BBS) do(ctx context.Context, method, path string, body interface{}, v interface{}) error {
+	u := fmt.Sprintf("%s/rest/api/1.0/projects/%s/%s", b.options.ServerURL, url.PathEscape(b.project), path)
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, &payload)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(b.options.Username, b.options.Password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return doJSON(b.httpClient, req, v)
+}
@@ -0,0 +1,139 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-github/v59/github"
+)
+
+// GetFileContent returns the content of a file on a branch. ok is false if
+// the file does not exist.
+func (gc *GitHubClient) GetFileContent(ctx context.Context, org string, repository string, path string, branch string) (content string, ok bool, err error) {
+	file, _, _, err := gc.clientV3.Repositories.GetContents(ctx, org, repository, path, &github.RepositoryContentGetOptions{Ref: branch})
+	if StatusCode(err) == 404 {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if file == nil {
+		return "", false, fmt.Errorf("%s is a directory", path)
+	}
+
+	content, err = file.GetContent()
+	return content, err == nil, err
+}
+
+// ListFiles returns the paths of the files in a directory on a branch,
+// without subdirectories. A directory that does not exist has no files.
+func (gc *GitHubClient) ListFiles(ctx context.Context, org string, repository string, path string, branch string) ([]string, error) {
+	_, entries, _, err := gc.clientV3.Repositories.GetContents(ctx, org, repository, path, &github.RepositoryContentGetOptions{Ref: branch})
+	if StatusCode(err) == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.GetType() == "file" {
+			files = append(files, entry.GetPath())
+		}
+	}
+
+	return files, nil
+}
+
+// CommitFiles commits files, by path, in a single commit on top of base. The
+// commit is pushed to branch, which is created or, if it differs from base,
+// reset to the commit.
+func (gc *GitHubClient) CommitFiles(ctx context.Context, org string, repository string, base string, branch string, message string, files map[string]string) error {
+	baseRef, _, err := gc.clientV3.Git.GetRef(ctx, org, repository, "refs/heads/"+base)
+	if err != nil {
+		return err
+	}
+
+	parent, _, err := gc.clientV3.Git.GetCommit(ctx, org, repository, baseRef.GetObject().GetSHA())
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	entries := make([]*github.TreeEntry, 0, len(files))
+	for _, path := range paths {
+		entries = append(entries, &github.TreeEntry{
+			Path:    github.String(path),
+			Mode:    github.String("100644"),
+			Type:    github.String("blob"),
+			Content: github.String(files[path]),
+		})
+	}
+
+	tree, _, err := gc.clientV3.Git.CreateTree(ctx, org, repository, parent.GetTree().GetSHA(), entries)
+	if err != nil {
+		return err
+	}
+
+	commit, _, err := gc.clientV3.Git.CreateCommit(ctx, org, repository, &github.Commit{
+		Message: github.String(message),
+		Tree:    tree,
+		Parents: []*github.Commit{parent},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	ref := &github.Reference{Ref: github.String("refs/heads/" + branch), Object: &github.GitObject{SHA: commit.SHA}}
+	if branch == base {
+		_, _, err = gc.clientV3.Git.UpdateRef(ctx, org, repository, ref, false)
+		return err
+	}
+
+	_, _, err = gc.clientV3.Git.CreateRef(ctx, org, repository, ref)
+	if StatusCode(err) == 422 {
+		// left over from an earlier attempt
+		_, _, err = gc.clientV3.Git.UpdateRef(ctx, org, repository, ref, true)
+	}
+	return err
+}
+
+// CreatePullRequest opens a pull request from head into base and returns its
+// URL. If one is already open for head, its URL is returned.
+func (gc *GitHubClient) CreatePullRequest(ctx context.Context, org string, repository string, head string, base string, title string, body string) (string, error) {
+	pull, _, err := gc.clientV3.PullRequests.Create(ctx, org, repository, &github.NewPullRequest{
+		Title: github.String(title),
+		Head:  github.String(head),
+		Base:  github.String(base),
+		Body:  github.String(body),
+	})
+	if err == nil {
+		return pull.GetHTMLURL(), nil
+	}
+	if StatusCode(err) != 422 {
+		return "", err
+	}
+
+	open, _, listErr := gc.clientV3.PullRequests.List(ctx, org, repository, &github.PullRequestListOptions{Head: org + ":" + head, Base: base})
+	if listErr != nil || len(open) == 0 {
+		return "", err
+	}
+
+	return open[0].GetHTMLURL(), nil
+}
+
+// TeamExists reports whether an organization has a team with the given slug
+func (gc *GitHubClient) TeamExists(ctx context.Context, org string, slug string) (bool, error) {
+	_, _, err := gc.clientV3.Teams.GetTeamBySlug(ctx, org, slug)
+	if StatusCode(err) == 404 {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -1,62 +1,260 @@
 package github
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"os"
 	"os/exec"
+	"regexp"
+	"strings"
 )
 
+// migrationIDPattern matches the repository migration ID printed by gh gei
+var migrationIDPattern = regexp.MustCompile(`RM_[A-Za-z0-9_-]+`)
+
+// versionPattern matches the version printed by gh and its extensions
+var versionPattern = regexp.MustCompile(`\d+\.\d+\.\d+`)
+
+// ToolVersion returns the version of the gh CLI or, if extension is set, of
+// one of its extensions such as gei, ado2gh or bbs2gh
+func ToolVersion(ctx context.Context, extension string) (string, error) {
+	args := []string{"--version"}
+	if extension != "" {
+		args = append([]string{extension}, args...)
+	}
+
+	output, err := exec.CommandContext(ctx, "gh", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("gh %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+
+	version := versionPattern.FindString(string(output))
+	if version == "" {
+		return "", fmt.Errorf("no version in output of gh %s: %s", strings.Join(args, " "), strings.TrimSpace(string(output)))
+	}
+
+	return version, nil
+}
+
+// GEIOptions holds the settings passed to gh gei beyond organizations and
+// tokens
+type GEIOptions struct {
+	// SourceAPIURL is the API URL of a GitHub Enterprise Server source. It is
+	// passed as --ghes-api-url to migrate-repo, which then needs blob storage
+	// for the migration archives.
+	SourceAPIURL string
+	// TargetAPIURL is the API URL of a GitHub Enterprise Cloud target with
+	// data residency
+	TargetAPIURL string
+
+	// Storage for GHES migration archives. Credentials are passed through the
+	// environment so they do not show up in process listings.
+	AzureStorageConnectionString string
+	AWSBucketName                string
+	AWSRegion                    string
+	UseGitHubStorage             bool
+
+	NoSSLVerify bool
+	KeepArchive bool
+}
+
 type GEI struct {
-	sourceOrg, targetOrg     string
-	sourceToken, targetToken string
+	sourceOrg, targetOrg                 string
+	sourceCredentials, targetCredentials *CredentialPool
+	options                              GEIOptions
 }
 
-func NewGEI(source, target, sourceToken, targetToken string) GEI {
-	return GEI{source, target, sourceToken, targetToken}
+func NewGEI(source, target string, sourceCredentials, targetCredentials *CredentialPool, options GEIOptions) GEI {
+	return GEI{source, target, sourceCredentials, targetCredentials, options}
 }
 
-func (gei *GEI) MigrateCodeScanning(repository string) error {
-	cmd := exec.Command("gh", "gei", "migrate-code-scanning-alerts", "--source-repo", repository,
-		"--source-org", gei.sourceOrg, "--target-org", gei.targetOrg, "--github-source-pat", gei.sourceToken,
-		"--github-target-pat", gei.targetToken)
+// WithTargetOrg returns a copy of gei that migrates to another organization
+func (gei GEI) WithTargetOrg(targetOrg string) GEI {
+	gei.targetOrg = targetOrg
+	return gei
+}
 
-	err := cmd.Run()
+// tokens returns a source and a target token for a GEI invocation. Every
+// invocation picks the next credential of each pool and app installation
+// tokens are refreshed if needed.
+func (gei *GEI) tokens(ctx context.Context) (string, string, error) {
+	sourceToken, err := gei.sourceCredentials.Token(ctx)
+	if err != nil {
+		return "", "", err
+	}
 
+	targetToken, err := gei.targetCredentials.Token(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	return sourceToken, targetToken, nil
+}
+
+// isGHESSource reports whether the source is a GitHub Enterprise Server
+func (gei *GEI) isGHESSource() bool {
+	return gei.options.SourceAPIURL != "" && IsEnterpriseServer(gei.options.SourceAPIURL)
+}
+
+// alertArgs returns the GHES and target arguments of the alert migration
+// commands
+func (gei *GEI) alertArgs() []string {
+	var args []string
+
+	if gei.isGHESSource() {
+		args = append(args, "--ghes-api-url", strings.TrimSuffix(gei.options.SourceAPIURL, "/"))
+		if gei.options.NoSSLVerify {
+			args = append(args, "--no-ssl-verify")
+		}
+	}
+
+	if gei.options.TargetAPIURL != "" {
+		args = append(args, "--target-api-url", strings.TrimSuffix(gei.options.TargetAPIURL, "/"))
+	}
+
+	return args
+}
+
+// migrateRepoArgs returns the GHES, storage and target arguments of
+// migrate-repo
+func (gei *GEI) migrateRepoArgs() []string {
+	var args []string
+
+	if gei.isGHESSource() {
+		args = append(args, "--ghes-api-url", strings.TrimSuffix(gei.options.SourceAPIURL, "/"))
+
+		if gei.options.AWSBucketName != "" {
+			args = append(args, "--aws-bucket-name", gei.options.AWSBucketName)
+			if gei.options.AWSRegion != "" {
+				args = append(args, "--aws-region", gei.options.AWSRegion)
+			}
+		}
+
+		if gei.options.UseGitHubStorage {
+			args = append(args, "--use-github-storage")
+		}
+
+		if gei.options.NoSSLVerify {
+			args = append(args, "--no-ssl-verify")
+		}
+
+		if gei.options.KeepArchive {
+			args = append(args, "--keep-archive")
+		}
+	}
+
+	if gei.options.TargetAPIURL != "" {
+		args = append(args, "--target-api-url", strings.TrimSuffix(gei.options.TargetAPIURL, "/"))
+	}
+
+	return args
+}
+
+// environment returns the environment of the gh gei process. Tokens are
+// passed as GH_SOURCE_PAT and GH_PAT so they do not show up in process
+// listings.
+func (gei *GEI) environment(sourceToken, targetToken string) []string {
+	env := append(os.Environ(), "GH_SOURCE_PAT="+sourceToken, "GH_PAT="+targetToken)
+
+	if gei.options.AzureStorageConnectionString != "" {
+		env = append(env, "AZURE_STORAGE_CONNECTION_STRING="+gei.options.AzureStorageConnectionString)
+	}
+
+	return env
+}
+
+func (gei *GEI) MigrateCodeScanning(ctx context.Context, repository, targetRepository string) error {
+	sourceToken, targetToken, err := gei.tokens(ctx)
 	if err != nil {
-		slog.Error("failed to migrate code scanning alerts: ", err)
+		return err
+	}
+
+	args := append([]string{"gei", "migrate-code-scanning-alerts", "--source-repo", repository,
+		"--source-org", gei.sourceOrg, "--target-org", gei.targetOrg, "--target-repo", targetRepository}, gei.alertArgs()...)
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	cmd.Env = gei.environment(sourceToken, targetToken)
+
+	err = cmd.Run()
+
+	if err != nil {
+		slog.Error("failed to migrate code scanning alerts", "error", err)
 		return err
 	}
 
 	return nil
 }
 
-func (gei *GEI) MigrateSecretScanning(repository string) error {
-	cmd := exec.Command(
-		"gh", "gei", "migrate-secret-alerts", "--source-repo",
+func (gei *GEI) MigrateSecretScanning(ctx context.Context, repository, targetRepository string) error {
+	sourceToken, targetToken, err := gei.tokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{
+		"gei", "migrate-secret-alerts", "--source-repo",
 		repository, "--source-org", gei.sourceOrg, "--target-org",
-		gei.targetOrg, "--github-source-pat", gei.sourceToken,
-		"--github-target-pat", gei.targetToken)
+		gei.targetOrg, "--target-repo", targetRepository}, gei.alertArgs()...)
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	cmd.Env = gei.environment(sourceToken, targetToken)
 
-	err := cmd.Run()
+	err = cmd.Run()
 
 	if err != nil {
-		slog.Error("failed to migrate secret scanning remediations: ", err)
+		slog.Error("failed to migrate secret scanning remediations", "error", err)
 		return err
 	}
 
 	return nil
 }
 
-func (gei *GEI) MigrateRepo(repository string) error {
-	cmd := exec.Command("gh", "gei", "migrate-repo", "--source-repo",
+// MigrateRepo migrates a repository as targetRepository and returns the GEI
+// migration ID, if GEI reported one.
+func (gei *GEI) MigrateRepo(ctx context.Context, repository, targetRepository string) (string, error) {
+	return gei.migrateRepo(ctx, repository, targetRepository, gei.migrateRepoArgs())
+}
+
+// MigrateRepoFromArchives migrates a repository from archives that were
+// already staged, e.g. by ArchiveStaging, instead of letting GEI generate and
+// upload them.
+func (gei *GEI) MigrateRepoFromArchives(ctx context.Context, repository, targetRepository string, archives StagedArchives) (string, error) {
+	var args []string
+
+	if gei.isGHESSource() {
+		args = append(args, "--ghes-api-url", strings.TrimSuffix(gei.options.SourceAPIURL, "/"))
+		if gei.options.NoSSLVerify {
+			args = append(args, "--no-ssl-verify")
+		}
+	}
+
+	if gei.options.TargetAPIURL != "" {
+		args = append(args, "--target-api-url", strings.TrimSuffix(gei.options.TargetAPIURL, "/"))
+	}
+
+	args = append(args, "--git-archive-url", archives.GitArchiveURL, "--metadata-archive-url", archives.MetadataArchiveURL)
+
+	return gei.migrateRepo(ctx, repository, targetRepository, args)
+}
+
+func (gei *GEI) migrateRepo(ctx context.Context, repository, targetRepository string, extraArgs []string) (string, error) {
+	sourceToken, targetToken, err := gei.tokens(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	args := append([]string{"gei", "migrate-repo", "--source-repo",
 		repository, "--github-source-org", gei.sourceOrg, "--github-target-org", gei.targetOrg,
-		"--github-source-pat", gei.sourceToken, "--github-target-pat", gei.targetToken)
+		"--target-repo", targetRepository}, extraArgs...)
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	cmd.Env = gei.environment(sourceToken, targetToken)
 
-	err := cmd.Run()
+	output, err := cmd.CombinedOutput()
+	migrationID := migrationIDPattern.FindString(string(output))
 
 	if err != nil {
-		slog.Error("failed to migrate repository: ", err)
-		return err
+		slog.Error("failed to migrate repository", "error", err, "migrationId", migrationID)
+		return migrationID, err
 	}
 
-	return nil
+	return migrationID, nil
 }
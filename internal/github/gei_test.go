@@ -0,0 +1,53 @@
+package github
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGEIArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		options     GEIOptions
+		alerts      []string
+		migrateRepo []string
+	}{
+		{
+			name:        "github.com",
+			options:     GEIOptions{},
+			alerts:      nil,
+			migrateRepo: nil,
+		},
+		{
+			name: "GHES source",
+			options: GEIOptions{SourceAPIURL: "https://ghes.example.com/api/v3/", AWSBucketName: "archives",
+				AWSRegion: "eu-west-1", NoSSLVerify: true, KeepArchive: true},
+			alerts: []string{"--ghes-api-url", "https://ghes.example.com/api/v3", "--no-ssl-verify"},
+			migrateRepo: []string{"--ghes-api-url", "https://ghes.example.com/api/v3", "--aws-bucket-name", "archives",
+				"--aws-region", "eu-west-1", "--no-ssl-verify", "--keep-archive"},
+		},
+		{
+			name:        "data residency target",
+			options:     GEIOptions{TargetAPIURL: "https://api.example.ghe.com/", NoSSLVerify: true},
+			alerts:      []string{"--target-api-url", "https://api.example.ghe.com"},
+			migrateRepo: []string{"--target-api-url", "https://api.example.ghe.com"},
+		},
+		{
+			name:        "data residency source",
+			options:     GEIOptions{SourceAPIURL: "https://api.example.ghe.com"},
+			alerts:      nil,
+			migrateRepo: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gei := NewGEI("source", "target", nil, nil, tc.options)
+
+			if got := gei.alertArgs(); !slices.Equal(got, tc.alerts) {
+				t.Errorf("got alert arguments %q, want %q", got, tc.alerts)
+			}
+			if got := gei.migrateRepoArgs(); !slices.Equal(got, tc.migrateRepo) {
+				t.Errorf("got migrate-repo arguments %q, want %q", got, tc.migrateRepo)
+			}
+		})
+	}
+}
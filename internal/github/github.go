@@ -5,12 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gofri/go-github-ratelimit/github_ratelimit"
 	"github.com/google/go-github/v59/github"
 	"github.com/shurcooL/githubv4"
-	"golang.org/x/oauth2"
 )
 
 type Repository *github.Repository
@@ -35,6 +37,8 @@ type GitHubClient struct {
 	clientV3 *github.Client
 	clientV4 *githubv4.Client
 	logger   *slog.Logger
+	// credentials are the credentials requests are spread across
+	credentials *CredentialPool
 }
 
 var (
@@ -43,21 +47,250 @@ var (
 	ErrIssueNotFound            = errors.New("issue not found")
 )
 
-func NewGitHubClient(ctx context.Context, logger *slog.Logger, token string) (*GitHubClient, error) {
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	rateLimiter, err := github_ratelimit.NewRateLimitWaiterClient(tc.Transport)
+// StatusCode returns the HTTP status code carried by a GitHub API error or 0
+// if err did not come from an API response.
+func StatusCode(err error) int {
+	if errors.Is(err, ErrRepositoryNotFound) || errors.Is(err, ErrIssueNotFound) {
+		return 404
+	}
+
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return 429
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return 429
+	}
+
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		return errResp.Response.StatusCode
+	}
+
+	return 0
+}
+
+// ClientOptions configures a GitHubClient
+type ClientOptions struct {
+	// Name labels the client in rate limit budgets, e.g. "source" or "target"
+	Name string
+	// RateLimits, if set, records the rate limit budget of every response
+	RateLimits *RateLimitMonitor
+	// APIURL is the REST API URL of a GitHub Enterprise Server instance
+	// (https://ghes.example.com/api/v3) or of GitHub Enterprise Cloud with data
+	// residency (https://api.example.ghe.com). Empty means api.github.com.
+	APIURL string
+}
+
+// APIURLs returns the REST and GraphQL endpoints for an API URL as accepted
+// by ClientOptions.APIURL
+func APIURLs(apiURL string) (string, string, error) {
+	if apiURL == "" {
+		return defaultAPIURL, defaultAPIURL + "graphql", nil
+	}
+
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid API URL %q, expected an absolute URL", apiURL)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/"
+
+	// api.<subdomain>.ghe.com serves the API at the root, GHES under /api/v3
+	if !strings.HasPrefix(u.Host, "api.") && !strings.HasSuffix(u.Path, "/api/v3/") {
+		u.Path += "api/v3/"
+	}
+
+	rest := u.String()
+
+	if strings.HasSuffix(u.Path, "/api/v3/") {
+		u.Path = strings.TrimSuffix(u.Path, "v3/") + "graphql"
+	} else {
+		u.Path += "graphql"
+	}
+
+	return rest, u.String(), nil
+}
+
+// IsEnterpriseServer reports whether an API URL points to a GitHub
+// Enterprise Server instance
+func IsEnterpriseServer(apiURL string) bool {
+	rest, _, err := APIURLs(apiURL)
+	return err == nil && strings.HasSuffix(rest, "/api/v3/")
+}
+
+func NewGitHubClient(ctx context.Context, logger *slog.Logger, credentials *CredentialPool, options ClientOptions) (*GitHubClient, error) {
+	if credentials == nil {
+		return nil, ErrNoCredentials
+	}
+
+	transport := credentials.Transport(http.DefaultTransport)
+	if options.RateLimits != nil {
+		transport = options.RateLimits.Transport(options.Name, transport)
+	}
+
+	rateLimiter, err := github_ratelimit.NewRateLimitWaiterClient(transport)
+
+	if err != nil {
+		return nil, err
+	}
 
+	restURL, graphQLURL, err := APIURLs(options.APIURL)
 	if err != nil {
 		return nil, err
 	}
 
+	clientV3 := github.NewClient(rateLimiter)
+	if options.APIURL != "" {
+		clientV3, err = clientV3.WithEnterpriseURLs(restURL, restURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &GitHubClient{
-		clientV3: github.NewClient(rateLimiter),
-		clientV4: githubv4.NewClient(rateLimiter),
-		logger:   logger}, nil
+		clientV3:    clientV3,
+		clientV4:    githubv4.NewEnterpriseClient(graphQLURL, rateLimiter),
+		logger:      logger,
+		credentials: credentials}, nil
+}
+
+// Credentials returns the credentials of the client. Consecutive requests
+// are sent with the credentials in turn.
+func (gc *GitHubClient) Credentials() []Credential {
+	return gc.credentials.Credentials()
+}
+
+// ServerVersion returns the version of a GitHub Enterprise Server instance,
+// or an empty string for GitHub.com and GitHub Enterprise Cloud
+func (gc *GitHubClient) ServerVersion(ctx context.Context) (string, error) {
+	_, response, err := gc.clientV3.Meta.Get(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return response.Header.Get("X-GitHub-Enterprise-Version"), nil
+}
+
+// TokenScopes returns the OAuth scopes of a credential of the client. The
+// request is sent with that credential instead of the next one in turn. ok is
+// false for credentials without scopes, such as fine-grained tokens and
+// GitHub App installations.
+func (gc *GitHubClient) TokenScopes(ctx context.Context, credential Credential) (scopes []string, ok bool, err error) {
+	pool, err := NewCredentialPool(credential)
+	if err != nil {
+		return nil, false, err
+	}
+
+	client := github.NewClient(&http.Client{Transport: pool.Transport(http.DefaultTransport)})
+	baseURL := *gc.clientV3.BaseURL
+	client.BaseURL = &baseURL
+
+	_, response, err := client.Meta.Get(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	header := response.Header.Values("X-OAuth-Scopes")
+	if len(header) == 0 {
+		return nil, false, nil
+	}
+
+	for _, value := range header {
+		for _, scope := range strings.Split(value, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	return scopes, true, nil
+}
+
+// OrganizationExists reports whether an organization exists and is visible
+// to the credentials
+func (gc *GitHubClient) OrganizationExists(ctx context.Context, org string) (bool, error) {
+	_, _, err := gc.clientV3.Organizations.Get(ctx, org)
+	if StatusCode(err) == 404 {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// OrganizationRole returns the role of the authenticated user in an
+// organization, "admin" for owners or "member"
+func (gc *GitHubClient) OrganizationRole(ctx context.Context, org string) (string, error) {
+	membership, _, err := gc.clientV3.Organizations.GetOrgMembership(ctx, "", org)
+	if err != nil {
+		return "", err
+	}
+
+	return membership.GetRole(), nil
+}
+
+// AdvancedSecurityBilling is the GitHub Advanced Security license usage of
+// an organization
+type AdvancedSecurityBilling struct {
+	// TotalCommitters is the number of unique active committers that use a
+	// license
+	TotalCommitters int
+	// PurchasedCommitters is the number of purchased licenses, nil if it is
+	// not reported
+	PurchasedCommitters *int
+	// Committers holds the logins of the active committers by repository name
+	Committers map[string][]string
+}
+
+// GetAdvancedSecurityBilling returns the GHAS license usage of an
+// organization. The request fails for organizations without GHAS licensing.
+func (gc *GitHubClient) GetAdvancedSecurityBilling(ctx context.Context, org string) (AdvancedSecurityBilling, error) {
+	// go-github does not decode the purchased committers
+	var page struct {
+		TotalAdvancedSecurityCommitters     int  `json:"total_advanced_security_committers"`
+		PurchasedAdvancedSecurityCommitters *int `json:"purchased_advanced_security_committers"`
+		Repositories                        []struct {
+			Name      string `json:"name"`
+			Breakdown []struct {
+				UserLogin string `json:"user_login"`
+			} `json:"advanced_security_committers_breakdown"`
+		} `json:"repositories"`
+	}
+
+	billing := AdvancedSecurityBilling{Committers: make(map[string][]string)}
+	for number := 1; ; {
+		req, err := gc.clientV3.NewRequest("GET", fmt.Sprintf("orgs/%s/settings/billing/advanced-security?per_page=100&page=%d", org, number), nil)
+		if err != nil {
+			return AdvancedSecurityBilling{}, err
+		}
+
+		page.Repositories = nil
+		response, err := gc.clientV3.Do(ctx, req, &page)
+		if err != nil {
+			return AdvancedSecurityBilling{}, err
+		}
+
+		billing.TotalCommitters = page.TotalAdvancedSecurityCommitters
+		billing.PurchasedCommitters = page.PurchasedAdvancedSecurityCommitters
+		for _, repository := range page.Repositories {
+			// repositories are listed as org/name
+			name := repository.Name[strings.LastIndex(repository.Name, "/")+1:]
+			for _, committer := range repository.Breakdown {
+				billing.Committers[name] = append(billing.Committers[name], committer.UserLogin)
+			}
+		}
+
+		if response.NextPage == 0 {
+			return billing, nil
+		}
+		number = response.NextPage
+	}
 }
 
 func (gc *GitHubClient) DeleteBranchProtections(ctx context.Context, organization string, repository string) error {
@@ -129,7 +362,7 @@ func (gc *GitHubClient) ChangeGHASOrgSettings(ctx context.Context, organization
 func (gc *GitHubClient) ChangeGhasRepoSettings(ctx context.Context, organization string, repository Repository, ghas string, secretScanning string, pushProtection string) error {
 	var payload *github.SecurityAndAnalysis
 	//GHAS is always enabled for public repositories and PATCH fails when trying to set to disabled
-	if *repository.Visibility == "public" {
+	if repository.Visibility != nil && *repository.Visibility == "public" {
 		payload = &github.SecurityAndAnalysis{
 			SecretScanning: &github.SecretScanning{
 				Status: &secretScanning,
@@ -213,6 +446,48 @@ func (gc *GitHubClient) GetRepositories(ctx context.Context, org string) ([]Repo
 	return allReposStruct, nil
 }
 
+// GetEnterpriseOrganizations returns the logins of the organizations of an
+// enterprise
+func (gc *GitHubClient) GetEnterpriseOrganizations(ctx context.Context, enterprise string) ([]string, error) {
+	var query struct {
+		Enterprise *struct {
+			Organizations struct {
+				Nodes []struct {
+					Login string
+				}
+				PageInfo struct {
+					EndCursor   githubv4.String
+					HasNextPage bool
+				}
+			} `graphql:"organizations(first: 100, after: $cursor)"`
+		} `graphql:"enterprise(slug: $slug)"`
+	}
+
+	variables := map[string]interface{}{
+		"slug":   githubv4.String(enterprise),
+		"cursor": (*githubv4.String)(nil),
+	}
+
+	var organizations []string
+	for {
+		if err := gc.clientV4.Query(ctx, &query, variables); err != nil {
+			return nil, err
+		}
+		if query.Enterprise == nil {
+			return nil, fmt.Errorf("enterprise %s not found", enterprise)
+		}
+
+		for _, organization := range query.Enterprise.Organizations.Nodes {
+			organizations = append(organizations, organization.Login)
+		}
+
+		if !query.Enterprise.Organizations.PageInfo.HasNextPage {
+			return organizations, nil
+		}
+		variables["cursor"] = githubv4.NewString(query.Enterprise.Organizations.PageInfo.EndCursor)
+	}
+}
+
 func (gc *GitHubClient) ChangeRepositoryVisibility(ctx context.Context, organization string, repository string, visibility string) error {
 	//create new repository object
 	newRepoSettings := github.Repository{
@@ -262,6 +537,22 @@ func (gc *GitHubClient) GetAllActiveWorkflowsForRepository(
 	return activeWorkflowsStruct, nil
 }
 
+// CountPendingWorkflowRuns returns the number of workflow runs of a
+// repository that are queued, waiting for approval or in progress
+func (gc *GitHubClient) CountPendingWorkflowRuns(ctx context.Context, organization string, repository string) (int, error) {
+	var pending int
+	for _, status := range []string{"queued", "waiting", "in_progress"} {
+		runs, _, err := gc.clientV3.Actions.ListRepositoryWorkflowRuns(ctx, organization, repository,
+			&github.ListWorkflowRunsOptions{Status: status, ListOptions: github.ListOptions{PerPage: 1}})
+		if err != nil {
+			return 0, err
+		}
+		pending += runs.GetTotalCount()
+	}
+
+	return pending, nil
+}
+
 func (gc *GitHubClient) GetAllWorkflowsForRepository(ctx context.Context, organization string, repository string) ([]Workflow, error) {
 	// list all workflows for the repository
 	opt := &github.ListOptions{PerPage: 10}
@@ -395,6 +686,12 @@ func (gc *GitHubClient) CreateRepository(ctx context.Context, organization strin
 	return err
 }
 
+// DeleteRepository deletes a repository, which needs the delete_repo scope
+func (gc *GitHubClient) DeleteRepository(ctx context.Context, organization string, repository string) error {
+	_, err := gc.clientV3.Repositories.Delete(ctx, organization, repository)
+	return err
+}
+
 func (gc *GitHubClient) CreateIssue(ctx context.Context, organization string, repository string, title string, body string) error {
 	newIssue := &github.IssueRequest{
 		Title: &title,
@@ -0,0 +1,60 @@
+package github
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestTokenScopesUsesTheGivenCredential(t *testing.T) {
+	scopes := map[string]string{
+		"Bearer classic": "repo, admin:org",
+		"Bearer limited": "repo",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/meta" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		if value, ok := scopes[r.Header.Get("Authorization")]; ok {
+			w.Header().Set("X-OAuth-Scopes", value)
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	pool, err := NewCredentialPool(
+		NewPATCredential("source-pat-1", "classic"),
+		NewPATCredential("source-pat-2", "limited"),
+		NewPATCredential("source-pat-3", "fine-grained"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gc, err := NewGitHubClient(context.Background(), slog.Default(), pool, ClientOptions{APIURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentials := gc.Credentials()
+	if len(credentials) != 3 {
+		t.Fatalf("got %d credentials, want 3", len(credentials))
+	}
+
+	want := map[string][]string{
+		"source-pat-1": {"repo", "admin:org"},
+		"source-pat-2": {"repo"},
+		"source-pat-3": nil,
+	}
+	// the same credential twice in a row, which round robin would not use
+	for _, credential := range append(credentials, credentials[0]) {
+		got, ok, err := gc.TokenScopes(context.Background(), credential)
+		if err != nil {
+			t.Fatalf("%s: %v", credential.Name(), err)
+		}
+		if ok != (want[credential.Name()] != nil) || !slices.Equal(got, want[credential.Name()]) {
+			t.Errorf("%s: got scopes %v (ok %t), want %v", credential.Name(), got, ok, want[credential.Name()])
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package github
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/shurcooL/githubv4"
+)
+
+// RepositoryCounts holds the numbers of the settings and objects of a
+// repository that a migration touches or leaves behind
+type RepositoryCounts struct {
+	BranchProtectionRules int
+	Environments          int
+	OpenPullRequests      int
+	// LFS is true if .gitattributes of the default branch uses the lfs filter
+	LFS           bool
+	Webhooks      int
+	Secrets       int
+	Collaborators int
+	Teams         int
+}
+
+// GetRepositoryCounts returns the counts of a repository. Counts that cannot
+// be read, e.g. secrets and webhooks without admin access, are left at zero
+// and their errors are returned by name.
+func (gc *GitHubClient) GetRepositoryCounts(ctx context.Context, organization string, repository string) (RepositoryCounts, map[string]error) {
+	var counts RepositoryCounts
+	errs := make(map[string]error)
+
+	var query struct {
+		Repository struct {
+			BranchProtectionRules struct{ TotalCount int }
+			Environments          struct{ TotalCount int }
+			PullRequests          struct{ TotalCount int } `graphql:"pullRequests(states: OPEN)"`
+			GitAttributes         *struct {
+				Blob struct {
+					Text string
+				} `graphql:"... on Blob"`
+			} `graphql:"gitAttributes: object(expression: \"HEAD:.gitattributes\")"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner": githubv4.String(organization),
+		"name":  githubv4.String(repository),
+	}
+
+	if err := gc.clientV4.Query(ctx, &query, variables); err != nil {
+		errs["repository"] = err
+	} else {
+		counts.BranchProtectionRules = query.Repository.BranchProtectionRules.TotalCount
+		counts.Environments = query.Repository.Environments.TotalCount
+		counts.OpenPullRequests = query.Repository.PullRequests.TotalCount
+		counts.LFS = query.Repository.GitAttributes != nil && strings.Contains(query.Repository.GitAttributes.Blob.Text, "filter=lfs")
+	}
+
+	var err error
+	if counts.Webhooks, err = countAll(func(opt github.ListOptions) (int, *github.Response, error) {
+		hooks, response, err := gc.clientV3.Repositories.ListHooks(ctx, organization, repository, &opt)
+		return len(hooks), response, err
+	}); err != nil {
+		errs["webhooks"] = err
+	}
+
+	secrets, _, err := gc.clientV3.Actions.ListRepoSecrets(ctx, organization, repository, &github.ListOptions{PerPage: 1})
+	if err != nil {
+		errs["secrets"] = err
+	} else {
+		counts.Secrets = secrets.TotalCount
+	}
+
+	if counts.Collaborators, err = countAll(func(opt github.ListOptions) (int, *github.Response, error) {
+		collaborators, response, err := gc.clientV3.Repositories.ListCollaborators(ctx, organization, repository,
+			&github.ListCollaboratorsOptions{Affiliation: "direct", ListOptions: opt})
+		return len(collaborators), response, err
+	}); err != nil {
+		errs["collaborators"] = err
+	}
+
+	if counts.Teams, err = countAll(func(opt github.ListOptions) (int, *github.Response, error) {
+		teams, response, err := gc.clientV3.Repositories.ListTeams(ctx, organization, repository, &opt)
+		return len(teams), response, err
+	}); err != nil {
+		errs["teams"] = err
+	}
+
+	return counts, errs
+}
+
+// countAll counts the items of all pages of a list endpoint
+func countAll(list func(opt github.ListOptions) (int, *github.Response, error)) (int, error) {
+	opt := github.ListOptions{PerPage: 100}
+	total := 0
+	for {
+		n, response, err := list(opt)
+		if err != nil {
+			return 0, err
+		}
+
+		total += n
+		if response.NextPage == 0 {
+			return total, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
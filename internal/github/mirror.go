@@ -0,0 +1,111 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GitHost is the git endpoint repositories of a GitHub instance are cloned
+// from
+type GitHost struct {
+	// BaseURL is the URL organizations are found under, e.g.
+	// https://github.com or, for local copies, file:///srv/git
+	BaseURL string
+	// Credentials, if set, authenticate HTTPS requests
+	Credentials *CredentialPool
+}
+
+// NewGitHost returns the git endpoint of the instance of an API URL as
+// accepted by ClientOptions.APIURL
+func NewGitHost(apiURL string, credentials *CredentialPool) (GitHost, error) {
+	rest, _, err := APIURLs(apiURL)
+	if err != nil {
+		return GitHost{}, err
+	}
+
+	u, err := url.Parse(rest)
+	if err != nil {
+		return GitHost{}, err
+	}
+
+	// GHES serves git next to /api/v3, GHE.com and github.com on the host
+	// without the api. prefix
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/api/v3")
+	u.Host = strings.TrimPrefix(u.Host, "api.")
+
+	return GitHost{BaseURL: strings.TrimSuffix(u.String(), "/"), Credentials: credentials}, nil
+}
+
+// NewGitHostAt returns a git endpoint with an explicit base URL, for
+// instances that serve git elsewhere than next to their API or for local
+// copies under a file:// URL
+func NewGitHostAt(baseURL string, credentials *CredentialPool) (GitHost, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return GitHost{}, fmt.Errorf("invalid git URL %q: %w", baseURL, err)
+	}
+
+	switch {
+	case u.Scheme == "file" && u.Path != "":
+	case (u.Scheme == "https" || u.Scheme == "http") && u.Host != "":
+	default:
+		return GitHost{}, fmt.Errorf("invalid git URL %q: expected an http(s):// URL with a host or a file:// URL with a path", baseURL)
+	}
+
+	return GitHost{BaseURL: strings.TrimSuffix(baseURL, "/"), Credentials: credentials}, nil
+}
+
+// RepositoryURL returns the clone URL of a repository
+func (h GitHost) RepositoryURL(organization, repository string) string {
+	return h.BaseURL + "/" + organization + "/" + repository + ".git"
+}
+
+// HTMLURL returns the web URL of a repository
+func (h GitHost) HTMLURL(organization, repository string) string {
+	return h.BaseURL + "/" + organization + "/" + repository
+}
+
+// MirrorRefs clones a repository as a bare mirror into dir, which must not
+// exist, and returns the object IDs of all its refs by full ref name
+func (h GitHost) MirrorRefs(ctx context.Context, organization, repository, dir string) (map[string]string, error) {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if h.Credentials != nil && !strings.HasPrefix(h.BaseURL, "file:") {
+		token, err := h.Credentials.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// passed through the environment so it does not show up in process
+		// listings
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		env = append(env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Basic "+auth)
+	}
+
+	clone := exec.CommandContext(ctx, "git", "clone", "--mirror", "--quiet", h.RepositoryURL(organization, repository), dir)
+	clone.Env = env
+	if output, err := clone.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("git clone --mirror %s/%s: %w: %s", organization, repository, err, strings.TrimSpace(string(output)))
+	}
+
+	output, err := exec.CommandContext(ctx, "git", "-C", dir, "for-each-ref", "--format=%(objectname) %(refname)").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref %s/%s: %w", organization, repository, err)
+	}
+
+	refs := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if sha, ref, ok := strings.Cut(scanner.Text(), " "); ok {
+			refs[ref] = sha
+		}
+	}
+
+	return refs, scanner.Err()
+}
@@ -0,0 +1,135 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/shurcooL/githubv4"
+)
+
+// EditRepositoryDetails changes the description and homepage of a
+// repository. Empty values are left unchanged.
+func (gc *GitHubClient) EditRepositoryDetails(ctx context.Context, organization string, repository string, description string, homepage string) error {
+	edit := &github.Repository{}
+	if description != "" {
+		edit.Description = &description
+	}
+	if homepage != "" {
+		edit.Homepage = &homepage
+	}
+
+	_, _, err := gc.clientV3.Repositories.Edit(ctx, organization, repository, edit)
+	return err
+}
+
+// AddTopic adds a topic to a repository, keeping its other topics
+func (gc *GitHubClient) AddTopic(ctx context.Context, organization string, repository string, topic string) error {
+	topics, _, err := gc.clientV3.Repositories.ListAllTopics(ctx, organization, repository)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(topics, topic) {
+		return nil
+	}
+
+	_, _, err = gc.clientV3.Repositories.ReplaceAllTopics(ctx, organization, repository, append(topics, topic))
+	return err
+}
+
+// AddReadmeBanner commits banner to the top of the README of a branch,
+// creating README.md if there is none. A README that already starts with the
+// banner is left unchanged.
+func (gc *GitHubClient) AddReadmeBanner(ctx context.Context, organization string, repository string, branch string, banner string, message string) error {
+	options := &github.RepositoryContentFileOptions{Message: &message, Branch: &branch}
+
+	readme, _, err := gc.clientV3.Repositories.GetReadme(ctx, organization, repository, &github.RepositoryContentGetOptions{Ref: branch})
+	if StatusCode(err) == 404 {
+		options.Content = []byte(banner + "\n")
+		_, _, err = gc.clientV3.Repositories.CreateFile(ctx, organization, repository, "README.md", options)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	content, err := readme.GetContent()
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(content, banner) {
+		return nil
+	}
+
+	options.Content = []byte(banner + "\n\n" + content)
+	options.SHA = readme.SHA
+	_, _, err = gc.clientV3.Repositories.UpdateFile(ctx, organization, repository, readme.GetPath(), options)
+	return err
+}
+
+// CreateNoticeIssue opens an issue and, if pin is set, pins it to the
+// repository
+func (gc *GitHubClient) CreateNoticeIssue(ctx context.Context, organization string, repository string, title string, body string, pin bool) error {
+	issue, _, err := gc.clientV3.Issues.Create(ctx, organization, repository, &github.IssueRequest{Title: &title, Body: &body})
+	if err != nil || !pin {
+		return err
+	}
+
+	var mutate struct {
+		PinIssue struct {
+			ClientMutationId githubv4.ID
+		} `graphql:"pinIssue(input: $input)"`
+	}
+
+	return gc.clientV4.Mutate(ctx, &mutate, githubv4.PinIssueInput{IssueID: githubv4.ID(issue.GetNodeID())}, nil)
+}
+
+// CreateDiscussion opens a discussion in the category with the given name
+func (gc *GitHubClient) CreateDiscussion(ctx context.Context, organization string, repository string, category string, title string, body string) error {
+	var query struct {
+		Repository struct {
+			ID                   githubv4.ID
+			DiscussionCategories struct {
+				Nodes []struct {
+					ID   githubv4.ID
+					Name string
+				}
+			} `graphql:"discussionCategories(first: 100)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner": githubv4.String(organization),
+		"name":  githubv4.String(repository),
+	}
+
+	if err := gc.clientV4.Query(ctx, &query, variables); err != nil {
+		return err
+	}
+
+	var categoryID githubv4.ID
+	for _, node := range query.Repository.DiscussionCategories.Nodes {
+		if strings.EqualFold(node.Name, category) {
+			categoryID = node.ID
+		}
+	}
+	if categoryID == nil {
+		return fmt.Errorf("discussion category %q not found in %s/%s", category, organization, repository)
+	}
+
+	var mutate struct {
+		CreateDiscussion struct {
+			ClientMutationId githubv4.ID
+		} `graphql:"createDiscussion(input: $input)"`
+	}
+
+	return gc.clientV4.Mutate(ctx, &mutate, githubv4.CreateDiscussionInput{
+		RepositoryID: query.Repository.ID,
+		CategoryID:   categoryID,
+		Title:        githubv4.String(title),
+		Body:         githubv4.String(body),
+	}, nil)
+}
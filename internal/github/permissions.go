@@ -0,0 +1,83 @@
+package github
+
+import (
+	"context"
+
+	"github.com/google/go-github/v59/github"
+)
+
+// Repository permissions as accepted by the API
+const (
+	PermissionRead  = "pull"
+	PermissionWrite = "push"
+)
+
+// roleNames maps the role names of collaborators to the permissions the API
+// accepts. Other roles, e.g. maintain or custom roles, are accepted as is.
+var roleNames = map[string]string{
+	"read":  PermissionRead,
+	"write": PermissionWrite,
+}
+
+// GetTeamPermissions returns the permission of every team on a repository by
+// team slug
+func (gc *GitHubClient) GetTeamPermissions(ctx context.Context, organization string, repository string) (map[string]string, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	permissions := make(map[string]string)
+	for {
+		teams, response, err := gc.clientV3.Repositories.ListTeams(ctx, organization, repository, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, team := range teams {
+			permissions[team.GetSlug()] = team.GetPermission()
+		}
+
+		if response.NextPage == 0 {
+			return permissions, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+// GetCollaboratorPermissions returns the permission of every direct
+// collaborator of a repository by login
+func (gc *GitHubClient) GetCollaboratorPermissions(ctx context.Context, organization string, repository string) (map[string]string, error) {
+	opt := &github.ListCollaboratorsOptions{Affiliation: "direct", ListOptions: github.ListOptions{PerPage: 100}}
+	permissions := make(map[string]string)
+	for {
+		users, response, err := gc.clientV3.Repositories.ListCollaborators(ctx, organization, repository, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, user := range users {
+			permission := user.GetRoleName()
+			if name, ok := roleNames[permission]; ok {
+				permission = name
+			}
+			permissions[user.GetLogin()] = permission
+		}
+
+		if response.NextPage == 0 {
+			return permissions, nil
+		}
+		opt.Page = response.NextPage
+	}
+}
+
+// SetTeamPermission changes the permission of a team on a repository
+func (gc *GitHubClient) SetTeamPermission(ctx context.Context, organization string, repository string, team string, permission string) error {
+	_, err := gc.clientV3.Teams.AddTeamRepoBySlug(ctx, organization, team, organization, repository,
+		&github.TeamAddTeamRepoOptions{Permission: permission})
+	return err
+}
+
+// SetCollaboratorPermission changes the permission of a direct collaborator
+// on a repository
+func (gc *GitHubClient) SetCollaboratorPermission(ctx context.Context, organization string, repository string, user string, permission string) error {
+	_, _, err := gc.clientV3.Repositories.AddCollaborator(ctx, organization, repository, user,
+		&github.RepositoryAddCollaboratorOptions{Permission: permission})
+	return err
+}
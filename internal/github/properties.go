@@ -0,0 +1,165 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/go-github/v59/github"
+)
+
+// CustomProperty is the definition of a custom property of an organization
+type CustomProperty struct {
+	Name string
+	// ValueType is string, single_select, multi_select or true_false
+	ValueType     string
+	Description   string
+	AllowedValues []string
+}
+
+// GetCustomProperties returns the custom property definitions of an
+// organization by name
+func (gc *GitHubClient) GetCustomProperties(ctx context.Context, org string) (map[string]CustomProperty, error) {
+	definitions, _, err := gc.clientV3.Organizations.GetAllCustomProperties(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]CustomProperty, len(definitions))
+	for _, definition := range definitions {
+		properties[definition.GetPropertyName()] = CustomProperty{
+			Name:          definition.GetPropertyName(),
+			ValueType:     definition.ValueType,
+			Description:   definition.GetDescription(),
+			AllowedValues: definition.AllowedValues,
+		}
+	}
+
+	return properties, nil
+}
+
+// CreateCustomProperty defines a custom property in an organization, or
+// replaces the definition with the same name
+func (gc *GitHubClient) CreateCustomProperty(ctx context.Context, org string, property CustomProperty) error {
+	definition := &github.CustomProperty{
+		ValueType:     property.ValueType,
+		AllowedValues: property.AllowedValues,
+	}
+	if property.Description != "" {
+		definition.Description = &property.Description
+	}
+
+	_, _, err := gc.clientV3.Organizations.CreateOrUpdateCustomProperty(ctx, org, property.Name, definition)
+	return err
+}
+
+// customPropertyValue is a custom property value as the API returns it.
+// go-github decodes values as strings only, the values of multi_select
+// properties are lists.
+type customPropertyValue struct {
+	PropertyName string          `json:"property_name"`
+	Value        json.RawMessage `json:"value"`
+}
+
+// GetCustomPropertyValues returns the custom property values of the
+// repositories of an organization by repository and property name, see
+// GetRepositoryCustomPropertyValues
+func (gc *GitHubClient) GetCustomPropertyValues(ctx context.Context, org string) (map[string]map[string]any, error) {
+	var page []struct {
+		RepositoryName string                `json:"repository_name"`
+		Properties     []customPropertyValue `json:"properties"`
+	}
+
+	values := make(map[string]map[string]any)
+	for number := 1; ; {
+		req, err := gc.clientV3.NewRequest(http.MethodGet, fmt.Sprintf("orgs/%s/properties/values?per_page=100&page=%d", org, number), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		page = nil
+		response, err := gc.clientV3.Do(ctx, req, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range page {
+			values[repo.RepositoryName] = gc.decodePropertyValues(repo.RepositoryName, repo.Properties)
+		}
+
+		if response.NextPage == 0 {
+			return values, nil
+		}
+		number = response.NextPage
+	}
+}
+
+// GetRepositoryCustomPropertyValues returns the custom property values of a
+// repository by property name, a string or, for multi_select properties, a
+// []string. Properties without a value are left out.
+func (gc *GitHubClient) GetRepositoryCustomPropertyValues(ctx context.Context, org string, repository string) (map[string]any, error) {
+	req, err := gc.clientV3.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/properties/values", org, repository), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var properties []customPropertyValue
+	if _, err := gc.clientV3.Do(ctx, req, &properties); err != nil {
+		return nil, err
+	}
+
+	return gc.decodePropertyValues(repository, properties), nil
+}
+
+func (gc *GitHubClient) decodePropertyValues(repository string, properties []customPropertyValue) map[string]any {
+	values := make(map[string]any, len(properties))
+	for _, property := range properties {
+		var text string
+		var list []string
+		switch {
+		case len(property.Value) == 0 || string(property.Value) == "null":
+		case json.Unmarshal(property.Value, &text) == nil:
+			values[property.PropertyName] = text
+		case json.Unmarshal(property.Value, &list) == nil:
+			values[property.PropertyName] = list
+		default:
+			gc.logger.Warn("skipping custom property value of unknown type", "repository", repository,
+				"property", property.PropertyName, "value", string(property.Value))
+		}
+	}
+
+	return values
+}
+
+// SetRepositoryCustomPropertyValues sets custom property values of a
+// repository by property name, keeping its other values. Values are strings
+// or, for multi_select properties, []string.
+func (gc *GitHubClient) SetRepositoryCustomPropertyValues(ctx context.Context, org string, repository string, values map[string]any) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	type propertyValue struct {
+		PropertyName string `json:"property_name"`
+		Value        any    `json:"value"`
+	}
+	body := struct {
+		RepositoryNames []string        `json:"repository_names"`
+		Properties      []propertyValue `json:"properties"`
+	}{RepositoryNames: []string{repository}}
+	for _, name := range names {
+		body.Properties = append(body.Properties, propertyValue{PropertyName: name, Value: values[name]})
+	}
+
+	req, err := gc.clientV3.NewRequest(http.MethodPatch, fmt.Sprintf("orgs/%s/properties/values", org), body)
+	if err != nil {
+		return err
+	}
+
+	_, err = gc.clientV3.Do(ctx, req, nil)
+	return err
+}
@@ -0,0 +1,150 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitBudget is the last known state of a rate limit resource, e.g. the
+// REST "core" budget or the GraphQL "graphql" point budget
+type RateLimitBudget struct {
+	Client     string
+	Credential string
+	Resource   string
+	Limit      int
+	Remaining  int
+	Reset      time.Time
+}
+
+// Headroom returns the fraction of the budget that is still available. A
+// budget whose reset time has passed is considered full.
+func (b RateLimitBudget) Headroom(now time.Time) float64 {
+	if b.Limit <= 0 || now.After(b.Reset) {
+		return 1
+	}
+	return float64(b.Remaining) / float64(b.Limit)
+}
+
+func (b RateLimitBudget) String() string {
+	name := b.Client
+	if b.Credential != "" {
+		name += "[" + b.Credential + "]"
+	}
+	return fmt.Sprintf("%s/%s %d/%d (reset %s)", name, b.Resource, b.Remaining, b.Limit, b.Reset.Format(time.TimeOnly))
+}
+
+// RateLimitMonitor records the rate limit headers of every response of the
+// clients it is attached to. It is shared by the source and target clients so
+// that callers can throttle on the scarcest budget.
+type RateLimitMonitor struct {
+	mu      sync.Mutex
+	budgets map[string]RateLimitBudget
+}
+
+func NewRateLimitMonitor() *RateLimitMonitor {
+	return &RateLimitMonitor{budgets: make(map[string]RateLimitBudget)}
+}
+
+// Transport wraps base so that the rate limit headers of its responses are
+// recorded under the given client name
+func (m *RateLimitMonitor) Transport(client string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitTransport{client: client, base: base, monitor: m}
+}
+
+// Budgets returns the last known budgets sorted by client and resource
+func (m *RateLimitMonitor) Budgets() []RateLimitBudget {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	budgets := make([]RateLimitBudget, 0, len(m.budgets))
+	for _, budget := range m.budgets {
+		budgets = append(budgets, budget)
+	}
+
+	sort.Slice(budgets, func(i, j int) bool {
+		if budgets[i].Client != budgets[j].Client {
+			return budgets[i].Client < budgets[j].Client
+		}
+		if budgets[i].Resource != budgets[j].Resource {
+			return budgets[i].Resource < budgets[j].Resource
+		}
+		return budgets[i].Credential < budgets[j].Credential
+	})
+
+	return budgets
+}
+
+// Headroom returns the lowest headroom of all known resources, or 1 if no
+// budget is known yet. The budgets of all credentials of a client are added
+// up, as requests are spread across them.
+func (m *RateLimitMonitor) Headroom() float64 {
+	type total struct{ remaining, limit float64 }
+	totals := make(map[string]*total)
+	now := time.Now()
+
+	for _, budget := range m.Budgets() {
+		key := budget.Client + "/" + budget.Resource
+		if totals[key] == nil {
+			totals[key] = &total{}
+		}
+		totals[key].remaining += budget.Headroom(now) * float64(budget.Limit)
+		totals[key].limit += float64(budget.Limit)
+	}
+
+	headroom := 1.0
+	for _, t := range totals {
+		if t.limit > 0 && t.remaining/t.limit < headroom {
+			headroom = t.remaining / t.limit
+		}
+	}
+
+	return headroom
+}
+
+func (m *RateLimitMonitor) record(client, credential string, header http.Header) {
+	resource := header.Get("X-RateLimit-Resource")
+	limit, errLimit := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	remaining, errRemaining := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	reset, errReset := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+
+	if resource == "" || errLimit != nil || errRemaining != nil || errReset != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.budgets[client+"/"+credential+"/"+resource] = RateLimitBudget{
+		Client:     client,
+		Credential: credential,
+		Resource:   resource,
+		Limit:      limit,
+		Remaining:  remaining,
+		Reset:      time.Unix(reset, 0),
+	}
+}
+
+type rateLimitTransport struct {
+	client  string
+	base    http.RoundTripper
+	monitor *RateLimitMonitor
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if resp != nil {
+		credential := ""
+		if resp.Request != nil {
+			credential, _ = resp.Request.Context().Value(credentialContextKey{}).(string)
+		}
+		t.monitor.record(t.client, credential, resp.Header)
+	}
+	return resp, err
+}
@@ -0,0 +1,356 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion   = "us-east-1"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// s3MaxURLExpiry is the longest validity of a pre-signed S3 URL
+	s3MaxURLExpiry = 7 * 24 * time.Hour
+)
+
+// S3Storage stages archives in an S3 bucket. Requests are signed with
+// Signature Version 4, so any S3 compatible service such as MinIO can be used
+// by setting an endpoint.
+type S3Storage struct {
+	bucket   string
+	region   string
+	endpoint *url.URL
+	// pathStyle puts the bucket in the path instead of the host name, as
+	// needed by most S3 compatible services
+	pathStyle bool
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+
+	httpClient *http.Client
+}
+
+// NewS3Storage creates a storage for bucket. The credentials are read from
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN. If endpoint
+// is empty, the AWS endpoint of region is used.
+func NewS3Storage(bucket, region, endpoint string) (*S3Storage, error) {
+	if bucket == "" {
+		return nil, errors.New("no S3 bucket configured")
+	}
+
+	if region == "" {
+		region = s3DefaultRegion
+	}
+
+	s := &S3Storage{
+		bucket:          bucket,
+		region:          region,
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		httpClient:      &http.Client{},
+	}
+
+	if s.accessKeyID == "" || s.secretAccessKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY have to be set to use S3 storage")
+	}
+
+	var err error
+	if endpoint == "" {
+		s.endpoint, err = url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region))
+	} else {
+		s.endpoint, err = url.Parse(strings.TrimSuffix(endpoint, "/"))
+		s.pathStyle = true
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *S3Storage) Name() string { return "s3" }
+
+func (s *S3Storage) objectURL(name string, query url.Values) *url.URL {
+	u := *s.endpoint
+	path := "/" + awsEscape(name, false)
+	if s.pathStyle {
+		path = u.Path + "/" + awsEscape(s.bucket, false) + path
+	}
+
+	u.RawPath = path
+	u.Path, _ = url.PathUnescape(path)
+	u.RawQuery = awsCanonicalQuery(query)
+
+	return &u
+}
+
+func (s *S3Storage) Upload(ctx context.Context, name string, r io.ReaderAt, size int64) error {
+	if size <= uploadPartSize {
+		resp, err := s.do(ctx, http.MethodPut, name, nil, io.NewSectionReader(r, 0, size), size, s3UnsignedPayload)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	return s.uploadMultipart(ctx, name, r, size)
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *S3Storage) uploadMultipart(ctx context.Context, name string, r io.ReaderAt, size int64) error {
+	resp, err := s.do(ctx, http.MethodPost, name, url.Values{"uploads": {""}}, nil, 0, "")
+	if err != nil {
+		return err
+	}
+
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	abort := func() {
+		resp, err := s.do(context.WithoutCancel(ctx), http.MethodDelete, name, url.Values{"uploadId": {initiated.UploadID}}, nil, 0, "")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	var parts []s3CompletedPart
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+uploadPartSize, number+1 {
+		partSize := min(uploadPartSize, size-offset)
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadID}}
+
+		resp, err := s.do(ctx, http.MethodPut, name, query, io.NewSectionReader(r, offset, partSize), partSize, s3UnsignedPayload)
+		if err != nil {
+			abort()
+			return err
+		}
+		resp.Body.Close()
+
+		parts = append(parts, s3CompletedPart{number, resp.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		abort()
+		return err
+	}
+
+	resp, err = s.do(ctx, http.MethodPost, name, url.Values{"uploadId": {initiated.UploadID}}, bytes.NewReader(body), int64(len(body)), "")
+	if err != nil {
+		abort()
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *S3Storage) URL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return s.presign(name, expiry, time.Now().UTC()), nil
+}
+
+func (s *S3Storage) presign(name string, expiry time.Duration, now time.Time) string {
+	scope := s.scope(now)
+
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.accessKeyID + "/" + scope},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(min(expiry, s3MaxURLExpiry).Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if s.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	u := s.objectURL(name, query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	u.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+
+	return u.String()
+}
+
+func (s *S3Storage) Delete(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, name, nil, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for an object. If payloadHash is empty, the body
+// is read into memory to hash it.
+func (s *S3Storage) do(ctx context.Context, method, name string, query url.Values, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	if payloadHash == "" {
+		var payload []byte
+		if body != nil {
+			var err error
+			if payload, err = io.ReadAll(body); err != nil {
+				return nil, err
+			}
+		}
+		digest := sha256.Sum256(payload)
+		payloadHash = hex.EncodeToString(digest[:])
+		body = bytes.NewReader(payload)
+		size = int64(len(payload))
+	}
+
+	u := s.objectURL(name, query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	s.authorize(req, u, payloadHash, time.Now().UTC())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		if method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+			return resp, nil
+		}
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("S3 %s %s: %s: %s", method, name, resp.Status, message)
+	}
+
+	return resp, nil
+}
+
+// authorize signs a request for u with the x-amz headers, the session token
+// if there is one, and the host
+func (s *S3Storage) authorize(req *http.Request, u *url.URL, payloadHash string, now time.Time) {
+	req.Header.Set("x-amz-date", now.Format("20060102T150405Z"))
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.sessionToken)
+	}
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if s.sessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, header := range signedHeaders {
+		value := req.Header.Get(header)
+		if header == "host" {
+			value = u.Host
+		}
+		canonicalHeaders.WriteString(header + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		u.EscapedPath(),
+		u.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKeyID, s.scope(now), strings.Join(signedHeaders, ";"), s.signature(now, canonicalRequest)))
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s *S3Storage) signature(now time.Time, canonicalRequest string) string {
+	requestDigest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		s.scope(now),
+		hex.EncodeToString(requestDigest[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + s.secretAccessKey)
+	for _, part := range []string{now.Format("20060102"), s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but unreserved characters, optionally
+// keeping slashes, as required for SigV4 canonical requests
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', keepSlash && c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(key, false)+"="+awsEscape(value, false))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
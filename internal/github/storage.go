@@ -0,0 +1,197 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveURLExpiry is how long the URLs handed to GEI stay valid. GEI only
+// needs them until GitHub has fetched the archives, but the import may wait
+// in a queue first.
+const archiveURLExpiry = 24 * time.Hour
+
+// uploadPartSize is the size of the parts large archives are uploaded in
+const uploadPartSize = 256 << 20
+
+// ArchiveStorage stages migration archives where GitHub can fetch them
+type ArchiveStorage interface {
+	// Name identifies the backend in logs
+	Name() string
+	// Upload stores size bytes read from r under name
+	Upload(ctx context.Context, name string, r io.ReaderAt, size int64) error
+	// URL returns a URL that allows reading the archive without credentials
+	// until expiry
+	URL(ctx context.Context, name string, expiry time.Duration) (string, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// LocalStorage keeps archives in a directory. If BaseURL is set, the
+// directory is expected to be served at that URL, otherwise file URLs are
+// returned. It does not sign URLs and is meant for tests and air-gapped
+// setups.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalStorage(dir, baseURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStorage{dir, strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *LocalStorage) Name() string { return "local" }
+
+func (s *LocalStorage) Upload(ctx context.Context, name string, r io.ReaderAt, size int64) error {
+	f, err := os.Create(filepath.Join(s.dir, name))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, io.NewSectionReader(r, 0, size)); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *LocalStorage) URL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	if s.baseURL != "" {
+		return s.baseURL + "/" + url.PathEscape(name), nil
+	}
+
+	path, err := filepath.Abs(filepath.Join(s.dir, name))
+	if err != nil {
+		return "", err
+	}
+
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(), nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// StagedArchives are the archives of a repository in storage
+type StagedArchives struct {
+	GitArchiveURL      string
+	MetadataArchiveURL string
+
+	exportIDs []int64
+	names     []string
+}
+
+// ArchiveStaging exports repository archives from the source, uploads them
+// to storage and hands out URLs for GEI. It replaces the archive handling of
+// GEI for GitHub Enterprise Server sources.
+type ArchiveStaging struct {
+	source  *GitHubClient
+	storage ArchiveStorage
+	// keep leaves the archives in storage and on the source after cleanup
+	keep bool
+}
+
+func NewArchiveStaging(source *GitHubClient, storage ArchiveStorage, keep bool) *ArchiveStaging {
+	return &ArchiveStaging{source, storage, keep}
+}
+
+// Stage exports the git and metadata archives of a repository and uploads
+// them. On failure, whatever was already staged is cleaned up.
+func (s *ArchiveStaging) Stage(ctx context.Context, organization string, repository string) (StagedArchives, error) {
+	var staged StagedArchives
+
+	for _, metadata := range []bool{false, true} {
+		id, err := s.source.StartArchiveExport(ctx, organization, repository, metadata)
+		if err != nil {
+			s.Cleanup(ctx, organization, staged)
+			return StagedArchives{}, err
+		}
+		staged.exportIDs = append(staged.exportIDs, id)
+	}
+
+	for i, kind := range []string{"git", "metadata"} {
+		id := staged.exportIDs[i]
+		name := fmt.Sprintf("%s-%s-%s-%d.tar.gz", organization, repository, kind, id)
+
+		archiveURL, err := s.stage(ctx, organization, id, name)
+		if err != nil {
+			s.Cleanup(ctx, organization, staged)
+			return StagedArchives{}, err
+		}
+		staged.names = append(staged.names, name)
+
+		if kind == "git" {
+			staged.GitArchiveURL = archiveURL
+		} else {
+			staged.MetadataArchiveURL = archiveURL
+		}
+	}
+
+	return staged, nil
+}
+
+// stage waits for an export, uploads its archive under name and returns the
+// URL of the uploaded archive
+func (s *ArchiveStaging) stage(ctx context.Context, organization string, id int64, name string) (string, error) {
+	if err := s.source.WaitForArchiveExport(ctx, organization, id); err != nil {
+		return "", err
+	}
+
+	archive, err := os.CreateTemp("", "gei-archive-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := s.source.DownloadArchive(ctx, organization, id, archive); err != nil {
+		return "", err
+	}
+
+	info, err := archive.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("uploading migration archive", "storage", s.storage.Name(), "archive", name, "bytes", info.Size())
+	if err := s.storage.Upload(ctx, name, archive, info.Size()); err != nil {
+		return "", fmt.Errorf("error uploading %s to %s storage: %w", name, s.storage.Name(), err)
+	}
+
+	return s.storage.URL(ctx, name, archiveURLExpiry)
+}
+
+// Cleanup removes staged archives from storage and from the source. Errors
+// are logged, as leftover archives do not affect the migration.
+func (s *ArchiveStaging) Cleanup(ctx context.Context, organization string, staged StagedArchives) {
+	if s.keep {
+		return
+	}
+
+	for _, name := range staged.names {
+		if err := s.storage.Delete(ctx, name); err != nil {
+			slog.Warn("failed to delete migration archive from storage", "storage", s.storage.Name(), "archive", name, "error", err)
+		}
+	}
+
+	for _, id := range staged.exportIDs {
+		if err := s.source.DeleteArchive(ctx, organization, id); err != nil {
+			slog.Warn("failed to delete migration archive from source", "id", id, "error", err)
+		}
+	}
+}
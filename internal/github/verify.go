@@ -0,0 +1,188 @@
+package github
+
+import (
+	"context"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/shurcooL/githubv4"
+)
+
+// RepositorySnapshot holds the git and metadata counts of a repository that
+// a migration has to carry over
+type RepositorySnapshot struct {
+	// Branches and Tags map ref names to the object ID they point to
+	Branches      map[string]string
+	Tags          map[string]string
+	DefaultBranch string
+	// Commits is the number of commits on the default branch
+	Commits      int
+	Issues       int
+	PullRequests int
+	Releases     int
+}
+
+// GetRepositorySnapshot returns the refs and counts of a repository
+func (gc *GitHubClient) GetRepositorySnapshot(ctx context.Context, organization string, repository string) (RepositorySnapshot, error) {
+	var query struct {
+		Repository struct {
+			DefaultBranchRef *struct {
+				Name   string
+				Target struct {
+					Commit struct {
+						History struct{ TotalCount int }
+					} `graphql:"... on Commit"`
+				}
+			}
+			Issues       struct{ TotalCount int }
+			PullRequests struct{ TotalCount int }
+			Releases     struct{ TotalCount int }
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner": githubv4.String(organization),
+		"name":  githubv4.String(repository),
+	}
+
+	if err := gc.clientV4.Query(ctx, &query, variables); err != nil {
+		return RepositorySnapshot{}, err
+	}
+
+	snapshot := RepositorySnapshot{
+		Issues:       query.Repository.Issues.TotalCount,
+		PullRequests: query.Repository.PullRequests.TotalCount,
+		Releases:     query.Repository.Releases.TotalCount,
+	}
+	if ref := query.Repository.DefaultBranchRef; ref != nil {
+		snapshot.DefaultBranch = ref.Name
+		snapshot.Commits = ref.Target.Commit.History.TotalCount
+	}
+
+	var err error
+	if snapshot.Branches, err = gc.getRefs(ctx, organization, repository, "refs/heads/"); err != nil {
+		return RepositorySnapshot{}, err
+	}
+	if snapshot.Tags, err = gc.getRefs(ctx, organization, repository, "refs/tags/"); err != nil {
+		return RepositorySnapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// GetBranchHeads returns the object ID every branch of a repository points
+// to, by branch name
+func (gc *GitHubClient) GetBranchHeads(ctx context.Context, organization, repository string) (map[string]string, error) {
+	return gc.getRefs(ctx, organization, repository, "refs/heads/")
+}
+
+// getRefs returns the refs below prefix by name, without the prefix
+func (gc *GitHubClient) getRefs(ctx context.Context, organization, repository, prefix string) (map[string]string, error) {
+	var query struct {
+		Repository struct {
+			Refs struct {
+				Nodes []struct {
+					Name   string
+					Target struct {
+						Oid string
+					}
+				}
+				PageInfo struct {
+					EndCursor   githubv4.String
+					HasNextPage bool
+				}
+			} `graphql:"refs(refPrefix: $prefix, first: 100, after: $cursor)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(organization),
+		"name":   githubv4.String(repository),
+		"prefix": githubv4.String(prefix),
+		"cursor": (*githubv4.String)(nil),
+	}
+
+	refs := make(map[string]string)
+	for {
+		if err := gc.clientV4.Query(ctx, &query, variables); err != nil {
+			return nil, err
+		}
+
+		for _, ref := range query.Repository.Refs.Nodes {
+			refs[ref.Name] = ref.Target.Oid
+		}
+
+		if !query.Repository.Refs.PageInfo.HasNextPage {
+			return refs, nil
+		}
+		variables["cursor"] = githubv4.NewString(query.Repository.Refs.PageInfo.EndCursor)
+	}
+}
+
+// GetCodeScanningCounts returns the number of code scanning analyses and the
+// number of code scanning alerts by state (open, dismissed or fixed). A
+// repository without analyses has no alerts.
+func (gc *GitHubClient) GetCodeScanningCounts(ctx context.Context, organization string, repository string) (int, map[string]int, error) {
+	analyses, err := countAll(func(opt github.ListOptions) (int, *github.Response, error) {
+		analyses, response, err := gc.clientV3.CodeScanning.ListAnalysesForRepo(ctx, organization, repository,
+			&github.AnalysesListOptions{ListOptions: opt})
+		return len(analyses), response, err
+	})
+	if StatusCode(err) == 404 {
+		return 0, map[string]int{}, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	alerts := make(map[string]int)
+	for _, state := range []string{"open", "closed"} {
+		opt := &github.AlertListOptions{State: state, ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			page, response, err := gc.clientV3.CodeScanning.ListAlertsForRepo(ctx, organization, repository, opt)
+			if err != nil {
+				return 0, nil, err
+			}
+
+			for _, alert := range page {
+				alerts[alert.GetState()]++
+			}
+
+			if response.NextPage == 0 {
+				break
+			}
+			opt.ListOptions.Page = response.NextPage
+		}
+	}
+
+	return analyses, alerts, nil
+}
+
+// GetSecretScanningAlertCounts returns the number of secret scanning alerts
+// by resolution. Open alerts are counted as "open".
+func (gc *GitHubClient) GetSecretScanningAlertCounts(ctx context.Context, organization string, repository string) (map[string]int, error) {
+	opt := &github.SecretScanningAlertListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	alerts := make(map[string]int)
+	for {
+		page, response, err := gc.clientV3.SecretScanning.ListAlertsForRepo(ctx, organization, repository, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, alert := range page {
+			resolution := alert.GetResolution()
+			if alert.GetState() == "open" || resolution == "" {
+				resolution = "open"
+			}
+			alerts[resolution]++
+		}
+
+		switch {
+		case response.NextPage != 0:
+			opt.ListOptions.Page = response.NextPage
+		case response.After != "":
+			opt.ListCursorOptions.After = response.After
+		default:
+			return alerts, nil
+		}
+	}
+}
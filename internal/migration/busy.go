@@ -0,0 +1,130 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/pkg/worker"
+)
+
+// BusyGate configures StepWaitForIdle
+type BusyGate struct {
+	// Timeout is how long a busy source repository is waited for before its
+	// migration fails
+	Timeout time.Duration
+	// QuietPeriod is the time since the last push after which a repository
+	// is no longer busy. Zero ignores pushes.
+	QuietPeriod time.Duration
+	// Defer moves a busy repository to the back of the queue once before it
+	// is waited for
+	Defer bool
+}
+
+// ErrSourceBusy is returned for repositories whose source was still busy when
+// the busy timeout expired
+var ErrSourceBusy = errors.New("source is busy")
+
+// busyPollInterval is how often a busy source repository is checked again
+var busyPollInterval = 30 * time.Second
+
+// maxDeferrals is the number of times a busy repository is moved to the back
+// of the queue before it is waited for
+const maxDeferrals = 1
+
+// busyReason returns why a source repository is busy, or an empty string if
+// no workflow runs are pending and it was not pushed to within the quiet
+// period
+func (md MigrationData) busyReason(ctx context.Context, repositoryName string) (string, error) {
+	var reasons []string
+
+	runs, err := md.orgs.sourceGC.CountPendingWorkflowRuns(ctx, md.orgs.source, repositoryName)
+	if err != nil {
+		return "", err
+	}
+	if runs > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d workflow runs queued or in progress", runs))
+	}
+
+	if quietPeriod := md.options.Busy.QuietPeriod; quietPeriod > 0 {
+		repository, err := md.orgs.sourceGC.GetRepository(ctx, repositoryName, md.orgs.source)
+		if err != nil {
+			return "", err
+		}
+		if repository.PushedAt != nil && time.Since(repository.PushedAt.Time) < quietPeriod {
+			reasons = append(reasons, "pushed to at "+repository.PushedAt.UTC().Format(time.RFC3339))
+		}
+	}
+
+	return strings.Join(reasons, ", "), nil
+}
+
+// waitForIdle checks that a source repository has no pending workflow runs
+// and no recent pushes before it is changed. A busy repository is deferred,
+// if deferring is enabled and it runs on a worker pool, or waited for until
+// the busy timeout expires. The returned error wraps worker.ErrDeferred if
+// the repository was deferred and ErrSourceBusy on timeout.
+func (md MigrationData) waitForIdle(ctx context.Context, logger *slog.Logger, repository github.Repository, status *repoStatus) error {
+	deferrals, deferrable := worker.Deferrals(ctx)
+	if status != nil {
+		status.Deferrals = deferrals
+	}
+
+	reason, err := md.busyReason(ctx, *repository.Name)
+	if err != nil {
+		status.fail("checking for activity at source", err)
+		return err
+	}
+	if reason == "" {
+		return nil
+	}
+
+	if md.options.Busy.Defer && deferrable && deferrals < maxDeferrals {
+		logger.Info("source is busy, moving repository to the back of the queue", "repository", *repository.Name, "reason", reason)
+		return fmt.Errorf("%w: %s", worker.ErrDeferred, reason)
+	}
+
+	logger.Info("source is busy, waiting", "repository", *repository.Name, "reason", reason, "timeout", md.options.Busy.Timeout)
+
+	step := stepStatus{Name: "waiting for activity at source", StartedAt: time.Now().UTC()}
+	timeout := time.NewTimer(md.options.Busy.Timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(busyPollInterval)
+	defer ticker.Stop()
+
+	for err == nil && reason != "" {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			if errors.Is(err, context.Canceled) {
+				err = ErrInterrupted
+			}
+		case <-timeout.C:
+			err = fmt.Errorf("%w after %s: %s", ErrSourceBusy, md.options.Busy.Timeout, reason)
+		case <-ticker.C:
+			reason, err = md.busyReason(ctx, *repository.Name)
+		}
+	}
+
+	if status != nil {
+		step.DurationSeconds = time.Since(step.StartedAt).Seconds()
+		if err != nil {
+			step.Error = err.Error()
+		}
+		status.Steps = append(status.Steps, step)
+	}
+
+	if err != nil {
+		logger.Error("source did not become idle", "repository", *repository.Name, "error", err)
+		status.fail(step.Name, err)
+		return err
+	}
+
+	logger.Info("source is idle", "repository", *repository.Name)
+
+	return nil
+}
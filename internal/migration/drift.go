@@ -0,0 +1,99 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// Policies for repositories whose source changed while they were migrated
+const (
+	// DriftPolicyFail lists the repository as failed with error category
+	// drift and leaves its source unarchived
+	DriftPolicyFail = "fail"
+	// DriftPolicyRemigrate deletes the target repository and migrates it
+	// again
+	DriftPolicyRemigrate = "remigrate"
+)
+
+// DriftPolicies are the names of the drift policies
+var DriftPolicies = []string{DriftPolicyFail, DriftPolicyRemigrate}
+
+// maxRemigrations is the number of times a repository is migrated again
+// under DriftPolicyRemigrate before it fails
+const maxRemigrations = 2
+
+// ErrSourceDrift is returned for repositories whose source branches moved
+// while they were migrated
+var ErrSourceDrift = errors.New("source changed during migration")
+
+// ValidateDriftPolicy returns an error if policy is not a drift policy
+func ValidateDriftPolicy(policy string) error {
+	if !slices.Contains(DriftPolicies, policy) {
+		return fmt.Errorf("unknown drift policy %q, expected one of %s", policy, strings.Join(DriftPolicies, ", "))
+	}
+	return nil
+}
+
+// sourceHeads returns the branch heads of a source repository. It returns nil
+// for archived repositories, which cannot be pushed to, and if the heads
+// could not be read, in which case drift is not detected.
+func (md MigrationData) sourceHeads(ctx context.Context, logger *slog.Logger, repository github.Repository) map[string]string {
+	if *repository.Archived {
+		return nil
+	}
+
+	heads, err := md.orgs.sourceGC.GetBranchHeads(ctx, md.orgs.source, *repository.Name)
+	if err != nil {
+		logger.Warn("could not read branch heads at source, changes during the migration are not detected",
+			"repository", *repository.Name, "error", err)
+		return nil
+	}
+
+	return heads
+}
+
+// sourceDrift compares the branch heads of a source repository with the heads
+// recorded before it was migrated. It returns an error wrapping
+// ErrSourceDrift that names the branches that moved, were created or were
+// deleted.
+func (md MigrationData) sourceDrift(ctx context.Context, logger *slog.Logger, repositoryName string, recorded map[string]string) error {
+	heads, err := md.orgs.sourceGC.GetBranchHeads(ctx, md.orgs.source, repositoryName)
+	if err != nil {
+		logger.Warn("could not read branch heads at source after the migration, changes are not detected",
+			"repository", repositoryName, "error", err)
+		return nil
+	}
+
+	var changes []string
+	for branch, sha := range recorded {
+		switch head, ok := heads[branch]; {
+		case !ok:
+			changes = append(changes, branch+" (deleted)")
+		case head != sha:
+			changes = append(changes, branch+" (moved)")
+		}
+	}
+	for branch := range heads {
+		if _, ok := recorded[branch]; !ok {
+			changes = append(changes, branch+" (created)")
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	slices.Sort(changes)
+	message := strings.Join(changes[:min(len(changes), maxListedRefs)], ", ")
+	if len(changes) > maxListedRefs {
+		message += fmt.Sprintf(" and %d more", len(changes)-maxListedRefs)
+	}
+
+	return fmt.Errorf("%w: %s", ErrSourceDrift, message)
+}
@@ -0,0 +1,284 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/pkg/worker"
+)
+
+// OrgPair is a source organization and the organization its repositories
+// are migrated to
+type OrgPair struct {
+	Source string
+	Target string
+	// Prefix is prepended to the names of the repositories at target
+	Prefix string
+}
+
+func (p OrgPair) String() string {
+	return p.Source + " -> " + p.Target
+}
+
+// dir is the directory of the checkpoint of the pair. The separator cannot
+// be part of an organization name, so two pairs never share a directory.
+func (p OrgPair) dir() string {
+	return p.Source + "." + p.Target
+}
+
+// validatePairs returns an error if a pair is listed twice, ignoring case
+func validatePairs(pairs []OrgPair) error {
+	if len(pairs) == 0 {
+		return errors.New("no organizations to migrate")
+	}
+
+	seen := make(map[OrgPair]bool)
+	for _, pair := range pairs {
+		key := OrgPair{Source: strings.ToLower(pair.Source), Target: strings.ToLower(pair.Target)}
+		if seen[key] {
+			return fmt.Errorf("organization pair %s is listed twice", pair)
+		}
+		seen[key] = true
+	}
+
+	return nil
+}
+
+// EnterpriseMigration migrates several organizations at once. All
+// organizations share one budget of workers and every target organization
+// gets a single migration status repository, also when several sources are
+// consolidated into it.
+type EnterpriseMigration struct {
+	migrations []OrgMigration
+	pairs      []OrgPair
+}
+
+type enterpriseResult struct {
+	Timestamp     time.Time         `json:"timestamp"`
+	Summary       enterpriseSummary `json:"summary"`
+	Organizations []migrationResult `json:"organizations"`
+	Interrupted   bool              `json:"interrupted,omitempty"`
+}
+
+type enterpriseSummary struct {
+	Organizations int `json:"organizations"`
+	// FailedOrganizations counts the organizations that could not be
+	// migrated at all
+	FailedOrganizations int `json:"failedOrganizations"`
+	Migrated            int `json:"migrated"`
+	Degraded            int `json:"degraded"`
+	Failed              int `json:"failed"`
+	Skipped             int `json:"skipped"`
+	Pending             int `json:"pending"`
+}
+
+// NewEnterpriseMigration creates a migration for every pair. conn holds the
+// credentials and settings shared by all organizations, its organizations
+// are replaced by the ones of each pair. options.Concurrency.MaxWorkers is
+// the number of repositories migrated at the same time across all pairs.
+// The checkpoint of each pair is written to the directory of OrgPair.dir
+// below options.OutputDir.
+func NewEnterpriseMigration(ctx context.Context, conn Connection, options Options, pairs []OrgPair) (EnterpriseMigration, error) {
+	if err := validatePairs(pairs); err != nil {
+		return EnterpriseMigration{}, err
+	}
+	if conn.Provider != nil {
+		return EnterpriseMigration{}, fmt.Errorf("%s source: %w", conn.Provider.Name(), ErrUnsupportedSource)
+	}
+	if !options.Routing.isEmpty() {
+		return EnterpriseMigration{}, errors.New("routing is not supported for enterprise migrations, use a pair per target organization")
+	}
+
+	limiter, err := worker.NewLimiter(options.Concurrency.MaxWorkers)
+	if err != nil {
+		return EnterpriseMigration{}, err
+	}
+
+	em := EnterpriseMigration{pairs: pairs}
+	for _, pair := range pairs {
+		pairConn := conn
+		pairConn.SourceOrg, pairConn.TargetOrg = pair.Source, pair.Target
+
+		pairOptions := options
+		pairOptions.Concurrency.Limiter = limiter
+		pairOptions.TargetPrefix = pair.Prefix
+		pairOptions.OutputDir = filepath.Join(options.OutputDir, pair.dir())
+		if err := os.MkdirAll(pairOptions.OutputDir, 0755); err != nil {
+			return EnterpriseMigration{}, err
+		}
+
+		om, err := NewOrgMigration(ctx, pairConn, pairOptions)
+		if err != nil {
+			return EnterpriseMigration{}, fmt.Errorf("%s: %w", pair, err)
+		}
+		em.migrations = append(em.migrations, om)
+	}
+
+	return em, nil
+}
+
+// DiscoverOrganizations returns a pair for every organization of a source
+// enterprise. If target is empty, every organization is migrated to an
+// organization of the same name, otherwise all of them are consolidated into
+// target and, if prefix is set, repository names are prefixed with the name
+// of their source organization.
+func DiscoverOrganizations(ctx context.Context, conn Connection, enterprise, target string, prefix bool) ([]OrgPair, error) {
+	sourceGC, err := github.NewGitHubClient(ctx, slog.Default(), conn.SourceCredentials,
+		github.ClientOptions{Name: "source", APIURL: conn.SourceAPIURL})
+	if err != nil {
+		return nil, err
+	}
+
+	organizations, err := sourceGC.GetEnterpriseOrganizations(ctx, enterprise)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([]OrgPair, 0, len(organizations))
+	for _, organization := range organizations {
+		pair := OrgPair{Source: organization, Target: organization}
+		if target != "" {
+			pair.Target = target
+			if prefix {
+				pair.Prefix = organization + "-"
+			}
+		}
+		pairs = append(pairs, pair)
+	}
+
+	slog.Info(fmt.Sprintf("found %d organizations in enterprise %s", len(pairs), enterprise))
+
+	return pairs, nil
+}
+
+// Migrate migrates all organizations. An organization that cannot be
+// migrated, e.g. because a migration to its target was already started, is
+// listed with its error and does not stop the others.
+func (em EnterpriseMigration) Migrate(ctx context.Context) (enterpriseResult, error) {
+	results := make([]migrationResult, len(em.migrations))
+	for i, pair := range em.pairs {
+		results[i] = migrationResult{SourceOrg: pair.Source, TargetOrg: pair.Target}
+	}
+
+	prepared := em.prepareTargets(func(om OrgMigration) error { return om.prepareMigration(ctx) })
+
+	candidates := make([][]github.Repository, len(em.migrations))
+	for i, om := range em.migrations {
+		if err := prepared[i]; err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		toMigrate, collisions, err := om.repositoriesToMigrate(ctx)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Failed = append(results[i].Failed, collisions...)
+		candidates[i] = toMigrate
+	}
+
+	repositories := em.claimTargetNames(candidates, results)
+
+	var wg sync.WaitGroup
+	for i, om := range em.migrations {
+		if results[i].Error != "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, om OrgMigration) {
+			defer wg.Done()
+			slog.Info("migrating", "source", em.pairs[i].Source, "destination", em.pairs[i].Target, "repositories", len(repositories[i]))
+			om.migrateRepositories(ctx, &results[i], repositories[i])
+		}(i, om)
+	}
+	wg.Wait()
+
+	er := enterpriseResult{Interrupted: ctx.Err() != nil}
+	for i, om := range em.migrations {
+		if results[i].Error == "" {
+			// a result that cannot be published is kept in the consolidated
+			// result file
+			results[i], _ = om.finishMigration(ctx, "Migration result from "+em.pairs[i].Source, results[i])
+		}
+
+		er.add(results[i])
+	}
+	er.Timestamp = time.Now().UTC()
+
+	slog.Info("enterprise migration finished", "organizations", er.Summary.Organizations, "failedOrganizations", er.Summary.FailedOrganizations,
+		"migrated", er.Summary.Migrated, "failed", er.Summary.Failed, "pending", er.Summary.Pending)
+
+	if er.Interrupted {
+		return er, ErrInterrupted
+	}
+
+	return er, nil
+}
+
+// prepareTargets calls prepare for the first pair of every target
+// organization, which checks for an ongoing migration and creates the
+// migration status repository, and returns its error for every pair of that
+// target
+func (em EnterpriseMigration) prepareTargets(prepare func(OrgMigration) error) []error {
+	errs := make([]error, len(em.migrations))
+	prepared := make(map[string]error)
+	for i, om := range em.migrations {
+		target := strings.ToLower(em.pairs[i].Target)
+		if _, ok := prepared[target]; !ok {
+			prepared[target] = prepare(om)
+		}
+		errs[i] = prepared[target]
+	}
+	return errs
+}
+
+// claimTargetNames returns the candidates of every pair whose target name is
+// not claimed by an earlier pair of the same target organization. Two
+// sources consolidated into the same target must not claim the same
+// repository name, the repositories of the later pair are added to its
+// failed repositories instead.
+func (em EnterpriseMigration) claimTargetNames(candidates [][]github.Repository, results []migrationResult) [][]github.Repository {
+	repositories := make([][]github.Repository, len(candidates))
+	claimed := make(map[string]string)
+	for i, om := range em.migrations {
+		for _, repository := range candidates[i] {
+			targetName := om.md.targetName(*repository.Name)
+			key := strings.ToLower(em.pairs[i].Target + "/" + targetName)
+			if other, ok := claimed[key]; ok {
+				status := newRepoStatus(repository)
+				status.TargetName = targetName
+				err := fmt.Errorf("target name is already used by a repository of %s, set a prefix or a repository mapping", other)
+				status.fail("checking name collisions", err)
+				status.finish(err)
+				results[i].Failed = append(results[i].Failed, status)
+				continue
+			}
+			claimed[key] = em.pairs[i].Source
+			repositories[i] = append(repositories[i], repository)
+		}
+	}
+	return repositories
+}
+
+func (er *enterpriseResult) add(mr migrationResult) {
+	er.Organizations = append(er.Organizations, mr)
+	er.Summary.Organizations++
+	if mr.Error != "" {
+		er.Summary.FailedOrganizations++
+	}
+	er.Summary.Migrated += len(mr.Migrated)
+	er.Summary.Degraded += len(mr.Degraded)
+	er.Summary.Failed += len(mr.Failed)
+	er.Summary.Skipped += len(mr.Skipped)
+	er.Summary.Pending += len(mr.Pending)
+}
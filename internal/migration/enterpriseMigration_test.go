@@ -0,0 +1,156 @@
+package migration
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	gogithub "github.com/google/go-github/v59/github"
+)
+
+// enterpriseFixture returns an enterprise migration of pairs without clients
+func enterpriseFixture(pairs ...OrgPair) EnterpriseMigration {
+	em := EnterpriseMigration{pairs: pairs}
+	for _, pair := range pairs {
+		var md MigrationData
+		md.orgs.source, md.orgs.target = pair.Source, pair.Target
+		md.options.TargetPrefix = pair.Prefix
+		em.migrations = append(em.migrations, OrgMigration{md: md})
+	}
+	return em
+}
+
+func repositories(names ...string) []github.Repository {
+	var repositories []github.Repository
+	for i, name := range names {
+		repositories = append(repositories, &gogithub.Repository{Name: gogithub.String(name), ID: gogithub.Int64(int64(i + 1)), Archived: gogithub.Bool(false)})
+	}
+	return repositories
+}
+
+func repositoryNames(repositories []github.Repository) []string {
+	var names []string
+	for _, repository := range repositories {
+		names = append(names, *repository.Name)
+	}
+	return names
+}
+
+func TestValidatePairs(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		pairs []OrgPair
+		valid bool
+	}{
+		{"none", nil, false},
+		{"distinct", []OrgPair{{Source: "a", Target: "c"}, {Source: "b", Target: "c"}, {Source: "a", Target: "d"}}, true},
+		{"duplicate", []OrgPair{{Source: "a", Target: "c"}, {Source: "a", Target: "c"}}, false},
+		{"duplicate in another case", []OrgPair{{Source: "a", Target: "c"}, {Source: "A", Target: "C"}}, false},
+		{"duplicate with another prefix", []OrgPair{{Source: "a", Target: "c"}, {Source: "a", Target: "c", Prefix: "a-"}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validatePairs(tc.pairs); (err == nil) != tc.valid {
+				t.Errorf("got error %v, want valid %t", err, tc.valid)
+			}
+		})
+	}
+}
+
+func TestOrgPairDirsDoNotCollide(t *testing.T) {
+	// both would be a-b-c with a hyphen
+	first, second := OrgPair{Source: "a-b", Target: "c"}, OrgPair{Source: "a", Target: "b-c"}
+	if first.dir() == second.dir() {
+		t.Errorf("%s and %s share the directory %s", first, second, first.dir())
+	}
+}
+
+func TestPrepareTargetsOncePerTarget(t *testing.T) {
+	em := enterpriseFixture(
+		OrgPair{Source: "a", Target: "consolidated"},
+		OrgPair{Source: "b", Target: "Consolidated"},
+		OrgPair{Source: "c", Target: "other"},
+	)
+	failure := errors.New("a migration is already running")
+
+	var prepared []string
+	errs := em.prepareTargets(func(om OrgMigration) error {
+		prepared = append(prepared, om.md.orgs.source)
+		if om.md.orgs.target == "consolidated" {
+			return failure
+		}
+		return nil
+	})
+
+	if want := []string{"a", "c"}; !slices.Equal(prepared, want) {
+		t.Errorf("prepared the pairs of %q, want %q", prepared, want)
+	}
+	if want := []error{failure, failure, nil}; !slices.Equal(errs, want) {
+		t.Errorf("got errors %v, want %v", errs, want)
+	}
+}
+
+func TestClaimTargetNames(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		pairs []OrgPair
+		// candidates, migrated and failed are the repository names per pair
+		candidates [][]string
+		migrated   [][]string
+		failed     [][]string
+	}{
+		{
+			name:       "two sources into one target",
+			pairs:      []OrgPair{{Source: "a", Target: "target"}, {Source: "b", Target: "Target"}},
+			candidates: [][]string{{"api", "web"}, {"API", "web", "docs"}},
+			migrated:   [][]string{{"api", "web"}, {"docs"}},
+			failed:     [][]string{nil, {"API", "web"}},
+		},
+		{
+			name:       "two sources into one target with prefixes",
+			pairs:      []OrgPair{{Source: "a", Target: "target", Prefix: "a-"}, {Source: "b", Target: "target", Prefix: "b-"}},
+			candidates: [][]string{{"api", "web"}, {"API", "web", "docs"}},
+			migrated:   [][]string{{"api", "web"}, {"API", "web", "docs"}},
+			failed:     [][]string{nil, nil},
+		},
+		{
+			name:       "prefix that collides with a name",
+			pairs:      []OrgPair{{Source: "a", Target: "target"}, {Source: "b", Target: "target", Prefix: "a-"}},
+			candidates: [][]string{{"api", "a-web"}, {"web", "docs"}},
+			migrated:   [][]string{{"api", "a-web"}, {"docs"}},
+			failed:     [][]string{nil, {"web"}},
+		},
+		{
+			name:       "two targets",
+			pairs:      []OrgPair{{Source: "a", Target: "target"}, {Source: "b", Target: "other"}},
+			candidates: [][]string{{"api", "web"}, {"API", "web", "docs"}},
+			migrated:   [][]string{{"api", "web"}, {"API", "web", "docs"}},
+			failed:     [][]string{nil, nil},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			em := enterpriseFixture(tc.pairs...)
+			candidates := make([][]github.Repository, len(tc.pairs))
+			for i, names := range tc.candidates {
+				candidates[i] = repositories(names...)
+			}
+			results := make([]migrationResult, len(tc.pairs))
+
+			claimed := em.claimTargetNames(candidates, results)
+
+			for i := range tc.pairs {
+				if got := repositoryNames(claimed[i]); !slices.Equal(got, tc.migrated[i]) {
+					t.Errorf("%s: got %q to migrate, want %q", tc.pairs[i], got, tc.migrated[i])
+				}
+
+				var failed []string
+				for _, status := range results[i].Failed {
+					failed = append(failed, status.Name)
+				}
+				if !slices.Equal(failed, tc.failed[i]) {
+					t.Errorf("%s: got %q failed, want %q", tc.pairs[i], failed, tc.failed[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// seatWarningRatio is the share of the available GHAS seats from which
+// preflight warns
+const seatWarningRatio = 0.9
+
+type ghasEstimate struct {
+	Timestamp time.Time            `json:"timestamp"`
+	SourceOrg string               `json:"sourceOrg"`
+	Targets   []ghasTargetEstimate `json:"targets"`
+}
+
+// ghasTargetEstimate is the GHAS license impact of the repositories migrated
+// to one target organization
+type ghasTargetEstimate struct {
+	TargetOrg string `json:"targetOrg"`
+	// Repositories is the number of private and internal repositories that
+	// get GHAS at target. Public repositories do not use licenses.
+	Repositories int `json:"repositories"`
+	// WithoutCommitterData lists the repositories without GHAS at source,
+	// their committers are not known and not counted
+	WithoutCommitterData []string `json:"withoutCommitterData,omitempty"`
+	// SourceCommitters is the number of unique active committers of the
+	// repositories
+	SourceCommitters int `json:"sourceCommitters"`
+	// CurrentCommitters is the number of active committers at target
+	CurrentCommitters int `json:"currentCommitters"`
+	// NewCommitters are the committers that do not use a license at target yet
+	NewCommitters []string `json:"newCommitters"`
+	// PurchasedSeats and AvailableSeats are nil if the target does not report
+	// purchased licenses
+	PurchasedSeats *int `json:"purchasedSeats,omitempty"`
+	AvailableSeats *int `json:"availableSeats,omitempty"`
+	Exceeds        bool `json:"exceeds"`
+}
+
+// EstimateGHAS estimates the GHAS licenses that the migrated repositories
+// would use at their target. Committers are taken from the active committers
+// of the source, so only repositories with GHAS at source are counted.
+func (om OrgMigration) EstimateGHAS(ctx context.Context) (ghasEstimate, error) {
+	if err := om.md.requireGitHubSource(); err != nil {
+		return ghasEstimate{}, err
+	}
+
+	plan, err := om.planRepositories(ctx)
+	if err != nil {
+		return ghasEstimate{}, err
+	}
+
+	estimate, err := om.estimateGHAS(ctx, plan)
+	if err != nil {
+		return ghasEstimate{}, err
+	}
+
+	for _, target := range estimate.Targets {
+		slog.Info("GHAS estimate", "target", target.TargetOrg, "repositories", target.Repositories,
+			"newCommitters", len(target.NewCommitters), "currentCommitters", target.CurrentCommitters,
+			"withoutCommitterData", len(target.WithoutCommitterData), "exceeds", target.Exceeds)
+	}
+
+	return estimate, nil
+}
+
+func (om OrgMigration) estimateGHAS(ctx context.Context, plan repositoryPlan) (ghasEstimate, error) {
+	source, err := om.md.orgs.sourceGC.GetAdvancedSecurityBilling(ctx, om.md.orgs.source)
+	if err != nil {
+		return ghasEstimate{}, fmt.Errorf("error fetching GHAS active committers of %s: %w", om.md.orgs.source, err)
+	}
+
+	estimate := ghasEstimate{SourceOrg: om.md.orgs.source}
+	targets := make(map[string]int)
+	var committers []map[string]string
+	for i, md := range om.targetMigrations() {
+		targets[strings.ToLower(md.orgs.target)] = i
+		estimate.Targets = append(estimate.Targets, ghasTargetEstimate{TargetOrg: md.orgs.target})
+		committers = append(committers, make(map[string]string))
+	}
+
+	for _, repository := range plan.toMigrate {
+		if stringValue(repository.Visibility) == "public" {
+			continue
+		}
+
+		i := targets[strings.ToLower(om.migrationFor(repository).orgs.target)]
+		estimate.Targets[i].Repositories++
+
+		logins, ok := source.Committers[*repository.Name]
+		if !ok {
+			estimate.Targets[i].WithoutCommitterData = append(estimate.Targets[i].WithoutCommitterData, *repository.Name)
+			continue
+		}
+		for _, login := range logins {
+			committers[i][strings.ToLower(login)] = login
+		}
+	}
+
+	for i, md := range om.targetMigrations() {
+		target, err := md.orgs.targetGC.GetAdvancedSecurityBilling(ctx, md.orgs.target)
+		if err != nil {
+			return ghasEstimate{}, fmt.Errorf("error fetching GHAS active committers of %s: %w", md.orgs.target, err)
+		}
+
+		current := make(map[string]bool)
+		for _, logins := range target.Committers {
+			for _, login := range logins {
+				current[strings.ToLower(login)] = true
+			}
+		}
+
+		te := &estimate.Targets[i]
+		te.SourceCommitters = len(committers[i])
+		te.CurrentCommitters = target.TotalCommitters
+		te.NewCommitters = []string{}
+		for key, login := range committers[i] {
+			if !current[key] {
+				te.NewCommitters = append(te.NewCommitters, login)
+			}
+		}
+		slices.Sort(te.NewCommitters)
+
+		if target.PurchasedCommitters != nil {
+			available := max(*target.PurchasedCommitters-target.TotalCommitters, 0)
+			te.PurchasedSeats = target.PurchasedCommitters
+			te.AvailableSeats = &available
+			te.Exceeds = len(te.NewCommitters) > available
+		}
+	}
+
+	estimate.Timestamp = time.Now().UTC()
+
+	return estimate, nil
+}
+
+// checkSeats reports whether the new committers fit in the available seats
+func (te ghasTargetEstimate) checkSeats() preflightCheck {
+	check := preflightCheck{Name: "GHAS seats " + te.TargetOrg, Status: PreflightPass}
+	newCommitters := len(te.NewCommitters)
+
+	switch {
+	case te.Exceeds:
+		check.Status = PreflightFail
+		check.Message = fmt.Sprintf("%d new active committers exceed the %d available seats (%d purchased)", newCommitters, *te.AvailableSeats, *te.PurchasedSeats)
+	case te.AvailableSeats == nil:
+		check.Status = PreflightWarn
+		check.Message = fmt.Sprintf("%d new active committers, the target does not report purchased seats", newCommitters)
+	case float64(newCommitters) >= seatWarningRatio*float64(*te.AvailableSeats) && newCommitters > 0:
+		check.Status = PreflightWarn
+		check.Message = fmt.Sprintf("%d new active committers use most of the %d available seats", newCommitters, *te.AvailableSeats)
+	default:
+		check.Message = fmt.Sprintf("%d new active committers, %d seats available", newCommitters, *te.AvailableSeats)
+	}
+
+	if len(te.WithoutCommitterData) > 0 && check.Status != PreflightFail {
+		check.Status = PreflightWarn
+		check.Message += fmt.Sprintf(", %d repositories have no GHAS at source and their committers are not counted", len(te.WithoutCommitterData))
+		check.Details = te.WithoutCommitterData
+	}
+
+	return check
+}
@@ -0,0 +1,205 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/pkg/worker"
+)
+
+// inventoryRow describes a source repository with the settings and objects
+// the migration steps work on
+type inventoryRow struct {
+	Name                  string    `json:"name"`
+	Visibility            string    `json:"visibility"`
+	Archived              bool      `json:"archived"`
+	Fork                  bool      `json:"fork"`
+	SizeKB                int       `json:"sizeKB"`
+	DefaultBranch         string    `json:"defaultBranch"`
+	PushedAt              time.Time `json:"pushedAt"`
+	AdvancedSecurity      string    `json:"advancedSecurity"`
+	SecretScanning        string    `json:"secretScanning"`
+	PushProtection        string    `json:"pushProtection"`
+	CodeScanningAnalyses  int       `json:"codeScanningAnalyses"`
+	ActiveWorkflows       int       `json:"activeWorkflows"`
+	BranchProtectionRules int       `json:"branchProtectionRules"`
+	Environments          int       `json:"environments"`
+	Webhooks              int       `json:"webhooks"`
+	Secrets               int       `json:"secrets"`
+	Collaborators         int       `json:"collaborators"`
+	Teams                 int       `json:"teams"`
+	LFS                   bool      `json:"lfs"`
+	OpenPullRequests      int       `json:"openPullRequests"`
+	// Errors lists the values that could not be read, they are left at zero
+	Errors []string `json:"errors,omitempty"`
+}
+
+type inventory []inventoryRow
+
+var inventoryColumns = []string{
+	"name", "visibility", "archived", "fork", "sizeKB", "defaultBranch", "pushedAt",
+	"advancedSecurity", "secretScanning", "pushProtection", "codeScanningAnalyses", "activeWorkflows",
+	"branchProtectionRules", "environments", "webhooks", "secrets", "collaborators", "teams", "lfs",
+	"openPullRequests", "errors",
+}
+
+// Inventory returns a row for every repository of the source organization
+// that matches the repository filter. Repositories are read by
+// options.Concurrency.MaxWorkers workers. Only the source settings of conn
+// are used.
+func Inventory(ctx context.Context, conn Connection, options Options) (inventory, error) {
+	if conn.Provider != nil {
+		return nil, fmt.Errorf("%s source: %w", conn.Provider.Name(), ErrUnsupportedSource)
+	}
+
+	sourceGC, err := github.NewGitHubClient(ctx, slog.Default(), conn.SourceCredentials,
+		github.ClientOptions{Name: "source", APIURL: conn.SourceAPIURL})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("fetching repositories from source organization", "source", conn.SourceOrg)
+	repositories, err := sourceGC.GetRepositories(ctx, conn.SourceOrg)
+	if err != nil {
+		return nil, err
+	}
+	repositories = options.Filter.apply(repositories)
+
+	pool, err := worker.NewPool(options.Concurrency.MaxWorkers, options.Concurrency.JobTimeout, inventoryProcessor(sourceGC, conn.SourceOrg))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repository := range repositories {
+		pool.Submit(repository, 0)
+	}
+	pool.Close()
+
+	var rows inventory
+	for result := range pool.Start(ctx) {
+		if errors.Is(result.Err, worker.ErrNotStarted) {
+			continue
+		}
+
+		row := result.Value
+		if result.Err != nil {
+			// the processor panicked or timed out
+			row = newInventoryRow(result.Job)
+			row.Errors = append(row.Errors, result.Err.Error())
+		}
+		rows = append(rows, row)
+
+		progress := pool.Progress()
+		slog.Info("progress", "done", progress.Succeeded+progress.Failed, "queued", progress.Queued)
+	}
+
+	slices.SortFunc(rows, func(a, b inventoryRow) int { return strings.Compare(a.Name, b.Name) })
+
+	if ctx.Err() != nil {
+		return rows, ErrInterrupted
+	}
+
+	slog.Info(strconv.Itoa(len(rows))+" repositories in inventory", "source", conn.SourceOrg)
+
+	return rows, nil
+}
+
+func inventoryProcessor(gc *github.GitHubClient, org string) worker.Processor[github.Repository, inventoryRow] {
+	return func(repository github.Repository, ctx context.Context) (inventoryRow, error) {
+		row := newInventoryRow(repository)
+		slog.Debug("reading repository", "name", row.Name)
+
+		if row.DefaultBranch != "" {
+			analyses, err := gc.GetCodeScanningAnalysis(ctx, org, row.Name, row.DefaultBranch)
+			if err != nil {
+				row.Errors = append(row.Errors, "codeScanningAnalyses: "+err.Error())
+			}
+			row.CodeScanningAnalyses = len(analyses)
+		}
+
+		workflows, err := gc.GetAllActiveWorkflowsForRepository(ctx, org, row.Name)
+		if err != nil {
+			row.Errors = append(row.Errors, "activeWorkflows: "+err.Error())
+		}
+		row.ActiveWorkflows = len(workflows)
+
+		counts, errs := gc.GetRepositoryCounts(ctx, org, row.Name)
+		row.BranchProtectionRules = counts.BranchProtectionRules
+		row.Environments = counts.Environments
+		row.Webhooks = counts.Webhooks
+		row.Secrets = counts.Secrets
+		row.Collaborators = counts.Collaborators
+		row.Teams = counts.Teams
+		row.LFS = counts.LFS
+		row.OpenPullRequests = counts.OpenPullRequests
+		for name, err := range errs {
+			row.Errors = append(row.Errors, name+": "+err.Error())
+		}
+		slices.Sort(row.Errors)
+
+		return row, nil
+	}
+}
+
+func newInventoryRow(repository github.Repository) inventoryRow {
+	state := newRepoState(repository)
+	row := inventoryRow{
+		Name:             *repository.Name,
+		Visibility:       state.Visibility,
+		Archived:         state.Archived,
+		Fork:             repository.Fork != nil && *repository.Fork,
+		DefaultBranch:    stringValue(repository.DefaultBranch),
+		AdvancedSecurity: state.CodeScanning,
+		SecretScanning:   state.SecretScanning,
+		PushProtection:   state.PushProtection,
+	}
+
+	if repository.Size != nil {
+		row.SizeKB = *repository.Size
+	}
+	if repository.PushedAt != nil {
+		row.PushedAt = repository.PushedAt.UTC()
+	}
+
+	return row
+}
+
+// WriteCSV writes the inventory as CSV with a header row
+func (inv inventory) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(inventoryColumns); err != nil {
+		return err
+	}
+
+	for _, row := range inv {
+		pushedAt := ""
+		if !row.PushedAt.IsZero() {
+			pushedAt = row.PushedAt.Format(time.RFC3339)
+		}
+
+		record := []string{
+			row.Name, row.Visibility, strconv.FormatBool(row.Archived), strconv.FormatBool(row.Fork),
+			strconv.Itoa(row.SizeKB), row.DefaultBranch, pushedAt,
+			row.AdvancedSecurity, row.SecretScanning, row.PushProtection,
+			strconv.Itoa(row.CodeScanningAnalyses), strconv.Itoa(row.ActiveWorkflows),
+			strconv.Itoa(row.BranchProtectionRules), strconv.Itoa(row.Environments), strconv.Itoa(row.Webhooks),
+			strconv.Itoa(row.Secrets), strconv.Itoa(row.Collaborators), strconv.Itoa(row.Teams),
+			strconv.FormatBool(row.LFS), strconv.Itoa(row.OpenPullRequests), strings.Join(row.Errors, "; "),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,294 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// How StepLockSource makes a source repository read-only
+const (
+	// LockModeArchive archives the repository while GEI migrates it
+	LockModeArchive = "archive"
+	// LockModePermissions downgrades all teams and direct collaborators to
+	// read until the migration finished. Organization owners, organization
+	// roles and the base permission of the organization are not changed and
+	// can still push.
+	LockModePermissions = "permissions"
+)
+
+// LockModes are the names of the lock modes
+var LockModes = []string{LockModeArchive, LockModePermissions}
+
+// What happens to a locked source repository that was migrated
+const (
+	// LockReleaseArchive restores the permissions and archives the source
+	LockReleaseArchive = "archive"
+	// LockReleaseRestore restores the source and points its description to
+	// the target
+	LockReleaseRestore = "restore"
+)
+
+// LockReleases are the names of the lock release policies
+var LockReleases = []string{LockReleaseArchive, LockReleaseRestore}
+
+// SourceLock configures StepLockSource
+type SourceLock struct {
+	// Mode is one of LockModes, empty for LockModeArchive
+	Mode string
+	// Release is one of LockReleases, empty for LockReleaseArchive. Sources
+	// that failed are always restored.
+	Release string
+}
+
+// Validate returns an error for an unknown mode or release policy
+func (l SourceLock) Validate() error {
+	if l.Mode != "" && !slices.Contains(LockModes, l.Mode) {
+		return fmt.Errorf("unknown lock mode %q, expected one of %s", l.Mode, strings.Join(LockModes, ", "))
+	}
+	if l.Release != "" && !slices.Contains(LockReleases, l.Release) {
+		return fmt.Errorf("unknown lock release %q, expected one of %s", l.Release, strings.Join(LockReleases, ", "))
+	}
+	return nil
+}
+
+// LockJournalFileName is the file in the output directory the locked source
+// repositories are recorded in
+const LockJournalFileName = "source-lock-journal.json"
+
+// lockEntry is a locked source repository with the permissions it had before
+type lockEntry struct {
+	Organization string    `json:"organization"`
+	Repository   string    `json:"repository"`
+	Mode         string    `json:"mode"`
+	LockedAt     time.Time `json:"lockedAt"`
+	// Teams and Collaborators hold the permissions that were downgraded, by
+	// team slug and login
+	Teams         map[string]string `json:"teams,omitempty"`
+	Collaborators map[string]string `json:"collaborators,omitempty"`
+}
+
+// lockJournal keeps the locked source repositories in a file, so that they can
+// be released after a crash. It is shared by all workers.
+type lockJournal struct {
+	path string
+	mu   sync.Mutex
+}
+
+// lockJournals holds the journal of every file, as the organizations of an
+// enterprise migration are migrated at the same time
+var lockJournals sync.Map
+
+func newLockJournal(outputDir string) *lockJournal {
+	path := filepath.Join(outputDir, LockJournalFileName)
+	journal, _ := lockJournals.LoadOrStore(path, &lockJournal{path: path})
+	return journal.(*lockJournal)
+}
+
+func (j *lockJournal) read() (map[string]lockEntry, error) {
+	entries := make(map[string]lockEntry)
+
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid lock journal %s: %w", j.path, err)
+	}
+
+	return entries, nil
+}
+
+// update applies f to the entries by organization/repository and writes them
+// back. The file is removed once it has no entries.
+func (j *lockJournal) update(f func(entries map[string]lockEntry)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.read()
+	if err != nil {
+		return err
+	}
+
+	f(entries)
+
+	if len(entries) == 0 {
+		if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	jsonData, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, jsonData, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, j.path)
+}
+
+// lockSource makes a source repository read-only and records how in the
+// journal. The journal is written before the repository is changed, so a
+// crash in between leaves at most an entry that restores what was not
+// changed.
+func (md MigrationData) lockSource(ctx context.Context, repositoryName string) error {
+	entry := lockEntry{
+		Organization: md.orgs.source,
+		Repository:   repositoryName,
+		Mode:         md.options.Lock.Mode,
+		LockedAt:     time.Now().UTC(),
+	}
+	if entry.Mode == "" {
+		entry.Mode = LockModeArchive
+	}
+
+	if entry.Mode == LockModePermissions {
+		teams, err := md.orgs.sourceGC.GetTeamPermissions(ctx, md.orgs.source, repositoryName)
+		if err != nil {
+			return err
+		}
+		collaborators, err := md.orgs.sourceGC.GetCollaboratorPermissions(ctx, md.orgs.source, repositoryName)
+		if err != nil {
+			return err
+		}
+
+		entry.Teams = writable(teams)
+		entry.Collaborators = writable(collaborators)
+	}
+
+	if err := md.locks.update(func(entries map[string]lockEntry) {
+		entries[entry.Organization+"/"+entry.Repository] = entry
+	}); err != nil {
+		return err
+	}
+
+	return lock(ctx, md.orgs.sourceGC, entry)
+}
+
+// writable returns the permissions that are not read
+func writable(permissions map[string]string) map[string]string {
+	filtered := make(map[string]string)
+	for name, permission := range permissions {
+		if permission != github.PermissionRead {
+			filtered[name] = permission
+		}
+	}
+	return filtered
+}
+
+func lock(ctx context.Context, gc *github.GitHubClient, entry lockEntry) error {
+	if entry.Mode == LockModeArchive {
+		return gc.ArchiveRepository(ctx, entry.Organization, entry.Repository)
+	}
+
+	for team := range entry.Teams {
+		if err := gc.SetTeamPermission(ctx, entry.Organization, entry.Repository, team, github.PermissionRead); err != nil {
+			return fmt.Errorf("team %s: %w", team, err)
+		}
+	}
+	for user := range entry.Collaborators {
+		if err := gc.SetCollaboratorPermission(ctx, entry.Organization, entry.Repository, user, github.PermissionRead); err != nil {
+			return fmt.Errorf("collaborator %s: %w", user, err)
+		}
+	}
+
+	return nil
+}
+
+// unlockSource restores a source repository locked by lockSource and removes
+// it from the journal
+func (md MigrationData) unlockSource(ctx context.Context, repositoryName string) error {
+	return releaseLock(ctx, md.orgs.sourceGC, md.locks, md.orgs.source+"/"+repositoryName)
+}
+
+func releaseLock(ctx context.Context, gc *github.GitHubClient, journal *lockJournal, key string) error {
+	journal.mu.Lock()
+	entries, err := journal.read()
+	journal.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	entry, ok := entries[key]
+	if !ok {
+		return nil
+	}
+
+	if entry.Mode == LockModeArchive {
+		err = gc.UnarchiveRepository(ctx, entry.Organization, entry.Repository)
+	} else {
+		for team, permission := range entry.Teams {
+			if err = gc.SetTeamPermission(ctx, entry.Organization, entry.Repository, team, permission); err != nil {
+				err = fmt.Errorf("team %s: %w", team, err)
+				break
+			}
+		}
+		for user, permission := range entry.Collaborators {
+			if err != nil {
+				break
+			}
+			if err = gc.SetCollaboratorPermission(ctx, entry.Organization, entry.Repository, user, permission); err != nil {
+				err = fmt.Errorf("collaborator %s: %w", user, err)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return journal.update(func(entries map[string]lockEntry) { delete(entries, key) })
+}
+
+// ReleaseSourceLocks restores all source repositories recorded in the lock
+// journal of the output directory of options, e.g. after a migration
+// crashed. Only the source settings of conn are used.
+func ReleaseSourceLocks(ctx context.Context, conn Connection, options Options) error {
+	sourceGC, err := github.NewGitHubClient(ctx, slog.Default(), conn.SourceCredentials,
+		github.ClientOptions{Name: "source", APIURL: conn.SourceAPIURL})
+	if err != nil {
+		return err
+	}
+
+	journal := newLockJournal(options.OutputDir)
+	entries, err := journal.read()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var errs []error
+	for _, key := range keys {
+		if err := releaseLock(ctx, sourceGC, journal, key); err != nil {
+			slog.Error("failed to release source lock", "repository", key, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		slog.Info("released source lock", "repository", key, "mode", entries[key].Mode)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,232 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// fakeSource is a source repository source/repo with teams and direct
+// collaborators by permission, served by a fake GitHub API
+type fakeSource struct {
+	mu            sync.Mutex
+	archived      bool
+	teams         map[string]string
+	collaborators map[string]string
+	// failing makes changes of the permission of a collaborator fail
+	failing string
+}
+
+// roles maps permissions to the role names collaborators are listed with
+var roles = map[string]string{github.PermissionRead: "read", github.PermissionWrite: "write"}
+
+func (s *fakeSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var body struct {
+		Permission string `json:"permission"`
+		Archived   bool   `json:"archived"`
+	}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v3")
+	switch {
+	case r.Method == http.MethodGet && path == "/repos/source/repo/teams":
+		var teams []map[string]string
+		for slug, permission := range s.teams {
+			teams = append(teams, map[string]string{"slug": slug, "permission": permission})
+		}
+		json.NewEncoder(w).Encode(teams)
+	case r.Method == http.MethodGet && path == "/repos/source/repo/collaborators":
+		var users []map[string]string
+		for login, permission := range s.collaborators {
+			role := permission
+			if name, ok := roles[permission]; ok {
+				role = name
+			}
+			users = append(users, map[string]string{"login": login, "role_name": role})
+		}
+		json.NewEncoder(w).Encode(users)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/orgs/source/teams/"):
+		slug := strings.Split(strings.TrimPrefix(path, "/orgs/source/teams/"), "/")[0]
+		s.teams[slug] = body.Permission
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/repos/source/repo/collaborators/"):
+		login := strings.TrimPrefix(path, "/repos/source/repo/collaborators/")
+		if login == s.failing {
+			http.Error(w, `{"message": "server error"}`, http.StatusInternalServerError)
+			return
+		}
+		s.collaborators[login] = body.Permission
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPatch && path == "/repos/source/repo":
+		s.archived = body.Archived
+		json.NewEncoder(w).Encode(map[string]any{"name": "repo", "archived": s.archived})
+	default:
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	}
+}
+
+// lockFixture returns a migration of the organization source with the lock
+// journal in a temporary directory and the connection to the fake API
+func lockFixture(t *testing.T, source *fakeSource, mode string) (MigrationData, Connection, Options) {
+	t.Helper()
+
+	server := httptest.NewServer(source)
+	t.Cleanup(server.Close)
+
+	pool, err := github.NewCredentialPool(github.NewPATCredential("source-pat", "token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := Connection{SourceOrg: "source", SourceAPIURL: server.URL, SourceCredentials: pool}
+	options := Options{OutputDir: t.TempDir(), Lock: SourceLock{Mode: mode}}
+
+	var md MigrationData
+	md.orgs.source = "source"
+	md.options = options
+	md.locks = newLockJournal(options.OutputDir)
+	if md.orgs.sourceGC, err = github.NewGitHubClient(context.Background(), slog.Default(), pool,
+		github.ClientOptions{Name: "source", APIURL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	return md, conn, options
+}
+
+func readJournal(t *testing.T, md MigrationData) map[string]lockEntry {
+	t.Helper()
+
+	entries, err := md.locks.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestLockPermissionsRoundTrip(t *testing.T) {
+	teams := map[string]string{"developers": "push", "admins": "admin", "readers": "pull"}
+	collaborators := map[string]string{"alice": "admin", "bob": "pull", "carol": "maintain"}
+	source := &fakeSource{teams: maps.Clone(teams), collaborators: maps.Clone(collaborators)}
+	md, _, _ := lockFixture(t, source, LockModePermissions)
+	ctx := context.Background()
+
+	if err := md.lockSource(ctx, "repo"); err != nil {
+		t.Fatalf("lockSource: %v", err)
+	}
+
+	for name, permissions := range map[string]map[string]string{"team": source.teams, "collaborator": source.collaborators} {
+		for key, permission := range permissions {
+			if permission != github.PermissionRead {
+				t.Errorf("%s %s has %s while locked, want %s", name, key, permission, github.PermissionRead)
+			}
+		}
+	}
+
+	entry, ok := readJournal(t, md)["source/repo"]
+	if !ok {
+		t.Fatal("lock is not in the journal")
+	}
+	if entry.Mode != LockModePermissions {
+		t.Errorf("got mode %s, want %s", entry.Mode, LockModePermissions)
+	}
+	// read permissions are not changed and not recorded
+	if want := map[string]string{"developers": "push", "admins": "admin"}; !maps.Equal(entry.Teams, want) {
+		t.Errorf("got teams %v in the journal, want %v", entry.Teams, want)
+	}
+	if want := map[string]string{"alice": "admin", "carol": "maintain"}; !maps.Equal(entry.Collaborators, want) {
+		t.Errorf("got collaborators %v in the journal, want %v", entry.Collaborators, want)
+	}
+
+	if err := md.unlockSource(ctx, "repo"); err != nil {
+		t.Fatalf("unlockSource: %v", err)
+	}
+
+	if !maps.Equal(source.teams, teams) {
+		t.Errorf("got teams %v after unlocking, want %v", source.teams, teams)
+	}
+	if !maps.Equal(source.collaborators, collaborators) {
+		t.Errorf("got collaborators %v after unlocking, want %v", source.collaborators, collaborators)
+	}
+	if _, err := os.Stat(md.locks.path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal is kept after the last lock was released: %v", err)
+	}
+}
+
+func TestLockArchiveRoundTrip(t *testing.T) {
+	source := &fakeSource{}
+	md, _, _ := lockFixture(t, source, "")
+	ctx := context.Background()
+
+	if err := md.lockSource(ctx, "repo"); err != nil {
+		t.Fatalf("lockSource: %v", err)
+	}
+	if !source.archived {
+		t.Error("source is not archived while locked")
+	}
+	if entry := readJournal(t, md)["source/repo"]; entry.Mode != LockModeArchive {
+		t.Errorf("got mode %q in the journal, want %s", entry.Mode, LockModeArchive)
+	}
+
+	if err := md.unlockSource(ctx, "repo"); err != nil {
+		t.Fatalf("unlockSource: %v", err)
+	}
+	if source.archived {
+		t.Error("source is still archived after unlocking")
+	}
+	if entries := readJournal(t, md); len(entries) != 0 {
+		t.Errorf("got %d journal entries after unlocking, want none", len(entries))
+	}
+}
+
+func TestFailedReleaseIsKeptInTheJournal(t *testing.T) {
+	source := &fakeSource{teams: map[string]string{}, collaborators: map[string]string{"alice": "push"}}
+	md, conn, options := lockFixture(t, source, LockModePermissions)
+	ctx := context.Background()
+
+	if err := md.lockSource(ctx, "repo"); err != nil {
+		t.Fatalf("lockSource: %v", err)
+	}
+
+	source.failing = "alice"
+	if err := md.unlockSource(ctx, "repo"); err == nil {
+		t.Fatal("unlockSource did not fail")
+	}
+	if _, ok := readJournal(t, md)["source/repo"]; !ok {
+		t.Fatal("lock that could not be released was removed from the journal")
+	}
+
+	// the journal left behind restores the source later on
+	source.failing = ""
+	if err := ReleaseSourceLocks(ctx, conn, options); err != nil {
+		t.Fatalf("ReleaseSourceLocks: %v", err)
+	}
+	if source.collaborators["alice"] != "push" {
+		t.Errorf("got %s for alice after releasing, want push", source.collaborators["alice"])
+	}
+	if entries := readJournal(t, md); len(entries) != 0 {
+		t.Errorf("got %d journal entries after releasing, want none", len(entries))
+	}
+}
+
+func TestUnlockWithoutLock(t *testing.T) {
+	md, _, _ := lockFixture(t, &fakeSource{}, LockModePermissions)
+
+	// nothing is recorded, so nothing is requested from the API
+	if err := md.unlockSource(context.Background(), "repo"); err != nil {
+		t.Errorf("unlockSource: %v", err)
+	}
+}
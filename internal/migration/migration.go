@@ -2,17 +2,30 @@ package migration
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/pkg/logging"
+	"github.com/gateixeira/gei-migration-helper/pkg/worker"
 )
 
 type orgs struct {
 	source, target     string
 	sourceGC, targetGC *github.GitHubClient
+	// sourceGit and targetGit are used by git level verification
+	sourceGit, targetGit github.GitHost
+	// home is the target organization of the migration, target may differ
+	// for routed repositories
+	home string
 }
 
 type migrationResult struct {
@@ -21,20 +34,286 @@ type migrationResult struct {
 	TargetOrg string       `json:"targetOrg"`
 	Migrated  []repoStatus `json:"migrated"`
 	Failed    []repoStatus `json:"failed"`
+	// Degraded lists the repositories that were migrated but differ from
+	// their source, see StepVerify, whose optional steps failed or whose
+	// workflows have lint findings
+	Degraded []repoStatus `json:"degraded,omitempty"`
+	// Skipped lists the repositories that needed no changes
+	Skipped []repoStatus `json:"skipped,omitempty"`
+	// Pending lists the repositories that were not processed because the
+	// migration was interrupted
+	Pending     []repoStatus `json:"pending,omitempty"`
+	Interrupted bool         `json:"interrupted,omitempty"`
+	// Error is set when the organization could not be migrated at all
+	Error string `json:"error,omitempty"`
+}
+
+// IsZero reports whether mr holds no outcome, because the migration failed
+// before its repositories were processed
+func (mr migrationResult) IsZero() bool {
+	return mr.Timestamp.IsZero()
+}
+
+// forTarget returns the part of the result that was migrated to target.
+// Repositories without a target organization belong to the default target.
+func (mr migrationResult) forTarget(target string, isDefault bool) migrationResult {
+	belongs := func(statuses []repoStatus) []repoStatus {
+		var filtered []repoStatus
+		for _, status := range statuses {
+			if strings.EqualFold(status.TargetOrg, target) || (isDefault && status.TargetOrg == "") {
+				filtered = append(filtered, status)
+			}
+		}
+		return filtered
+	}
+
+	targetResult := mr
+	targetResult.TargetOrg = target
+	targetResult.Migrated = belongs(mr.Migrated)
+	targetResult.Failed = belongs(mr.Failed)
+	targetResult.Degraded = belongs(mr.Degraded)
+	targetResult.Skipped = belongs(mr.Skipped)
+	targetResult.Pending = belongs(mr.Pending)
+
+	return targetResult
+}
+
+// LoadMigrationResult reads a result file written by a previous migration
+func LoadMigrationResult(path string) (migrationResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return migrationResult{}, err
+	}
+
+	var mr migrationResult
+	if err := json.Unmarshal(data, &mr); err != nil {
+		return migrationResult{}, fmt.Errorf("invalid result file %s: %w", path, err)
+	}
+
+	return mr, nil
 }
 
 type repoStatus struct {
-	Name           string `json:"name"`
-	ID             int64  `json:"id"`
+	Name       string `json:"name"`
+	TargetName string `json:"targetName,omitempty"`
+	// TargetOrg is set for repositories routed to another organization than
+	// the target of the migration
+	TargetOrg       string       `json:"targetOrg,omitempty"`
+	ID              int64        `json:"id"`
+	Archived        bool         `json:"archived"`
+	MigrationID     string       `json:"migrationId,omitempty"`
+	StartedAt       time.Time    `json:"startedAt"`
+	FinishedAt      time.Time    `json:"finishedAt"`
+	DurationSeconds float64      `json:"durationSeconds"`
+	Steps           []stepStatus `json:"steps,omitempty"`
+	FailedStep      string       `json:"failedStep,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	ErrorCategory   string       `json:"errorCategory,omitempty"`
+	SkipReason      string       `json:"skipReason,omitempty"`
+	// SourceDrift lists the source branches that changed during the last
+	// migration of the repository, see DriftPolicies
+	SourceDrift string `json:"sourceDrift,omitempty"`
+	// Deferrals is the number of times the repository was moved to the back
+	// of the queue because its source was busy, see StepWaitForIdle
+	Deferrals int `json:"deferrals,omitempty"`
+	// Remigrations is the number of times the repository was migrated again
+	// because its source changed
+	Remigrations int `json:"remigrations,omitempty"`
+	// UnmappedReferences lists the references to the source that
+	// StepRewriteReferences left as they are, as file:line: reference: reason
+	UnmappedReferences []string `json:"unmappedReferences,omitempty"`
+	// ReferencesPullRequest is the pull request with the rewritten references
+	ReferencesPullRequest string `json:"referencesPullRequest,omitempty"`
+	// Degraded is set if a verification check or an optional step failed or
+	// a workflow has lint findings
+	Degraded bool `json:"degraded,omitempty"`
+	// Warnings lists the optional steps that failed, as step: error
+	Warnings     []string      `json:"warnings,omitempty"`
+	Verification []verifyCheck `json:"verification,omitempty"`
+	// WorkflowFindings lists the reasons workflows will fail at target
+	WorkflowFindings []workflowFinding `json:"workflowFindings,omitempty"`
+	Before           repoState         `json:"before"`
+	After            *repoState        `json:"after,omitempty"`
+}
+
+// repoState is a snapshot of the visibility and GHAS settings of a repository
+type repoState struct {
+	Visibility     string `json:"visibility"`
 	Archived       bool   `json:"archived"`
 	CodeScanning   string `json:"codeScanning" default:"disabled"`
 	SecretScanning string `json:"secretScanning" default:"disabled"`
 	PushProtection string `json:"pushProtection" default:"disabled"`
 }
 
+type stepStatus struct {
+	Name            string    `json:"name"`
+	StartedAt       time.Time `json:"startedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Retries         int       `json:"retries"`
+	Error           string    `json:"error,omitempty"`
+}
+
+const (
+	errorCategoryCanceled   = "canceled"
+	errorCategoryDrift      = "drift"
+	errorCategoryBusy       = "busy"
+	errorCategoryTimeout    = "timeout"
+	errorCategoryGEI        = "gei"
+	errorCategoryPermission = "permission"
+	errorCategoryNotFound   = "not_found"
+	errorCategoryValidation = "validation"
+	errorCategoryRateLimit  = "rate_limit"
+	errorCategoryServer     = "server"
+	errorCategoryAPI        = "api"
+	errorCategoryUnknown    = "unknown"
+)
+
+func newRepoStatus(repository github.Repository) repoStatus {
+	return repoStatus{
+		Name:      *repository.Name,
+		ID:        *repository.ID,
+		Archived:  *repository.Archived,
+		StartedAt: time.Now().UTC(),
+		Before:    newRepoState(repository),
+	}
+}
+
+func newRepoState(repository github.Repository) repoState {
+	state := repoState{
+		Visibility:     stringValue(repository.Visibility),
+		Archived:       repository.Archived != nil && *repository.Archived,
+		CodeScanning:   "disabled",
+		SecretScanning: "disabled",
+		PushProtection: "disabled",
+	}
+
+	sa := repository.SecurityAndAnalysis
+	if sa == nil {
+		return state
+	}
+
+	if sa.AdvancedSecurity != nil {
+		state.CodeScanning = stringValue(sa.AdvancedSecurity.Status)
+	}
+	if sa.SecretScanning != nil {
+		state.SecretScanning = stringValue(sa.SecretScanning.Status)
+	}
+	if sa.SecretScanningPushProtection != nil {
+		state.PushProtection = stringValue(sa.SecretScanningPushProtection.Status)
+	}
+
+	return state
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// fail records the step that failed, unless a failing step was already recorded
+func (rs *repoStatus) fail(stepName string, err error) {
+	if rs == nil || rs.FailedStep != "" {
+		return
+	}
+
+	rs.FailedStep = stepName
+	rs.Error = err.Error()
+	rs.ErrorCategory = errorCategory(err)
+}
+
+// migrationStep returns the last GEI migration step of the repository. ok
+// is true if it succeeded.
+func (rs repoStatus) migrationStep() (step stepStatus, ok bool) {
+	for i := len(rs.Steps) - 1; i >= 0; i-- {
+		if rs.Steps[i].Name == "migrating" {
+			return rs.Steps[i], rs.Steps[i].Error == ""
+		}
+	}
+	return stepStatus{}, false
+}
+
+// warn records an optional step that failed and marks the repository as
+// degraded
+func (rs *repoStatus) warn(stepName string, err error) {
+	if rs == nil {
+		return
+	}
+
+	rs.Degraded = true
+	rs.Warnings = append(rs.Warnings, stepName+": "+err.Error())
+}
+
+func (rs *repoStatus) finish(err error) {
+	rs.FinishedAt = time.Now().UTC()
+	rs.DurationSeconds = rs.FinishedAt.Sub(rs.StartedAt).Seconds()
+
+	if err != nil {
+		if rs.Error == "" {
+			rs.Error = err.Error()
+		}
+		if rs.ErrorCategory == "" {
+			rs.ErrorCategory = errorCategory(err)
+		}
+	}
+}
+
+func errorCategory(err error) string {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrInterrupted) {
+		return errorCategoryCanceled
+	}
+
+	if errors.Is(err, ErrSourceDrift) {
+		return errorCategoryDrift
+	}
+
+	if errors.Is(err, ErrSourceBusy) {
+		return errorCategoryBusy
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorCategoryTimeout
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return errorCategoryGEI
+	}
+
+	switch code := github.StatusCode(err); {
+	case code == 401 || code == 403:
+		return errorCategoryPermission
+	case code == 404:
+		return errorCategoryNotFound
+	case code == 422:
+		return errorCategoryValidation
+	case code == 429:
+		return errorCategoryRateLimit
+	case code >= 500:
+		return errorCategoryServer
+	case code != 0:
+		return errorCategoryAPI
+	}
+
+	if errors.Is(err, github.ErrBranchProtectionDeletion) {
+		return errorCategoryAPI
+	}
+
+	return errorCategoryUnknown
+}
+
 type MigrationData struct {
-	orgs orgs
-	gei  github.GEI
+	orgs       orgs
+	gei        github.GEI
+	rateLimits *github.RateLimitMonitor
+	// staging is nil when GEI handles the migration archives itself
+	staging *github.ArchiveStaging
+	// provider is nil for GitHub sources
+	provider SourceProvider
+	options  Options
+	// locks records the source repositories locked by StepLockSource
+	locks *lockJournal
 }
 
 type Migration interface {
@@ -42,42 +321,164 @@ type Migration interface {
 }
 
 type errWritter struct {
-	err error
+	err    error
+	status *repoStatus
+	// optional steps mark the repository as degraded when they fail instead
+	// of failing it
+	optional bool
+}
+
+// migrationID returns the ID of the GEI migration recorded in the status, if
+// any
+func (ew *errWritter) migrationID() string {
+	if ew.status == nil {
+		return ""
+	}
+	return ew.status.MigrationID
 }
 
 var maxRetries = 5
 
-func NewMigration(ctx context.Context, sourceOrg, targetOrg, sourceToken, targetToken string) (MigrationData, error) {
-	sourceGC, err := github.NewGitHubClient(ctx, slog.Default(), sourceToken)
+// ErrInterrupted is returned for repositories that were rolled back because
+// the migration was interrupted before they were migrated
+var ErrInterrupted = errors.New("migration interrupted")
+
+// Connection describes the source and target of a migration
+type Connection struct {
+	SourceOrg, TargetOrg                 string
+	SourceCredentials, TargetCredentials *github.CredentialPool
+	// SourceAPIURL and TargetAPIURL are empty for github.com
+	SourceAPIURL, TargetAPIURL string
+	// SourceGitURL and TargetGitURL, if set, replace the git endpoints derived
+	// from the API URLs for git level verification, e.g. file:///srv/git
+	SourceGitURL, TargetGitURL string
+	// GEI holds the storage and SSL settings passed to gh gei. Its API URLs
+	// are taken from the connection.
+	GEI github.GEIOptions
+	// ArchiveStorage, if set, is used to stage the migration archives of the
+	// source instead of the storage options of GEI
+	ArchiveStorage github.ArchiveStorage
+	// Provider is set for sources other than GitHub. SourceOrg then names the
+	// organization or project at the provider and SourceCredentials are not
+	// used.
+	Provider SourceProvider
+}
+
+func NewMigration(ctx context.Context, conn Connection, options Options) (MigrationData, error) {
+	if options.MaxRetries > 0 {
+		maxRetries = options.MaxRetries
+	}
+
+	rateLimits := github.NewRateLimitMonitor()
+
+	var sourceGC *github.GitHubClient
+	if conn.Provider == nil {
+		var err error
+		sourceGC, err = github.NewGitHubClient(ctx, slog.Default(), conn.SourceCredentials,
+			github.ClientOptions{Name: "source", RateLimits: rateLimits, APIURL: conn.SourceAPIURL})
+		if err != nil {
+			slog.Info("error initializing source GitHub Client", "error", err)
+			return MigrationData{}, err
+		}
+	}
+
+	targetGC, err := github.NewGitHubClient(ctx, slog.Default(), conn.TargetCredentials,
+		github.ClientOptions{Name: "target", RateLimits: rateLimits, APIURL: conn.TargetAPIURL})
 	if err != nil {
-		slog.Info("error initializing source GitHub Client", err)
+		slog.Info("error initializing target GitHub Client", "error", err)
 		return MigrationData{}, err
 	}
 
-	targetGC, err := github.NewGitHubClient(ctx, slog.Default(), targetToken)
+	geiOptions := conn.GEI
+	geiOptions.SourceAPIURL = conn.SourceAPIURL
+	geiOptions.TargetAPIURL = conn.TargetAPIURL
+	gei := github.NewGEI(conn.SourceOrg, conn.TargetOrg, conn.SourceCredentials, conn.TargetCredentials, geiOptions)
+
+	var sourceGit github.GitHost
+	if conn.Provider == nil {
+		if sourceGit, err = newGitHost(conn.SourceAPIURL, conn.SourceGitURL, conn.SourceCredentials); err != nil {
+			return MigrationData{}, err
+		}
+	}
+	targetGit, err := newGitHost(conn.TargetAPIURL, conn.TargetGitURL, conn.TargetCredentials)
 	if err != nil {
-		slog.Info("error initializing source GitHub Client", err)
 		return MigrationData{}, err
 	}
 
-	return MigrationData{orgs{sourceOrg, targetOrg, sourceGC, targetGC}, github.NewGEI(sourceOrg, targetOrg, sourceToken, targetToken)}, nil
+	var staging *github.ArchiveStaging
+	if conn.ArchiveStorage != nil && sourceGC != nil {
+		staging = github.NewArchiveStaging(sourceGC, conn.ArchiveStorage, conn.GEI.KeepArchive)
+	}
+
+	return MigrationData{orgs{conn.SourceOrg, conn.TargetOrg, sourceGC, targetGC, sourceGit, targetGit, conn.TargetOrg}, gei, rateLimits, staging, conn.Provider, options, newLockJournal(options.OutputDir)}, nil
 }
 
-func (md MigrationData) processRepoMigration(ctx context.Context, logger *slog.Logger, repository github.Repository) error {
-	logger.Info("migration", "repository", *repository.Name, slog.String("archived", strconv.FormatBool(*repository.Archived)), slog.String("visibility", *repository.Visibility))
+// newGitHost returns the git endpoint of a side, gitURL if it is set
+func newGitHost(apiURL, gitURL string, credentials *github.CredentialPool) (github.GitHost, error) {
+	if gitURL != "" {
+		return github.NewGitHostAt(gitURL, credentials)
+	}
+	return github.NewGitHost(apiURL, credentials)
+}
+
+// processRepoMigration runs all migration steps for a repository. Step
+// timings, retries and failures are recorded in status if it is not nil.
+//
+// Cancelling ctx does not abort the API calls of the migration, only its
+// deadline does. If ctx is cancelled before the repository is handed to GEI,
+// the source is rolled back and ErrInterrupted is returned, otherwise the
+// migration runs to completion.
+//
+// With resume, the repository was migrated by GEI in an earlier run that
+// failed afterwards. GEI is not run again, only the steps around it.
+func (md MigrationData) processRepoMigration(ctx context.Context, logger *slog.Logger, repository github.Repository, status *repoStatus, resume bool) (err error) {
+	if md.provider != nil {
+		return md.processProviderRepoMigration(ctx, logger, repository, status, resume)
+	}
+
+	if md.enabled(StepWaitForIdle) {
+		if err := md.waitForIdle(ctx, logger, repository, status); err != nil {
+			return err
+		}
+	}
+
+	interrupt := ctx
+	ctx = context.WithoutCancel(ctx)
+	if deadline, ok := interrupt.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
 
-	if repository.SecurityAndAnalysis.AdvancedSecurity != nil {
+	targetName := md.targetName(*repository.Name)
+	if status != nil && targetName != *repository.Name {
+		status.TargetName = targetName
+	}
+
+	logger.Info("migration", "repository", *repository.Name, "target", targetName, slog.String("archived", strconv.FormatBool(*repository.Archived)), slog.String("visibility", stringValue(repository.Visibility)))
+
+	ghas := newRepoState(repository)
+
+	// older GitHub Enterprise Server versions, or instances without GHAS, do
+	// not report security and analysis settings
+	sourceHasGHASSettings := repository.SecurityAndAnalysis != nil
+	sourceHasAdvancedSecurity := sourceHasGHASSettings && repository.SecurityAndAnalysis.AdvancedSecurity != nil
+
+	if sourceHasAdvancedSecurity {
 		logger.Info("GHAS Settings",
 			"repository", *repository.Name,
-			slog.String("code Scanning", *repository.SecurityAndAnalysis.AdvancedSecurity.Status),
-			slog.String("secret Scanning", *repository.SecurityAndAnalysis.SecretScanning.Status),
-			slog.String("push Protection", *repository.SecurityAndAnalysis.SecretScanningPushProtection.Status),
-			slog.String("dependabot Updates", *repository.SecurityAndAnalysis.DependabotSecurityUpdates.Status))
+			slog.String("code Scanning", ghas.CodeScanning),
+			slog.String("secret Scanning", ghas.SecretScanning),
+			slog.String("push Protection", ghas.PushProtection))
+	} else if !sourceHasGHASSettings {
+		logger.Info("GHAS settings are not available at source, skipping GHAS steps at source", "repository", *repository.Name)
 	}
 
-	ew := errWritter{}
+	ew := errWritter{status: status}
+
+	migrateCodeScanning := !md.skip(StepMigrateCodeScanning)
 
-	if repository.SecurityAndAnalysis.AdvancedSecurity == nil || *repository.SecurityAndAnalysis.AdvancedSecurity.Status == "disabled" {
+	if migrateCodeScanning && sourceHasGHASSettings && (!sourceHasAdvancedSecurity || ghas.CodeScanning == "disabled") {
 		if *repository.Archived {
 			ew.logAndCallStep(logger, "unarchive source", func() error {
 				return md.orgs.sourceGC.UnarchiveRepository(ctx, md.orgs.source, *repository.Name)
@@ -88,9 +489,12 @@ func (md MigrationData) processRepoMigration(ctx context.Context, logger *slog.L
 		})
 	}
 
-	codeScanningAnalysis, _ := md.orgs.sourceGC.GetCodeScanningAnalysis(ctx, md.orgs.source, *repository.Name, *repository.DefaultBranch)
+	var codeScanningAnalysis []github.ScanningAnalysis
+	if migrateCodeScanning {
+		codeScanningAnalysis, _ = md.orgs.sourceGC.GetCodeScanningAnalysis(ctx, md.orgs.source, *repository.Name, *repository.DefaultBranch)
+	}
 
-	if repository.SecurityAndAnalysis.AdvancedSecurity != nil {
+	if sourceHasAdvancedSecurity {
 		ew.logAndCallStep(logger, "disabling GHAS settings at source", func() error {
 			return md.orgs.sourceGC.ChangeGhasRepoSettings(ctx, md.orgs.source, repository, "disabled", "disabled", "disabled")
 		})
@@ -101,67 +505,121 @@ func (md MigrationData) processRepoMigration(ctx context.Context, logger *slog.L
 
 	if ew.err != nil {
 		logger.Error("failed to get workflows")
+		status.fail("get workflows at source", ew.err)
 		return ew.err
 	}
 
+	if md.skip(StepDisableSourceWorkflows) {
+		// nothing to re-enable later on
+		sourceWorkflows = nil
+	}
+
 	if len(sourceWorkflows) > 0 {
 		ew.logAndCallStep(logger, "disabling workflows at source", func() error {
 			return md.orgs.sourceGC.DisableWorkflowsForRepository(ctx, md.orgs.source, *repository.Name, sourceWorkflows)
 		})
 	}
 
-	ew.logAndCallStep(logger, "migrating", func() error {
-		return md.gei.MigrateRepo(*repository.Name)
-	})
+	if ew.err == nil && interrupt.Err() != nil {
+		logger.Info("migration interrupted, rolling back source", "repository", *repository.Name)
+		reEnableOrigin(ctx, logger, repository, md.orgs.sourceGC, md.orgs.source, sourceWorkflows)
 
-	newRepository, err := md.orgs.targetGC.GetRepository(ctx, *repository.Name, md.orgs.target)
+		if *repository.Archived {
+			ew.logAndCallStep(logger, "archiving source", func() error {
+				return md.orgs.sourceGC.ArchiveRepository(ctx, md.orgs.source, *repository.Name)
+			})
+		}
 
-	if err != nil {
-		logger.Error("failed to migrate")
-		return err
+		status.fail("migrating", ErrInterrupted)
+		return ErrInterrupted
 	}
 
-	var targetWorkflows []github.Workflow
-	targetWorkflows, ew.err = md.orgs.targetGC.GetAllActiveWorkflowsForRepository(ctx, md.orgs.target, *repository.Name)
-
-	if ew.err != nil {
-		logger.Error("failed to get workflows")
-		return ew.err
-	}
+	// the source is locked when it is handed to GEI, the steps before change
+	// settings that cannot be changed on archived repositories. The lock is
+	// released on every return, an error releasing it is returned unless
+	// the migration already failed.
+	released := true
+	release := func() {
+		if released {
+			return
+		}
+		released = true
 
-	if len(targetWorkflows) > 0 {
-		//this is unfortunately necessary as the workflows get re-enabled after org migration
-		ew.logAndCallStep(logger, "disabling workflows at target", func() error {
-			return md.orgs.targetGC.DisableWorkflowsForRepository(ctx, md.orgs.target, *repository.Name, targetWorkflows)
+		rw := errWritter{status: status}
+		rw.logAndCallStep(logger, "releasing source lock", func() error {
+			return md.unlockSource(ctx, *repository.Name)
 		})
+		if ew.err == nil {
+			ew.err = rw.err
+		}
 	}
+	defer func() {
+		release()
+		if err == nil {
+			err = ew.err
+		}
+	}()
 
-	if *newRepository.Archived {
-		ew.logAndCallStep(logger, "unarchive target", func() error {
-			return md.orgs.targetGC.UnarchiveRepository(ctx, md.orgs.target, *repository.Name)
+	if md.enabled(StepLockSource) && !*repository.Archived && ew.err == nil {
+		released = false
+		ew.logAndCallStep(logger, "locking source", func() error {
+			return md.lockSource(ctx, *repository.Name)
 		})
 	}
 
-	ew.logAndCallStep(logger, "deleting branch protections at target", func() error {
-		return md.orgs.targetGC.DeleteBranchProtections(ctx, md.orgs.target, *repository.Name)
-	})
+	// branch heads are recorded when the repository is handed to GEI, pushes
+	// after that are not part of the migration
+	var drift error
+	var heads map[string]string
+	for attempt := 0; ; attempt++ {
+		heads = md.sourceHeads(ctx, logger, repository)
+		if resume {
+			// changes since the earlier run are not detected, only the ones
+			// until the source is archived
+			logger.Info("repository was migrated in an earlier run, skipping GEI", "repository", *repository.Name)
+			break
+		}
+		md.migrate(ctx, logger, &ew, *repository.Name, targetName)
 
-	if *newRepository.Visibility == "private" {
-		ew.logAndCallStep(logger, "changing visibility to internal at target", func() error {
-			return md.orgs.targetGC.ChangeRepositoryVisibility(ctx, md.orgs.target, *repository.Name, "internal")
+		if ew.err != nil || heads == nil {
+			break
+		}
+
+		if drift = md.sourceDrift(ctx, logger, *repository.Name, heads); drift == nil {
+			break
+		}
+		if status != nil {
+			status.SourceDrift = drift.Error()
+		}
+
+		if md.options.DriftPolicy != DriftPolicyRemigrate || attempt == maxRemigrations {
+			logger.Error("source changed during migration", "repository", *repository.Name, "error", drift)
+			break
+		}
+
+		logger.Warn("source changed during migration, migrating again", "repository", *repository.Name, "error", drift)
+		drift = nil
+		ew.logAndCallStep(logger, "deleting target to migrate again", func() error {
+			return md.orgs.targetGC.DeleteRepository(ctx, md.orgs.target, targetName)
 		})
+		if status != nil {
+			status.Remigrations++
+		}
+	}
 
-		logger.Debug("waiting 10 seconds for changes to apply...")
-		time.Sleep(10 * time.Second)
-	} else {
-		logger.Info("skipping visibility change because source is already internal or public")
+	if md.options.Lock.Mode != LockModePermissions {
+		// the remaining steps at source do not work on archived repositories
+		release()
 	}
 
-	ew.logAndCallStep(logger, "activating GHAS at target", func() error {
-		return md.orgs.targetGC.ChangeGhasRepoSettings(ctx, md.orgs.target, newRepository, "enabled", "enabled", "enabled")
-	})
+	newRepository, err := md.setUpTarget(ctx, logger, &ew, targetName)
+	if err != nil {
+		return err
+	}
 
-	if len(codeScanningAnalysis) <= 0 {
+	if !migrateCodeScanning {
+		logger.Info("skipping code scanning migration")
+	} else if len(codeScanningAnalysis) <= 0 {
 		logger.Info("no code scan to migrate, skipping.")
 	} else {
 		logger.Info(fmt.Sprintf("found %d code scanning analysis at source in default branch (%s) before migration", len(codeScanningAnalysis), *repository.DefaultBranch))
@@ -171,13 +629,14 @@ func (md MigrationData) processRepoMigration(ctx context.Context, logger *slog.L
 		})
 
 		ew.logAndCallStep(logger, "migrating code scanning alerts", func() error {
-			return md.gei.MigrateCodeScanning(*repository.Name)
+			return md.gei.MigrateCodeScanning(ctx, *repository.Name, targetName)
 		})
 
-		codeScanningAnalysis, ew.err = md.orgs.targetGC.GetCodeScanningAnalysis(ctx, md.orgs.target, *repository.Name, *repository.DefaultBranch)
+		codeScanningAnalysis, ew.err = md.orgs.targetGC.GetCodeScanningAnalysis(ctx, md.orgs.target, targetName, *repository.DefaultBranch)
 
 		if ew.err != nil {
 			logger.Error("failed to get code scanning analysis")
+			status.fail("get code scanning analysis at target", ew.err)
 			return ew.err
 		}
 
@@ -188,38 +647,206 @@ func (md MigrationData) processRepoMigration(ctx context.Context, logger *slog.L
 		})
 	}
 
+	// verified before the steps that add commits, branches, issues or pull
+	// requests at source or target
+	if ew.err == nil && md.enabled(StepVerify) {
+		logger.Info("verifying target against source", "repository", *repository.Name)
+		checks := md.compareWithSource(ctx, *repository.Name, targetName, false)
+		if status != nil {
+			status.verified(checks)
+		}
+		for _, check := range checks {
+			if check.Status == verifyFail {
+				logger.Warn("target differs from source", "repository", *repository.Name, "check", check.Name,
+					"source", check.Source, "target", check.Target, "message", check.Message)
+			}
+		}
+	}
+
+	if md.enabled(StepTagProvenance) && ew.err == nil {
+		// missing provenance does not fail a migrated repository
+		pw := errWritter{status: status, optional: true}
+		pw.logAndCallStep(logger, "tagging provenance at target", func() error {
+			return md.tagProvenance(ctx, repository, targetName, ew.migrationID())
+		})
+	}
+
+	if md.enabled(StepRewriteReferences) {
+		md.rewriteReferences(ctx, logger, &ew, repository, targetName)
+	}
+
 	if *newRepository.Archived {
 		ew.logAndCallStep(logger, "archive target", func() error {
-			return md.orgs.targetGC.ArchiveRepository(ctx, md.orgs.target, *repository.Name)
+			return md.orgs.targetGC.ArchiveRepository(ctx, md.orgs.target, targetName)
 		})
 	}
 
 	reEnableOrigin(ctx, logger, repository, md.orgs.sourceGC, md.orgs.source, sourceWorkflows)
 
-	//check if repository is not archived
-	if !*repository.Archived {
+	release()
+
+	archiveSource := !md.skip(StepArchiveSource)
+	if md.enabled(StepLockSource) {
+		archiveSource = md.options.Lock.Release != LockReleaseRestore
+	}
+
+	// the source is writable again since GEI finished, or was never locked.
+	// Pushes in the meantime are not at target and would be lost once the
+	// source is archived.
+	if ew.err == nil && drift == nil && heads != nil {
+		if drift = md.sourceDrift(ctx, logger, *repository.Name, heads); drift != nil {
+			logger.Error("source changed after migration", "repository", *repository.Name, "error", drift)
+			if status != nil {
+				status.SourceDrift = drift.Error()
+			}
+		}
+	}
+
+	if !*repository.Archived && drift == nil && ew.err == nil {
+		// the repository is migrated, a notice that cannot be posted, e.g.
+		// because the default branch is protected, does not fail it
+		nw := errWritter{status: status, optional: true}
+		if md.enabled(StepRedirectNotice) {
+			md.postRedirectNotice(ctx, logger, &nw, repository, targetName, md.options.Redirect)
+		} else if md.enabled(StepLockSource) && !archiveSource {
+			// a restored source at least points to its target
+			md.postRedirectNotice(ctx, logger, &nw, repository, targetName, RedirectNotice{Description: md.options.Redirect.Description})
+		}
+	}
+
+	//check if repository is not archived, a source that changed is left
+	//writable for its users
+	if !*repository.Archived && archiveSource && drift == nil {
 		ew.logAndCallStep(logger, "archiving source", func() error {
 			return md.orgs.sourceGC.ArchiveRepository(ctx, md.orgs.source, *repository.Name)
 		})
 	}
 
+	if status != nil {
+		if targetRepository, err := md.orgs.targetGC.GetRepository(ctx, targetName, md.orgs.target); err == nil {
+			after := newRepoState(targetRepository)
+			status.After = &after
+		}
+	}
+
 	if ew.err != nil {
-		logger.Error("error: %v", ew.err)
+		logger.Error("error", "error", ew.err)
 		return ew.err
 	}
 
+	if drift != nil {
+		status.fail("checking source drift", drift)
+		return drift
+	}
+
 	return nil
 }
 
-func (md MigrationData) CheckAndMigrateSecretScanning(ctx context.Context, logger *slog.Logger, repository github.Repository) error {
-	ew := errWritter{}
+// migrate stages the migration archives, if archives are staged, and migrates
+// a repository with GEI. The migration ID is recorded in the status of ew.
+func (md MigrationData) migrate(ctx context.Context, logger *slog.Logger, ew *errWritter, repositoryName, targetName string) {
+	var archives github.StagedArchives
+	if md.staging != nil {
+		ew.logAndCallStep(logger, "staging migration archives", func() error {
+			var err error
+			archives, err = md.staging.Stage(ctx, md.orgs.source, repositoryName)
+			return err
+		})
+
+		if ew.err == nil {
+			defer md.staging.Cleanup(ctx, md.orgs.source, archives)
+		}
+	}
+
+	ew.logAndCallStep(logger, "migrating", func() error {
+		var migrationID string
+		var err error
+		if md.staging != nil {
+			migrationID, err = md.gei.MigrateRepoFromArchives(ctx, repositoryName, targetName, archives)
+		} else {
+			migrationID, err = md.gei.MigrateRepo(ctx, repositoryName, targetName)
+		}
+		if ew.status != nil && migrationID != "" {
+			ew.status.MigrationID = migrationID
+		}
+		return err
+	})
+}
+
+// setUpTarget runs the steps that follow the migration of a repository at
+// target: workflows and branch protections are removed, the visibility is
+// changed to internal and GHAS is activated. The target repository is
+// returned, as it was before these steps.
+func (md MigrationData) setUpTarget(ctx context.Context, logger *slog.Logger, ew *errWritter, repositoryName string) (github.Repository, error) {
+	newRepository, err := md.orgs.targetGC.GetRepository(ctx, repositoryName, md.orgs.target)
+
+	if err != nil {
+		logger.Error("failed to migrate")
+		ew.status.fail("get repository at target", err)
+		return nil, err
+	}
 
-	if *repository.SecurityAndAnalysis.SecretScanning.Status == "enabled" {
-		ew.logAndCallStep(slog.Default(), "migrating secret scanning alerts", func() error {
-			return md.gei.MigrateSecretScanning(*repository.Name)
+	targetWorkflows, err := md.orgs.targetGC.GetAllActiveWorkflowsForRepository(ctx, md.orgs.target, repositoryName)
+
+	if err != nil {
+		logger.Error("failed to get workflows")
+		ew.status.fail("get workflows at target", err)
+		return nil, err
+	}
+
+	if len(targetWorkflows) > 0 {
+		//this is unfortunately necessary as the workflows get re-enabled after org migration
+		ew.logAndCallStep(logger, "disabling workflows at target", func() error {
+			return md.orgs.targetGC.DisableWorkflowsForRepository(ctx, md.orgs.target, repositoryName, targetWorkflows)
+		})
+	}
+
+	if *newRepository.Archived {
+		ew.logAndCallStep(logger, "unarchive target", func() error {
+			return md.orgs.targetGC.UnarchiveRepository(ctx, md.orgs.target, repositoryName)
+		})
+	}
+
+	if !md.skip(StepDeleteBranchProtections) {
+		ew.logAndCallStep(logger, "deleting branch protections at target", func() error {
+			return md.orgs.targetGC.DeleteBranchProtections(ctx, md.orgs.target, repositoryName)
+		})
+	}
+
+	if md.skip(StepChangeVisibility) {
+		logger.Info("skipping visibility change")
+	} else if *newRepository.Visibility == "private" {
+		ew.logAndCallStep(logger, "changing visibility to internal at target", func() error {
+			return md.orgs.targetGC.ChangeRepositoryVisibility(ctx, md.orgs.target, repositoryName, "internal")
+		})
+
+		logger.Debug("waiting 10 seconds for changes to apply...")
+		time.Sleep(10 * time.Second)
+	} else {
+		logger.Info("skipping visibility change because source is already internal or public")
+	}
+
+	if !md.skip(StepActivateGHAS) {
+		ew.logAndCallStep(logger, "activating GHAS at target", func() error {
+			return md.orgs.targetGC.ChangeGhasRepoSettings(ctx, md.orgs.target, newRepository, "enabled", "enabled", "enabled")
+		})
+	}
+
+	return newRepository, nil
+}
+
+func (md MigrationData) CheckAndMigrateSecretScanning(ctx context.Context, logger *slog.Logger, repository github.Repository, status *repoStatus) error {
+	ew := errWritter{status: status}
+
+	if newRepoState(repository).SecretScanning == "enabled" {
+		ew.logAndCallStep(logger, "migrating secret scanning alerts", func() error {
+			return md.gei.MigrateSecretScanning(ctx, *repository.Name, md.targetName(*repository.Name))
 		})
 	} else {
-		slog.Info("skipping because secret scanning is not enabled")
+		logger.Info("skipping because secret scanning is not enabled", "repository", *repository.Name)
+		if status != nil {
+			status.SkipReason = "secret scanning is not enabled"
+		}
 	}
 
 	if ew.err != nil {
@@ -229,71 +856,257 @@ func (md MigrationData) CheckAndMigrateSecretScanning(ctx context.Context, logge
 	return nil
 }
 
-func (md MigrationData) ReactivateTargetWorkflows(ctx context.Context, repository string) error {
-	var repositories []github.Repository
-	if repository == "" {
-		slog.Info("fetching repositories from source organization")
-
-		repositories, _ = md.orgs.sourceGC.GetRepositories(ctx, md.orgs.source)
-	} else {
-		repo, err := md.orgs.sourceGC.GetRepository(ctx, repository, md.orgs.source)
+// sourceRepositories returns the given repository or, if repository is
+// empty, all repositories of the source organization except .github
+func (md MigrationData) sourceRepositories(ctx context.Context, repository string) ([]github.Repository, error) {
+	if repository != "" {
+		repo, err := md.getSourceRepository(ctx, repository)
 
 		if err != nil {
-			slog.Error("error getting repository: "+repository, err)
-			return err
+			slog.Error("error getting repository: "+repository, "error", err)
+			return nil, err
 		}
 
-		repositories = append(repositories, repo)
+		return []github.Repository{repo}, nil
 	}
 
-	for _, repository := range repositories {
-		if *repository.Name == ".github" {
-			continue
+	slog.Info("fetching repositories from source organization")
+	repositories, err := md.getSourceRepositories(ctx)
+
+	if err != nil {
+		slog.Error("error fetching repositories from source organization", "error", err)
+		return nil, err
+	}
+
+	filtered := make([]github.Repository, 0, len(repositories))
+	for _, repo := range repositories {
+		if *repo.Name != ".github" {
+			filtered = append(filtered, repo)
 		}
+	}
 
-		ew := errWritter{}
+	return filtered, nil
+}
 
-		var sourceWorkflows []github.Workflow
-		sourceWorkflows, ew.err = md.orgs.sourceGC.GetAllActiveWorkflowsForRepository(ctx, md.orgs.source, *repository.Name)
+// ReactivateTargetWorkflows enables at target the workflows that are active at
+// source, for a single repository or, if repository is empty, for all
+// repositories of the organization. A failing repository does not stop the
+// others; failures are listed in the returned result. Unless
+// Options.SkipWorkflowLint is set, workflows with lint findings stay disabled
+// and their repositories are listed as degraded, see LintWorkflows.
+// Repositories routed to another organization are reactivated there.
+func (md MigrationData) ReactivateTargetWorkflows(ctx context.Context, repository string) (migrationResult, error) {
+	if err := md.requireGitHubSource(); err != nil {
+		return migrationResult{}, err
+	}
 
-		if ew.err != nil {
-			return ew.err
+	repositories, err := md.sourceRepositories(ctx, repository)
+	if err != nil {
+		return migrationResult{}, err
+	}
+
+	om, err := md.routeRepositories(ctx, repositories)
+	if err != nil {
+		return migrationResult{}, err
+	}
+
+	var orgs map[string]targetActions
+	if !md.options.SkipWorkflowLint {
+		if orgs, err = om.loadRoutedTargetActions(ctx, repositories); err != nil {
+			return migrationResult{}, err
 		}
+	}
 
-		var targetWorkflows []github.Workflow
-		targetWorkflows, ew.err = md.orgs.targetGC.GetAllWorkflowsForRepository(ctx, md.orgs.target, *repository.Name)
+	mr := migrationResult{
+		SourceOrg: md.orgs.source,
+		TargetOrg: md.orgs.target,
+	}
 
-		if ew.err != nil {
-			return ew.err
+	md.processRepositories(ctx, &mr, repositories, md.options.Concurrency, func(repository github.Repository, ctx context.Context) (repoStatus, error) {
+		target := om.migrationFor(repository)
+		var org *targetActions
+		if actions, ok := orgs[strings.ToLower(target.orgs.target)]; ok {
+			org = &actions
+		}
+
+		status, err := target.reactivateRepositoryWorkflows(ctx, org, repository)
+		if !strings.EqualFold(target.orgs.target, md.orgs.target) {
+			status.TargetOrg = target.orgs.target
 		}
+		return status, err
+	}, nil)
 
-		if len(sourceWorkflows) > 0 {
+	mr.Timestamp = time.Now().UTC()
+	mr.Interrupted = ctx.Err() != nil
 
-			// add name of sourceWorkflows to a hash map
-			sourceWorkflowsMap := make(map[string]bool)
-			for _, workflow := range sourceWorkflows {
-				sourceWorkflowsMap[*workflow.Name] = true
+	return mr, nil
+}
+
+// reactivateRepositoryWorkflows enables the workflows of a target repository
+// that are active at source. If org is not nil, workflows with lint findings
+// are left disabled.
+func (md MigrationData) reactivateRepositoryWorkflows(ctx context.Context, org *targetActions, repository github.Repository) (repoStatus, error) {
+	status := newRepoStatus(repository)
+	ew := errWritter{status: &status}
+	logger := logging.NewLoggerFromContext(ctx, false)
+
+	var sourceWorkflows []github.Workflow
+	sourceWorkflows, ew.err = md.orgs.sourceGC.GetAllActiveWorkflowsForRepository(ctx, md.orgs.source, *repository.Name)
+
+	if ew.err != nil {
+		status.fail("get workflows at source", ew.err)
+		status.finish(ew.err)
+		return status, ew.err
+	}
+
+	targetName := md.targetName(*repository.Name)
+
+	var targetWorkflows []github.Workflow
+	targetWorkflows, ew.err = md.orgs.targetGC.GetAllWorkflowsForRepository(ctx, md.orgs.target, targetName)
+
+	if ew.err != nil {
+		status.fail("get workflows at target", ew.err)
+		status.finish(ew.err)
+		return status, ew.err
+	}
+
+	if len(sourceWorkflows) > 0 {
+
+		// add name of sourceWorkflows to a hash map
+		sourceWorkflowsMap := make(map[string]bool)
+		for _, workflow := range sourceWorkflows {
+			sourceWorkflowsMap[*workflow.Name] = true
+		}
+
+		// initialize list of workflows to enable with size of sourceWorkflows
+		workflows := make([]github.Workflow, 0, len(sourceWorkflows))
+		for _, workflow := range targetWorkflows {
+			if _, ok := sourceWorkflowsMap[*workflow.Name]; ok {
+				workflows = append(workflows, workflow)
 			}
+		}
 
-			// initialize list of workflows to enable with size of sourceWorkflows
-			workflows := make([]github.Workflow, 0, len(sourceWorkflows))
-			for _, workflow := range targetWorkflows {
-				if _, ok := sourceWorkflowsMap[*workflow.Name]; ok {
-					workflows = append(workflows, workflow)
-				}
+		if org != nil {
+			ew.logAndCallStep(logger, "linting workflows at target", func() error {
+				var err error
+				status.WorkflowFindings, err = md.lintRepositoryWorkflows(ctx, *org, targetName, workflows)
+				return err
+			})
+
+			for _, finding := range status.WorkflowFindings {
+				logger.Warn("leaving workflow disabled", "repository", targetName, "workflow", finding.Workflow,
+					"job", finding.Job, "check", finding.Check, "message", finding.Message)
 			}
+			status.Degraded = len(status.WorkflowFindings) > 0
 
-			ew.logAndCallStep(slog.Default(), "Enabling workflows at target", func() error {
-				return md.orgs.targetGC.EnableWorkflowsForRepository(ctx, md.orgs.target, *repository.Name, workflows)
+			workflows = slices.DeleteFunc(workflows, func(workflow github.Workflow) bool {
+				return slices.ContainsFunc(status.WorkflowFindings, func(finding workflowFinding) bool {
+					return workflow.Path != nil && finding.Workflow == *workflow.Path
+				})
 			})
 		}
 
-		if ew.err != nil {
-			return ew.err
+		ew.logAndCallStep(logger, "Enabling workflows at target", func() error {
+			return md.orgs.targetGC.EnableWorkflowsForRepository(ctx, md.orgs.target, targetName, workflows)
+		})
+	} else {
+		status.SkipReason = "no active workflows at source"
+	}
+
+	status.finish(ew.err)
+	return status, ew.err
+}
+
+// processRepositories runs process for every repository on a worker pool and
+// adds the outcome to mr. The pool is resized according to the rate limit
+// headroom within the bounds of concurrency. afterEach, if not nil, is called after every
+// repository with the result so far, including the repositories not yet
+// processed as pending. If ctx is cancelled, no new repositories are started
+// and the ones that were not processed are added to mr.Pending.
+func (md MigrationData) processRepositories(ctx context.Context, mr *migrationResult, repositories []github.Repository,
+	concurrency Concurrency, process worker.Processor[github.Repository, repoStatus],
+	afterEach func(migrationResult)) {
+	pool, err := worker.NewPool(concurrency.MaxWorkers, concurrency.JobTimeout, process)
+	if err != nil {
+		slog.Error("error creating worker pool", "error", err)
+		mr.Pending = append(mr.Pending, pendingRepositories(repositories, nil)...)
+		return
+	}
+	if concurrency.Limiter != nil {
+		pool.SetLimiter(concurrency.Limiter)
+	}
+
+	for _, repository := range repositories {
+		pool.Submit(repository, 0)
+	}
+	pool.Close()
+
+	throttleCtx, stopThrottle := context.WithCancel(ctx)
+	defer stopThrottle()
+	go adaptConcurrency(throttleCtx, pool, md.rateLimits, concurrency)
+
+	processed := make(map[int64]bool)
+	for workerResult := range pool.Start(ctx) {
+		slog.Debug("result received")
+		if errors.Is(workerResult.Err, worker.ErrNotStarted) {
+			// interrupted while waiting for a slot, reported as pending
+			continue
+		}
+
+		if errors.Is(workerResult.Err, worker.ErrDeferred) {
+			// queued again by the pool, pending until it runs
+			slog.Info("repository deferred", "name", *workerResult.Job.Name, "reason", workerResult.Err)
+		} else {
+			status := workerResult.Value
+			if status.Name == "" {
+				// the processor panicked or timed out before returning a status
+				status = newRepoStatus(workerResult.Job)
+				status.finish(workerResult.Err)
+			} else if errors.Is(workerResult.Err, worker.ErrJobTimeout) {
+				// the step that failed once the deadline expired is not the cause
+				status.ErrorCategory = errorCategoryTimeout
+			}
+			processed[status.ID] = true
+
+			switch {
+			case workerResult.Err != nil:
+				mr.Failed = append(mr.Failed, status)
+			case status.Degraded:
+				mr.Degraded = append(mr.Degraded, status)
+			case status.SkipReason != "":
+				mr.Skipped = append(mr.Skipped, status)
+			default:
+				mr.Migrated = append(mr.Migrated, status)
+			}
+		}
+
+		progress := pool.Progress()
+		slog.Info("progress", "succeeded", progress.Succeeded, "failed", progress.Failed,
+			"running", progress.Running, "queued", progress.Queued, "deferred", progress.Deferred, "workers", progress.Workers)
+
+		if afterEach != nil {
+			checkpoint := *mr
+			checkpoint.Pending = append(checkpoint.Pending, pendingRepositories(repositories, processed)...)
+			afterEach(checkpoint)
 		}
 	}
 
-	return nil
+	mr.Pending = append(mr.Pending, pendingRepositories(repositories, processed)...)
+}
+
+func pendingRepositories(repositories []github.Repository, processed map[int64]bool) []repoStatus {
+	var pending []repoStatus
+	for _, repository := range repositories {
+		if !processed[*repository.ID] {
+			pending = append(pending, repoStatus{
+				Name:     *repository.Name,
+				ID:       *repository.ID,
+				Archived: *repository.Archived,
+				Before:   newRepoState(repository),
+			})
+		}
+	}
+	return pending
 }
 
 func (ew *errWritter) logAndCallStep(logger *slog.Logger, stepName string, f func() error) {
@@ -302,7 +1115,10 @@ func (ew *errWritter) logAndCallStep(logger *slog.Logger, stepName string, f fun
 	}
 	logger.Debug(stepName)
 
+	step := stepStatus{Name: stepName, StartedAt: time.Now().UTC()}
+
 	for i := 0; i < maxRetries; i++ {
+		step.Retries = i
 		ew.err = f()
 		if ew.err == nil {
 			break
@@ -313,8 +1129,21 @@ func (ew *errWritter) logAndCallStep(logger *slog.Logger, stepName string, f fun
 		logger.Debug(fmt.Sprintf("retrying %d/%d...", i+1, maxRetries))
 	}
 
+	if ew.status != nil {
+		step.DurationSeconds = time.Since(step.StartedAt).Seconds()
+		if ew.err != nil {
+			step.Error = ew.err.Error()
+		}
+		ew.status.Steps = append(ew.status.Steps, step)
+	}
+
 	if ew.err != nil {
-		logger.Error("%s error: %v", stepName, ew.err)
+		logger.Error(stepName+" error", "error", ew.err)
+		if ew.optional {
+			ew.status.warn(stepName, ew.err)
+		} else {
+			ew.status.fail(stepName, ew.err)
+		}
 		return
 	}
 	logger.Debug(fmt.Sprintf("done: %s", stepName))
@@ -324,12 +1153,11 @@ func reEnableOrigin(ctx context.Context, logger *slog.Logger,
 	repository github.Repository, sourceGC *github.GitHubClient, sourceOrg string, workflows []github.Workflow) {
 	ew := errWritter{}
 
-	if repository.SecurityAndAnalysis.AdvancedSecurity != nil {
+	if repository.SecurityAndAnalysis != nil && repository.SecurityAndAnalysis.AdvancedSecurity != nil {
+		ghas := newRepoState(repository)
 		ew.logAndCallStep(logger, "resetting GHAS settings at source", func() error {
 			return sourceGC.ChangeGhasRepoSettings(ctx, sourceOrg, repository,
-				*repository.SecurityAndAnalysis.AdvancedSecurity.Status,
-				*repository.SecurityAndAnalysis.SecretScanning.Status,
-				*repository.SecurityAndAnalysis.SecretScanningPushProtection.Status)
+				ghas.CodeScanning, ghas.SecretScanning, ghas.PushProtection)
 		})
 	}
 
@@ -0,0 +1,172 @@
+package migration
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// Options are the settings of a migration beyond its source and target
+type Options struct {
+	MaxRetries  int
+	Concurrency Concurrency
+	Filter      RepositoryFilter
+	// SkipSteps lists the optional steps that are not run, see Steps
+	SkipSteps []string
+	// EnableSteps lists the opt-in steps that are run, see OptInSteps
+	EnableSteps []string
+	// Redirect configures StepRedirectNotice
+	Redirect RedirectNotice
+	// Provenance configures StepTagProvenance
+	Provenance Provenance
+	// References configures StepRewriteReferences
+	References ReferenceRewrite
+	// Lock configures StepLockSource
+	Lock SourceLock
+	// Busy configures StepWaitForIdle
+	Busy BusyGate
+	// DriftPolicy decides what happens to repositories whose source changed
+	// while they were migrated, see DriftPolicies. Empty for DriftPolicyFail.
+	DriftPolicy string
+	// SkipWorkflowLint reactivates workflows at target without linting them
+	SkipWorkflowLint bool
+	// VerifyGit adds a comparison of all git refs of mirror clones to the
+	// verification of repositories
+	VerifyGit bool
+	// RepositoryMappings maps source repository names to target repository
+	// names. Repositories that are not mapped keep their name.
+	RepositoryMappings map[string]string
+	// TargetPrefix is prepended to the target name of repositories that are
+	// not mapped, to avoid collisions when several sources are consolidated
+	// into one target
+	TargetPrefix string
+	// Routing sends repositories to other organizations than the target of
+	// the migration
+	Routing Routing
+	// OutputDir is the directory the checkpoint file is written to. Empty
+	// for the working directory.
+	OutputDir string
+}
+
+// Optional steps of a repository migration that can be skipped
+const (
+	StepDisableSourceWorkflows  = "disable-source-workflows"
+	StepDeleteBranchProtections = "delete-branch-protections"
+	StepChangeVisibility        = "change-visibility"
+	StepActivateGHAS            = "activate-ghas"
+	StepMigrateCodeScanning     = "migrate-code-scanning"
+	StepArchiveSource           = "archive-source"
+)
+
+// Steps are the names of the optional steps
+var Steps = []string{
+	StepDisableSourceWorkflows,
+	StepDeleteBranchProtections,
+	StepChangeVisibility,
+	StepActivateGHAS,
+	StepMigrateCodeScanning,
+	StepArchiveSource,
+}
+
+// Opt-in steps of a repository migration that only run when enabled
+const (
+	StepWaitForIdle       = "wait-for-idle"
+	StepLockSource        = "lock-source"
+	StepRedirectNotice    = "redirect-notice"
+	StepTagProvenance     = "tag-provenance"
+	StepRewriteReferences = "rewrite-references"
+	StepVerify            = "verify"
+)
+
+// OptInSteps are the names of the opt-in steps
+var OptInSteps = []string{
+	StepWaitForIdle,
+	StepLockSource,
+	StepRedirectNotice,
+	StepTagProvenance,
+	StepRewriteReferences,
+	StepVerify,
+}
+
+// ValidateStep returns an error if name is not an optional step
+func ValidateStep(name string) error {
+	if !slices.Contains(Steps, name) {
+		return fmt.Errorf("unknown step %q, expected one of %s", name, strings.Join(Steps, ", "))
+	}
+	return nil
+}
+
+// ValidateOptInStep returns an error if name is not an opt-in step
+func ValidateOptInStep(name string) error {
+	if !slices.Contains(OptInSteps, name) {
+		return fmt.Errorf("unknown step %q, expected one of %s", name, strings.Join(OptInSteps, ", "))
+	}
+	return nil
+}
+
+// RepositoryFilter selects repositories by name with glob patterns as
+// understood by path.Match. A repository is selected if it matches any
+// include pattern, or there are none, and no exclude pattern.
+type RepositoryFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Validate returns an error for the first malformed pattern
+func (f RepositoryFilter) Validate() error {
+	for _, pattern := range append(append([]string(nil), f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid repository pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (f RepositoryFilter) Matches(name string) bool {
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return (len(f.Include) == 0 || matches(f.Include)) && !matches(f.Exclude)
+}
+
+func (f RepositoryFilter) apply(repositories []github.Repository) []github.Repository {
+	if len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return repositories
+	}
+
+	filtered := make([]github.Repository, 0, len(repositories))
+	for _, repo := range repositories {
+		if f.Matches(*repo.Name) {
+			filtered = append(filtered, repo)
+		}
+	}
+
+	return filtered
+}
+
+// skip reports whether an optional step is disabled
+func (md MigrationData) skip(step string) bool {
+	return slices.Contains(md.options.SkipSteps, step)
+}
+
+// enabled reports whether an opt-in step is enabled
+func (md MigrationData) enabled(step string) bool {
+	return slices.Contains(md.options.EnableSteps, step)
+}
+
+// targetName returns the name of a source repository at target
+func (md MigrationData) targetName(repository string) string {
+	if name, ok := md.options.RepositoryMappings[repository]; ok && name != "" {
+		return name
+	}
+	return md.options.TargetPrefix + repository
+}
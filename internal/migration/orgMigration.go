@@ -3,9 +3,13 @@ package migration
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gateixeira/gei-migration-helper/internal/github"
@@ -14,98 +18,229 @@ import (
 )
 
 type OrgMigration struct {
-	parallelMigrations int
-	md                 MigrationData
+	md MigrationData
+	// targets holds the migration of every target organization of the
+	// routing table by lower case organization name
+	targets map[string]MigrationData
+	// routes maps the IDs of routed repositories to their target. It is
+	// filled before repositories are processed and only read afterwards.
+	routes map[int64]string
+	// resumed holds, by ID, the previous status of repositories that
+	// RetryFailed retries without migrating them again, as GEI migrated them
+	// before they failed
+	resumed map[int64]repoStatus
 }
 
-const statusRepoName = "migration-status"
-
-func NewOrgMigration(ctx context.Context, source, target, sourceToken, targetToken string, retries int, parallelMigrations int) (OrgMigration, error) {
-	maxRetries = retries
+const (
+	statusRepoName     = "migration-status"
+	checkpointFileName = "migration-checkpoint.json"
+	maxIssueBodyLength = 65536
+)
 
-	sourceGC, err := github.NewGitHubClient(ctx, slog.Default(), sourceToken)
+func NewOrgMigration(ctx context.Context, conn Connection, options Options) (OrgMigration, error) {
+	md, err := NewMigration(ctx, conn, options)
 	if err != nil {
-		slog.Info("error initializing source GitHub Client", err)
 		return OrgMigration{}, err
 	}
 
-	targetGC, err := github.NewGitHubClient(ctx, slog.Default(), targetToken)
-	if err != nil {
-		slog.Info("error initializing source GitHub Client", err)
-		return OrgMigration{}, err
+	return newOrgMigration(md)
+}
+
+// newOrgMigration returns an organization migration with a migration for
+// every target organization of the routing table of md
+func newOrgMigration(md MigrationData) (OrgMigration, error) {
+	om := OrgMigration{md: md, targets: make(map[string]MigrationData), routes: make(map[int64]string), resumed: make(map[int64]repoStatus)}
+	if md.options.Routing.isEmpty() {
+		om.targets[strings.ToLower(md.orgs.target)] = md
+		return om, nil
+	}
+
+	if err := md.requireGitHubSource(); err != nil {
+		return OrgMigration{}, fmt.Errorf("routing: %w", err)
+	}
+
+	om.md = md.forTarget(md.orgs.target)
+	om.targets[strings.ToLower(md.orgs.target)] = om.md
+	for _, target := range md.options.Routing.targets() {
+		if _, ok := om.targets[strings.ToLower(target)]; !ok {
+			om.targets[strings.ToLower(target)] = md.forTarget(target)
+		}
 	}
 
-	return OrgMigration{parallelMigrations, MigrationData{orgs{
-		source, target, sourceGC, targetGC}, github.NewGEI(source, target, sourceToken, targetToken)}}, nil
+	return om, nil
 }
 
-func (om OrgMigration) checkOngoing(ctx context.Context) error {
-	slog.Info("looking for ongoing/past migration")
-	repo, err := om.md.orgs.targetGC.GetRepository(ctx, statusRepoName, om.md.orgs.target)
+// targetMigrations returns the migration of the target organization first,
+// followed by the other targets of the routing table
+func (om OrgMigration) targetMigrations() []MigrationData {
+	migrations := []MigrationData{om.md}
+	for _, target := range om.md.options.Routing.targets() {
+		if !strings.EqualFold(target, om.md.orgs.target) {
+			migrations = append(migrations, om.targets[strings.ToLower(target)])
+		}
+	}
+	return migrations
+}
+
+// migrationFor returns the migration of the target a repository is routed to
+func (om OrgMigration) migrationFor(repository github.Repository) MigrationData {
+	if target, ok := om.routes[*repository.ID]; ok {
+		return om.targets[target]
+	}
+	return om.md
+}
+
+// resolveRoutes routes repositories according to the routing table
+func (om OrgMigration) resolveRoutes(ctx context.Context, repositories []github.Repository) error {
+	routing := om.md.options.Routing
+	if routing.isEmpty() {
+		return nil
+	}
+
+	var properties map[string]map[string]any
+	if routing.usesProperties() {
+		var err error
+		properties, err = om.md.orgs.sourceGC.GetCustomPropertyValues(ctx, om.md.orgs.source)
+		if err != nil {
+			return fmt.Errorf("error fetching custom properties: %w", err)
+		}
+	}
+
+	for _, repository := range repositories {
+		if route, ok := routing.route(repository, properties[*repository.Name]); ok {
+			om.routes[*repository.ID] = strings.ToLower(route.Target)
+		}
+	}
+
+	return nil
+}
+
+func (md MigrationData) checkOngoing(ctx context.Context) error {
+	slog.Info("looking for ongoing/past migration", "target", md.orgs.target)
+	repo, err := md.orgs.targetGC.GetRepository(ctx, statusRepoName, md.orgs.target)
 
 	if err != nil && err.Error() != github.ErrRepositoryNotFound.Error() {
-		slog.Error("error fetching migration status repository", err)
+		slog.Error("error fetching migration status repository", "error", err)
 		return err
 	}
 
 	if err == nil && *repo.Name == statusRepoName {
-		issue, _ := om.md.orgs.targetGC.GetIssue(ctx, om.md.orgs.target, statusRepoName, 1)
+		issue, _ := md.orgs.targetGC.GetIssue(ctx, md.orgs.target, statusRepoName, 1)
 
 		if issue != nil {
-			err := fmt.Errorf("a migration to this organization was already executed. Please check http://github.com/%s/%s/issues/1 for status", om.md.orgs.target, statusRepoName)
+			err := fmt.Errorf("a migration to this organization was already executed. Please check http://github.com/%s/%s/issues/1 for status", md.orgs.target, statusRepoName)
 			slog.Error(err.Error())
 			return err
 		}
 
-		err := fmt.Errorf("a migration to this organization is either ongoing or finished in error (remove http://github.com/%s/%s if you want to retry)", om.md.orgs.target, statusRepoName)
+		err := fmt.Errorf("a migration to this organization is either ongoing or finished in error (remove http://github.com/%s/%s if you want to retry)", md.orgs.target, statusRepoName)
 		return err
 	}
 
-	slog.Info("creating migration status repository")
-	om.md.orgs.targetGC.CreateRepository(ctx, om.md.orgs.target, statusRepoName)
-
 	return nil
 }
 
 func (om OrgMigration) prepareMigration(ctx context.Context) error {
-	if err := om.checkOngoing(ctx); err != nil {
-		return err
+	// all targets are checked before any status repository is created
+	for _, md := range om.targetMigrations() {
+		if err := md.checkOngoing(ctx); err != nil {
+			return err
+		}
 	}
 
-	slog.Info("deactivating GHAS settings at target organization")
-	om.md.orgs.targetGC.ChangeGHASOrgSettings(ctx, om.md.orgs.target, false)
+	for _, md := range om.targetMigrations() {
+		slog.Info("creating migration status repository", "target", md.orgs.target)
+		md.orgs.targetGC.CreateRepository(ctx, md.orgs.target, statusRepoName)
+	}
+
+	if om.md.provider != nil {
+		slog.Info("source is " + om.md.provider.Name())
+	} else if version, err := om.md.orgs.sourceGC.ServerVersion(ctx); err == nil && version != "" {
+		slog.Info("source is GitHub Enterprise Server", "version", version)
+	}
+
+	om.deactivateTargetGHAS(ctx)
 
 	return nil
 }
 
-func (om OrgMigration) Process(repo interface{}, ctx context.Context) error {
-	repository, ok := repo.(github.Repository)
-	if !ok {
-		return fmt.Errorf("could not cast repository to github.Repository")
+func (om OrgMigration) deactivateTargetGHAS(ctx context.Context) {
+	for _, md := range om.targetMigrations() {
+		slog.Info("deactivating GHAS settings at target organization", "target", md.orgs.target)
+		md.orgs.targetGC.ChangeGHASOrgSettings(ctx, md.orgs.target, false)
 	}
+}
 
-	var repoSummary = repoStatus{
-		Name:     *repository.Name,
-		ID:       *repository.ID,
-		Archived: *repository.Archived,
+func (om OrgMigration) Process(repository github.Repository, ctx context.Context) (repoStatus, error) {
+	md := om.migrationFor(repository)
+	repoSummary := newRepoStatus(repository)
+	if md.orgs.target != om.md.orgs.target {
+		repoSummary.TargetOrg = md.orgs.target
 	}
 
-	if repository.SecurityAndAnalysis.AdvancedSecurity != nil {
-		repoSummary.CodeScanning = *repository.SecurityAndAnalysis.AdvancedSecurity.Status
-		repoSummary.SecretScanning = *repository.SecurityAndAnalysis.SecretScanning.Status
-		repoSummary.PushProtection = *repository.SecurityAndAnalysis.SecretScanningPushProtection.Status
+	previous, resume := om.resumed[*repository.ID]
+	if resume {
+		// the GEI migration of the earlier run is kept on record
+		step, _ := previous.migrationStep()
+		repoSummary.MigrationID = previous.MigrationID
+		repoSummary.Steps = append(repoSummary.Steps, step)
 	}
 
-	slog.Info("starting migration", "name", *repository.Name)
+	slog.Info("starting migration", "name", *repository.Name, "target", md.orgs.target)
 	logger := logging.NewLoggerFromContext(ctx, false)
-	err := om.md.processRepoMigration(ctx, logger, repository)
-	slog.Info("finished migrating", "name", *repository.Name)
+	err := md.processRepoMigration(ctx, logger, repository, &repoSummary, resume)
+	if errors.Is(err, worker.ErrDeferred) {
+		return repoSummary, err
+	}
+	repoSummary.finish(err)
+	slog.Info("finished migrating", "name", *repository.Name, "duration", repoSummary.FinishedAt.Sub(repoSummary.StartedAt))
 	if err != nil {
-		slog.Error("error migrating repository: ", err)
-		return err
+		slog.Error("error migrating repository", "error", err)
+		return repoSummary, err
 	}
 
-	return nil
+	return repoSummary, nil
+}
+
+// resultIssueBody renders the migration result for the status issue. Step
+// telemetry and verification checks are left out when the full result would
+// not fit in an issue body.
+func resultIssueBody(mr migrationResult) (string, error) {
+	jsonData, err := json.MarshalIndent(mr, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if len(jsonData) <= maxIssueBodyLength {
+		return string(jsonData), nil
+	}
+
+	summary := mr
+	summary.Migrated = summarizeStatuses(mr.Migrated)
+	summary.Failed = summarizeStatuses(mr.Failed)
+	summary.Degraded = summarizeStatuses(mr.Degraded)
+
+	jsonData, err = json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if len(jsonData) > maxIssueBodyLength {
+		return fmt.Sprintf("%d repositories migrated, %d degraded, %d failed. Check migration-result.json for details",
+			len(mr.Migrated), len(mr.Degraded), len(mr.Failed)), nil
+	}
+
+	return string(jsonData), nil
+}
+
+func summarizeStatuses(statuses []repoStatus) []repoStatus {
+	summarized := make([]repoStatus, len(statuses))
+	for i, status := range statuses {
+		status.Steps = nil
+		status.Verification = nil
+		summarized[i] = status
+	}
+	return summarized
 }
 
 func (om OrgMigration) Migrate(ctx context.Context) (migrationResult, error) {
@@ -113,89 +248,268 @@ func (om OrgMigration) Migrate(ctx context.Context) (migrationResult, error) {
 		return migrationResult{}, err
 	}
 
-	slog.Info("fetching repositories from source organization")
-	sourceRepositories, err := om.md.orgs.sourceGC.GetRepositories(ctx, om.md.orgs.source)
-
+	sourceRepositoriesToMigrate, collisions, err := om.repositoriesToMigrate(ctx)
 	if err != nil {
-		slog.Error("error fetching repositories from source organization")
 		return migrationResult{}, err
 	}
 
-	destinationRepositories, err := om.md.orgs.targetGC.GetRepositories(ctx, om.md.orgs.target)
+	mr := migrationResult{
+		SourceOrg: om.md.orgs.source,
+		TargetOrg: om.md.orgs.target,
+		Failed:    collisions,
+	}
+
+	om.migrateRepositories(ctx, &mr, sourceRepositoriesToMigrate)
+
+	return om.finishMigration(ctx, "Migration result", mr)
+}
+
+// repositoryPlan matches the repositories of the source with their targets
+type repositoryPlan struct {
+	// toMigrate are the repositories that do not exist at their target yet
+	toMigrate []github.Repository
+	// existing are the repositories that already exist at their target, as
+	// org/name of the target repository
+	existing []string
+	// caseMismatches are the existing target repositories whose name differs
+	// from the target name of their source only in case
+	caseMismatches []string
+	// collisions are the repositories that would get the same name at target
+	// as another repository
+	collisions []repoStatus
+}
+
+// repositoriesToMigrate returns the repositories of the source that do not
+// exist at their target yet. Repositories that would get the same name at
+// target as another repository are returned as failed.
+func (om OrgMigration) repositoriesToMigrate(ctx context.Context) ([]github.Repository, []repoStatus, error) {
+	plan, err := om.planRepositories(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range plan.existing {
+		slog.Info("repository " + name + " already exists at target organization")
+	}
+
+	slog.Info(strconv.Itoa(len(plan.toMigrate))+" repositories to migrate", "source", om.md.orgs.source)
+
+	return plan.toMigrate, plan.collisions, nil
+}
+
+// planRepositories routes the repositories of the source and compares their
+// target names with the repositories of every target. Repository names are
+// compared case insensitively.
+func (om OrgMigration) planRepositories(ctx context.Context) (repositoryPlan, error) {
+	slog.Info("fetching repositories from source organization", "source", om.md.orgs.source)
+	sourceRepositories, err := om.md.getSourceRepositories(ctx)
 
 	if err != nil {
-		slog.Error("error fetching repositories from target organization")
-		return migrationResult{}, err
+		slog.Error("error fetching repositories from source organization")
+		return repositoryPlan{}, err
 	}
 
-	m := make(map[string]bool)
-	for _, item := range destinationRepositories {
-		m[*item.Name] = true
+	if err := om.resolveRoutes(ctx, sourceRepositories); err != nil {
+		return repositoryPlan{}, err
 	}
-	var sourceRepositoriesToMigrate []github.Repository
+
+	// names of the target repositories by lower case name
+	existing := make(map[string]map[string]string)
+	claimed := make(map[string]string)
+
+	var plan repositoryPlan
 	for _, item := range sourceRepositories {
-		if _, ok := m[*item.Name]; !ok {
-			sourceRepositoriesToMigrate = append(sourceRepositoriesToMigrate, item)
-		} else {
-			slog.Info("repository " + *item.Name + " already exists at target organization")
+		md := om.migrationFor(item)
+		target := strings.ToLower(md.orgs.target)
+
+		if _, ok := existing[target]; !ok {
+			destinationRepositories, err := md.orgs.targetGC.GetRepositories(ctx, md.orgs.target)
+			if err != nil {
+				slog.Error("error fetching repositories from target organization", "target", md.orgs.target)
+				return repositoryPlan{}, err
+			}
+
+			existing[target] = make(map[string]string)
+			for _, repository := range destinationRepositories {
+				existing[target][strings.ToLower(*repository.Name)] = *repository.Name
+			}
 		}
+
+		targetName := md.targetName(*item.Name)
+		if name, ok := existing[target][strings.ToLower(targetName)]; ok {
+			plan.existing = append(plan.existing, md.orgs.target+"/"+name)
+			if name != targetName {
+				plan.caseMismatches = append(plan.caseMismatches, fmt.Sprintf("%s/%s (target of %s)", md.orgs.target, name, *item.Name))
+			}
+			continue
+		}
+
+		key := target + "/" + strings.ToLower(targetName)
+		if other, ok := claimed[key]; ok {
+			err := fmt.Errorf("%s/%s is also the target of %s, set a repository mapping", md.orgs.target, targetName, other)
+			slog.Error("name collision", "repository", *item.Name, "error", err)
+
+			status := newRepoStatus(item)
+			status.TargetName = targetName
+			if md.orgs.target != om.md.orgs.target {
+				status.TargetOrg = md.orgs.target
+			}
+			status.fail("checking name collisions", err)
+			status.finish(err)
+			plan.collisions = append(plan.collisions, status)
+			continue
+		}
+		claimed[key] = *item.Name
+
+		plan.toMigrate = append(plan.toMigrate, item)
 	}
 
-	slog.Info(strconv.Itoa(len(sourceRepositoriesToMigrate)) + " repositories to migrate")
+	return plan, nil
+}
 
-	jobs := make(chan interface{}, len(sourceRepositoriesToMigrate))
-	results := make(chan worker.Error, len(sourceRepositoriesToMigrate))
+// RetryFailed migrates again the repositories that failed or were left
+// pending in a previous run and merges the outcome with the previous result.
+// Repositories that failed after GEI migrated them only run the steps around
+// GEI again. The ongoing migration check is skipped as the migration status
+// repository is expected to exist.
+func (om OrgMigration) RetryFailed(ctx context.Context, previous migrationResult) (migrationResult, error) {
+	if previous.SourceOrg != om.md.orgs.source || previous.TargetOrg != om.md.orgs.target {
+		return migrationResult{}, fmt.Errorf("result file is for a migration from %s to %s, not from %s to %s",
+			previous.SourceOrg, previous.TargetOrg, om.md.orgs.source, om.md.orgs.target)
+	}
 
-	w, _ := worker.New(om.Process, jobs, results)
+	om.deactivateTargetGHAS(ctx)
 
-	for i := 1; i <= om.parallelMigrations; i++ {
-		go w.Start(context.WithValue(ctx, logging.IDKey, i))
+	mr := migrationResult{
+		SourceOrg: om.md.orgs.source,
+		TargetOrg: om.md.orgs.target,
+		Migrated:  previous.Migrated,
+		Degraded:  previous.Degraded,
+		Skipped:   previous.Skipped,
 	}
 
-	for _, repository := range sourceRepositoriesToMigrate {
-		jobs <- repository
+	var candidates []github.Repository
+	var candidateStatuses []repoStatus
+	for _, status := range append(previous.Failed, previous.Pending...) {
+		repository, err := om.md.getSourceRepository(ctx, status.Name)
+		if err != nil {
+			slog.Error("error fetching repository "+status.Name+" from source organization", "error", err)
+			status.Error = err.Error()
+			status.ErrorCategory = errorCategory(err)
+			mr.Failed = append(mr.Failed, status)
+			continue
+		}
+
+		candidates = append(candidates, repository)
+		candidateStatuses = append(candidateStatuses, status)
 	}
-	close(jobs)
 
-	var failed []repoStatus
-	var migrated []repoStatus
-	for a := 1; a <= len(sourceRepositoriesToMigrate); a++ {
-		workerResult := <-results
-		slog.Debug("result received")
-		entity := workerResult.Entity.(github.Repository)
-		if workerResult.Err != nil {
-			failed = append(failed, repoStatus{
-				Name: *entity.Name,
-				ID:   *entity.ID,
-			})
-		} else {
-			migrated = append(migrated, repoStatus{
-				Name: *entity.Name,
-				ID:   *entity.ID,
-			})
+	if err := om.resolveRoutes(ctx, candidates); err != nil {
+		return migrationResult{}, err
+	}
+
+	var repositoriesToRetry []github.Repository
+	for i, repository := range candidates {
+		md := om.migrationFor(repository)
+		targetName := md.targetName(*repository.Name)
+		if _, err := md.orgs.targetGC.GetRepository(ctx, targetName, md.orgs.target); err == nil {
+			status := candidateStatuses[i]
+			// a target that differs from its source has to be migrated again
+			if _, ok := status.migrationStep(); !ok || status.ErrorCategory == errorCategoryDrift {
+				slog.Warn("repository " + md.orgs.target + "/" + targetName + " already exists at target organization, delete it to retry the migration")
+				mr.Failed = append(mr.Failed, status)
+				continue
+			}
+
+			slog.Info("repository " + md.orgs.target + "/" + targetName + " was migrated before it failed, retrying the steps after the migration")
+			om.resumed[*repository.ID] = status
 		}
+
+		repositoriesToRetry = append(repositoriesToRetry, repository)
 	}
 
-	mr := migrationResult{
-		Timestamp: time.Now().UTC(),
-		SourceOrg: om.md.orgs.source,
-		TargetOrg: om.md.orgs.target,
-		Migrated:  migrated,
-		Failed:    failed,
+	slog.Info(strconv.Itoa(len(repositoriesToRetry)) + " repositories to retry")
+
+	om.migrateRepositories(ctx, &mr, repositoriesToRetry)
+
+	return om.finishMigration(ctx, "Migration result (retry)", mr)
+}
+
+// migrateRepositories runs the repository migrations on the worker pool and
+// adds the outcome to mr. The result so far is written to the checkpoint file
+// after every repository. If ctx is cancelled, no new repositories are
+// started and the ones that were not processed are added to mr.Pending.
+func (om OrgMigration) migrateRepositories(ctx context.Context, mr *migrationResult, repositories []github.Repository) {
+	om.md.processRepositories(ctx, mr, repositories, om.md.options.Concurrency, om.Process, func(checkpoint migrationResult) {
+		if err := om.writeCheckpoint(checkpoint); err != nil {
+			slog.Warn("failed to write checkpoint", "error", err)
+		}
+	})
+}
+
+// finishMigration stamps the result and publishes it to the migration status
+// repository. An interrupted migration is not published and the partial
+// result is returned together with ErrInterrupted. A result that cannot be
+// published is returned together with the error.
+func (om OrgMigration) finishMigration(ctx context.Context, title string, mr migrationResult) (migrationResult, error) {
+	mr.Timestamp = time.Now().UTC()
+
+	if ctx.Err() != nil {
+		mr.Interrupted = true
+		slog.Warn("migration interrupted", "migrated", len(mr.Migrated), "failed", len(mr.Failed), "pending", len(mr.Pending))
+
+		if err := om.writeCheckpoint(mr); err != nil {
+			slog.Warn("failed to write checkpoint", "error", err)
+		}
+
+		return mr, ErrInterrupted
 	}
 
-	jsonData, err := json.MarshalIndent(mr, "", "  ")
+	for _, md := range om.targetMigrations() {
+		targetResult := mr.forTarget(md.orgs.target, md.orgs.target == om.md.orgs.target)
+		if err := publishResult(context.WithoutCancel(ctx), md, title, targetResult); err != nil {
+			return mr, err
+		}
+	}
+
+	os.Remove(om.checkpointFile())
+
+	return mr, nil
+}
+
+func publishResult(ctx context.Context, md MigrationData, title string, mr migrationResult) error {
+	body, err := resultIssueBody(mr)
 	if err != nil {
-		slog.Error("failed to parse result", err)
-		return migrationResult{}, err
+		slog.Error("failed to parse result", "error", err)
+		return err
 	}
 
-	err = om.md.orgs.targetGC.CreateIssue(ctx, om.md.orgs.target, statusRepoName, "Migration result", string(jsonData))
+	err = md.orgs.targetGC.CreateIssue(ctx, md.orgs.target, statusRepoName, title, body)
 
 	if err != nil {
 		slog.Error("error creating issue with migration result. Check migration-result.json for details")
-		return migrationResult{}, err
+		return err
 	}
 
-	return mr, nil
+	return nil
+}
+
+// writeCheckpoint saves the result of the repositories processed so far, so
+// that an interrupted or crashed run can be retried with --retry-failed
+func (om OrgMigration) writeCheckpoint(mr migrationResult) error {
+	jsonData, err := json.MarshalIndent(mr, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := om.checkpointFile() + ".tmp"
+	if err := os.WriteFile(tmp, jsonData, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, om.checkpointFile())
+}
+
+func (om OrgMigration) checkpointFile() string {
+	return filepath.Join(om.md.options.OutputDir, checkpointFileName)
 }
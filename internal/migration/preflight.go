@@ -0,0 +1,388 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// PreflightStatus is the outcome of a pre-flight check
+type PreflightStatus string
+
+const (
+	PreflightPass PreflightStatus = "pass"
+	PreflightWarn PreflightStatus = "warn"
+	PreflightFail PreflightStatus = "fail"
+)
+
+const (
+	// minGEIVersion is the oldest gh gei release supported, the first one
+	// with --target-api-url on migrate-repo and the alert migrations
+	minGEIVersion = "1.9.0"
+	// maxRepositorySizeKB is the GEI limit for the git data of a repository,
+	// 40 GiB
+	maxRepositorySizeKB = 40 * 1024 * 1024
+	// largeRepositorySizeKB is the size from which repositories are reported
+	// as close to the limit
+	largeRepositorySizeKB = maxRepositorySizeKB * 3 / 4
+)
+
+// requiredScopes are the scopes GEI needs on personal access tokens
+// (classic) of both sides
+var requiredScopes = []string{"admin:org", "repo", "workflow"}
+
+// targetScopes returns the scopes the target credentials need, which include
+// delete_repo when DriftPolicyRemigrate deletes target repositories
+func (md MigrationData) targetScopes() []string {
+	if md.options.DriftPolicy == DriftPolicyRemigrate {
+		return append(slices.Clone(requiredScopes), "delete_repo")
+	}
+	return requiredScopes
+}
+
+type preflightCheck struct {
+	Name    string          `json:"name"`
+	Status  PreflightStatus `json:"status"`
+	Message string          `json:"message"`
+	Details []string        `json:"details,omitempty"`
+}
+
+type preflightReport struct {
+	Timestamp time.Time `json:"timestamp"`
+	SourceOrg string    `json:"sourceOrg"`
+	TargetOrg string    `json:"targetOrg"`
+	// Status is the worst status of all checks
+	Status PreflightStatus  `json:"status"`
+	Checks []preflightCheck `json:"checks"`
+}
+
+// Failed reports whether a check failed and the migration would not succeed
+func (r preflightReport) Failed() bool {
+	return r.Status == PreflightFail
+}
+
+func (r *preflightReport) add(check preflightCheck) {
+	r.Checks = append(r.Checks, check)
+
+	if check.Status == PreflightFail || (check.Status == PreflightWarn && r.Status == PreflightPass) {
+		r.Status = check.Status
+	}
+}
+
+func (r preflightReport) log() {
+	for _, check := range r.Checks {
+		args := []any{"check", check.Name, "message", check.Message}
+		if len(check.Details) > 0 {
+			args = append(args, "details", check.Details)
+		}
+
+		switch check.Status {
+		case PreflightFail:
+			slog.Error("preflight: fail", args...)
+		case PreflightWarn:
+			slog.Warn("preflight: warn", args...)
+		default:
+			slog.Info("preflight: pass", args...)
+		}
+	}
+
+	slog.Info("preflight finished", "status", r.Status, "checks", len(r.Checks))
+}
+
+// Preflight checks for problems that would make the migration fail halfway
+// through: missing tools, insufficient token scopes, a missing target
+// organization or ownership, GHAS licensing, repository name collisions,
+// repositories above the GEI size limit, GHAS seats and a migration status
+// repository left by a previous run. Nothing is changed at source or target.
+func (om OrgMigration) Preflight(ctx context.Context) preflightReport {
+	report := preflightReport{SourceOrg: om.md.orgs.source, TargetOrg: om.md.orgs.target, Status: PreflightPass}
+
+	report.add(om.md.checkTools(ctx))
+	if om.md.provider == nil {
+		report.add(checkScopes(ctx, "source", om.md.orgs.sourceGC, requiredScopes))
+	}
+	report.add(checkScopes(ctx, "target", om.md.orgs.targetGC, om.md.targetScopes()))
+
+	for _, md := range om.targetMigrations() {
+		report.add(md.checkTargetOrganization(ctx))
+		report.add(md.checkGHASLicensing(ctx))
+		report.add(md.checkStatusRepository(ctx))
+	}
+
+	plan, err := om.planRepositories(ctx)
+	if err != nil {
+		report.add(preflightCheck{Name: "repository names", Status: PreflightFail,
+			Message: "error listing repositories: " + err.Error()})
+	} else {
+		report.add(checkNames(plan))
+		report.add(om.md.checkSizes(plan.toMigrate))
+		om.checkSeats(ctx, plan, &report)
+	}
+
+	report.Timestamp = time.Now().UTC()
+	report.log()
+
+	return report
+}
+
+// checkTools checks that gh and the extension that migrates the
+// repositories are installed
+func (md MigrationData) checkTools(ctx context.Context) preflightCheck {
+	check := preflightCheck{Name: "tools"}
+
+	ghVersion, err := github.ToolVersion(ctx, "")
+	if err != nil {
+		check.Status, check.Message = PreflightFail, "gh CLI is not installed: "+err.Error()
+		return check
+	}
+
+	extension := "gei"
+	if md.provider != nil {
+		extension = md.provider.Extension()
+	}
+
+	version, err := github.ToolVersion(ctx, extension)
+	if err != nil {
+		check.Status = PreflightFail
+		check.Message = fmt.Sprintf("gh %s is not installed, run gh extension install github/gh-%s: %s", extension, extension, err)
+		return check
+	}
+
+	if extension == "gei" && compareVersions(version, minGEIVersion) < 0 {
+		check.Status = PreflightFail
+		check.Message = fmt.Sprintf("gh gei %s is too old, %s or later is required, run gh extension upgrade gei", version, minGEIVersion)
+		return check
+	}
+
+	check.Status, check.Message = PreflightPass, fmt.Sprintf("gh %s, gh %s %s", ghVersion, extension, version)
+	return check
+}
+
+// checkScopes checks that every credential of a client has the required
+// scopes
+func checkScopes(ctx context.Context, side string, gc *github.GitHubClient, required []string) preflightCheck {
+	check := preflightCheck{Name: side + " token scopes", Status: PreflightPass}
+
+	unknown := 0
+	for _, credential := range gc.Credentials() {
+		scopes, ok, err := gc.TokenScopes(ctx, credential)
+		if err != nil {
+			check.Status = PreflightFail
+			check.Details = append(check.Details, fmt.Sprintf("%s: %s", credential.Name(), err))
+			continue
+		}
+		if !ok {
+			unknown++
+			continue
+		}
+
+		var missing []string
+		for _, scope := range required {
+			if !slices.Contains(scopes, scope) {
+				missing = append(missing, scope)
+			}
+		}
+		if len(missing) > 0 {
+			check.Status = PreflightFail
+			check.Details = append(check.Details, fmt.Sprintf("%s: missing %s", credential.Name(), strings.Join(missing, ", ")))
+		}
+	}
+
+	switch {
+	case check.Status == PreflightFail:
+		check.Message = "credentials lack required scopes or were rejected, required are " + strings.Join(required, ", ")
+	case unknown > 0:
+		check.Status = PreflightWarn
+		check.Message = fmt.Sprintf("%d credentials have no OAuth scopes (fine-grained tokens or GitHub Apps), their permissions could not be checked", unknown)
+	default:
+		check.Message = "all credentials have " + strings.Join(required, ", ")
+	}
+
+	return check
+}
+
+// checkTargetOrganization checks that the target organization exists and
+// that the target credentials belong to an owner
+func (md MigrationData) checkTargetOrganization(ctx context.Context) preflightCheck {
+	check := preflightCheck{Name: "target organization " + md.orgs.target}
+
+	exists, err := md.orgs.targetGC.OrganizationExists(ctx, md.orgs.target)
+	if err != nil {
+		check.Status, check.Message = PreflightFail, "error fetching organization: "+err.Error()
+		return check
+	}
+	if !exists {
+		check.Status, check.Message = PreflightFail, "organization does not exist"
+		return check
+	}
+
+	role, err := md.orgs.targetGC.OrganizationRole(ctx, md.orgs.target)
+	switch {
+	case github.StatusCode(err) == 404:
+		check.Status, check.Message = PreflightFail, "the caller is not a member of the organization"
+	case err != nil:
+		check.Status, check.Message = PreflightWarn, "organization exists, the role of the caller could not be checked: "+err.Error()
+	case role != "admin":
+		check.Status, check.Message = PreflightFail, "the caller is not an owner of the organization, its role is "+role
+	default:
+		check.Status, check.Message = PreflightPass, "organization exists and the caller is an owner"
+	}
+
+	return check
+}
+
+// checkGHASLicensing checks that GHAS can be activated at target
+func (md MigrationData) checkGHASLicensing(ctx context.Context) preflightCheck {
+	check := preflightCheck{Name: "GHAS licensing " + md.orgs.target}
+
+	if md.skip(StepActivateGHAS) {
+		check.Status, check.Message = PreflightPass, StepActivateGHAS+" is skipped"
+		return check
+	}
+
+	billing, err := md.orgs.targetGC.GetAdvancedSecurityBilling(ctx, md.orgs.target)
+	switch code := github.StatusCode(err); {
+	case code == 404 || code == 422:
+		check.Status = PreflightFail
+		check.Message = "GitHub Advanced Security is not available, skip " + StepActivateGHAS + " or license GHAS: " + err.Error()
+	case err != nil:
+		check.Status, check.Message = PreflightWarn, "GHAS licensing could not be checked: "+err.Error()
+	default:
+		check.Status, check.Message = PreflightPass, fmt.Sprintf("GitHub Advanced Security is available, %d active committers", billing.TotalCommitters)
+	}
+
+	return check
+}
+
+// checkStatusRepository checks for a migration status repository left by a
+// previous run
+func (md MigrationData) checkStatusRepository(ctx context.Context) preflightCheck {
+	check := preflightCheck{Name: "migration status " + md.orgs.target}
+
+	if err := md.checkOngoing(ctx); err != nil {
+		check.Status, check.Message = PreflightFail, err.Error()
+		return check
+	}
+
+	check.Status, check.Message = PreflightPass, "no "+statusRepoName+" repository"
+	return check
+}
+
+// checkNames reports name collisions between repositories and with
+// repositories that exist at target
+func checkNames(plan repositoryPlan) preflightCheck {
+	check := preflightCheck{Name: "repository names"}
+
+	switch {
+	case len(plan.collisions) > 0:
+		check.Status = PreflightFail
+		check.Message = strconv.Itoa(len(plan.collisions)) + " repositories would get the same name at target as another repository, set repository mappings"
+		for _, status := range plan.collisions {
+			check.Details = append(check.Details, status.Name+": "+status.Error)
+		}
+	case len(plan.caseMismatches) > 0:
+		check.Status = PreflightWarn
+		check.Message = strconv.Itoa(len(plan.caseMismatches)) + " repositories exist at target with a name that differs only in case and will be skipped"
+		check.Details = plan.caseMismatches
+	case len(plan.existing) > 0:
+		check.Status = PreflightWarn
+		check.Message = strconv.Itoa(len(plan.existing)) + " repositories already exist at target and will be skipped"
+		check.Details = plan.existing
+	default:
+		check.Status = PreflightPass
+		check.Message = strconv.Itoa(len(plan.toMigrate)) + " repositories to migrate, no collisions"
+	}
+
+	return check
+}
+
+// checkSizes reports repositories above or close to the GEI size limit
+func (md MigrationData) checkSizes(repositories []github.Repository) preflightCheck {
+	check := preflightCheck{Name: "repository sizes", Status: PreflightPass}
+
+	if md.provider != nil {
+		check.Status, check.Message = PreflightWarn, "repository sizes are not available for "+md.provider.Name()+" sources"
+		return check
+	}
+
+	large := 0
+	for _, repository := range repositories {
+		if repository.Size == nil || *repository.Size < largeRepositorySizeKB {
+			continue
+		}
+
+		detail := fmt.Sprintf("%s: %.1f GiB", *repository.Name, float64(*repository.Size)/1024/1024)
+		if *repository.Size > maxRepositorySizeKB {
+			check.Status = PreflightFail
+			detail += " exceeds the limit"
+		} else {
+			large++
+		}
+		check.Details = append(check.Details, detail)
+	}
+
+	limit := fmt.Sprintf("%d GiB", maxRepositorySizeKB/1024/1024)
+	switch {
+	case check.Status == PreflightFail:
+		check.Message = "repositories exceed the GEI limit of " + limit
+	case large > 0:
+		check.Status, check.Message = PreflightWarn, strconv.Itoa(large)+" repositories are close to the GEI limit of "+limit
+	default:
+		check.Message = "all repositories are below the GEI limit of " + limit
+	}
+
+	return check
+}
+
+// checkSeats adds a check of the GHAS seats of every target
+func (om OrgMigration) checkSeats(ctx context.Context, plan repositoryPlan, report *preflightReport) {
+	if om.md.skip(StepActivateGHAS) {
+		return
+	}
+
+	if om.md.provider != nil {
+		report.add(preflightCheck{Name: "GHAS seats", Status: PreflightWarn,
+			Message: "active committers cannot be estimated for " + om.md.provider.Name() + " sources"})
+		return
+	}
+
+	estimate, err := om.estimateGHAS(ctx, plan)
+	if err != nil {
+		report.add(preflightCheck{Name: "GHAS seats", Status: PreflightWarn, Message: "seats could not be estimated: " + err.Error()})
+		return
+	}
+
+	for _, target := range estimate.Targets {
+		report.add(target.checkSeats())
+	}
+}
+
+// compareVersions compares two dotted version numbers and returns -1, 0 or
+// 1. Missing or invalid parts count as 0.
+func compareVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,122 @@
+package migration
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// Custom properties StepTagProvenance sets on target repositories
+const (
+	PropertyMigratedFrom     = "migrated-from"
+	PropertyMigrationDate    = "migration-date"
+	PropertyMigrationRunID   = "migration-run-id"
+	PropertySourceVisibility = "source-visibility"
+)
+
+// provenanceProperties are created in target organizations that do not
+// define them yet
+var provenanceProperties = []github.CustomProperty{
+	{Name: PropertyMigratedFrom, ValueType: "string", Description: "Organization and repository this repository was migrated from"},
+	{Name: PropertyMigrationDate, ValueType: "string", Description: "Day this repository was migrated, as YYYY-MM-DD"},
+	{Name: PropertyMigrationRunID, ValueType: "string", Description: "ID of the GitHub Enterprise Importer migration of this repository"},
+	{Name: PropertySourceVisibility, ValueType: "string", Description: "Visibility of this repository at source"},
+}
+
+// Provenance configures StepTagProvenance
+type Provenance struct {
+	// PropertyMappings maps custom properties of the source to custom
+	// properties of the target. Properties that are not mapped keep their
+	// name, properties mapped to an empty name are not copied.
+	PropertyMappings map[string]string
+}
+
+// targetProperty returns the name of a source custom property at target, or
+// an empty string if it is not copied
+func (p Provenance) targetProperty(name string) string {
+	if target, ok := p.PropertyMappings[name]; ok {
+		return target
+	}
+	return name
+}
+
+// tagProvenance sets the provenance properties and the custom property values
+// of the source on a target repository. Property definitions the target
+// organization is missing are created, copied properties with the
+// definition they have at source.
+func (md MigrationData) tagProvenance(ctx context.Context, repository github.Repository, targetName string, migrationID string) error {
+	values := map[string]any{
+		PropertyMigratedFrom:  md.orgs.source + "/" + *repository.Name,
+		PropertyMigrationDate: time.Now().UTC().Format(time.DateOnly),
+	}
+	if migrationID != "" {
+		values[PropertyMigrationRunID] = migrationID
+	}
+	if repository.Visibility != nil {
+		values[PropertySourceVisibility] = *repository.Visibility
+	}
+
+	definitions := make(map[string]github.CustomProperty)
+	for _, property := range provenanceProperties {
+		definitions[property.Name] = property
+	}
+
+	// other sources have no custom properties
+	if md.provider == nil {
+		sourceValues, err := md.orgs.sourceGC.GetRepositoryCustomPropertyValues(ctx, md.orgs.source, *repository.Name)
+		if err != nil {
+			return err
+		}
+
+		var sourceDefinitions map[string]github.CustomProperty
+		if len(sourceValues) > 0 {
+			if sourceDefinitions, err = md.orgs.sourceGC.GetCustomProperties(ctx, md.orgs.source); err != nil {
+				return err
+			}
+		}
+
+		for name, value := range sourceValues {
+			target := md.options.Provenance.targetProperty(name)
+			// the provenance of this migration wins over that of earlier ones
+			if _, ok := values[target]; ok || target == "" {
+				continue
+			}
+
+			definition, ok := sourceDefinitions[name]
+			if !ok {
+				definition = github.CustomProperty{ValueType: "string"}
+				if list, isList := value.([]string); isList {
+					definition = github.CustomProperty{ValueType: "multi_select", AllowedValues: list}
+				}
+			}
+			definition.Name = target
+
+			values[target] = value
+			definitions[target] = definition
+		}
+	}
+
+	targetDefinitions, err := md.orgs.targetGC.GetCustomProperties(ctx, md.orgs.target)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if _, ok := targetDefinitions[name]; ok {
+			continue
+		}
+		if err := md.orgs.targetGC.CreateCustomProperty(ctx, md.orgs.target, definitions[name]); err != nil {
+			return err
+		}
+	}
+
+	return md.orgs.targetGC.SetRepositoryCustomPropertyValues(ctx, md.orgs.target, targetName, values)
+}
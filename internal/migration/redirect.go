@@ -0,0 +1,155 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// Default templates of a RedirectNotice
+const (
+	DefaultRedirectDescription = "Moved to {{.TargetURL}}"
+	DefaultRedirectIssueBody   = "This repository was migrated to {{.TargetURL}} on {{.Date}} and is no longer maintained here."
+)
+
+// RedirectNotice configures StepRedirectNotice. All texts are text/template
+// templates executed with redirectData, empty ones are left out.
+type RedirectNotice struct {
+	Description string
+	Homepage    string
+	Topic       string
+	// ReadmeBanner is committed to the top of the README of the default
+	// branch
+	ReadmeBanner string
+	// IssueTitle and IssueBody open an issue or, if DiscussionCategory is
+	// set, a discussion in that category. Only issues can be pinned.
+	IssueTitle         string
+	IssueBody          string
+	PinIssue           bool
+	DiscussionCategory string
+}
+
+// redirectData is what the templates of a RedirectNotice can refer to
+type redirectData struct {
+	SourceOrg        string
+	SourceRepository string
+	TargetOrg        string
+	TargetRepository string
+	TargetURL        string
+	MigrationID      string
+	// Date is the day of the migration as YYYY-MM-DD
+	Date string
+}
+
+// Validate returns an error for the first template that does not parse or
+// refers to unknown fields
+func (n RedirectNotice) Validate() error {
+	for name, text := range n.templates() {
+		tmpl, err := template.New(name).Parse(text)
+		if err == nil {
+			err = tmpl.Execute(io.Discard, redirectData{})
+		}
+		if err != nil {
+			return fmt.Errorf("invalid redirect %s template: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (n RedirectNotice) templates() map[string]string {
+	return map[string]string{
+		"description":   n.Description,
+		"homepage":      n.Homepage,
+		"topic":         n.Topic,
+		"readme banner": n.ReadmeBanner,
+		"issue title":   n.IssueTitle,
+		"issue body":    n.IssueBody,
+	}
+}
+
+// render executes the templates of the notice
+func (n RedirectNotice) render(data redirectData) (RedirectNotice, error) {
+	rendered := n
+	for _, field := range []*string{&rendered.Description, &rendered.Homepage, &rendered.Topic,
+		&rendered.ReadmeBanner, &rendered.IssueTitle, &rendered.IssueBody} {
+		if *field == "" {
+			continue
+		}
+
+		tmpl, err := template.New("redirect").Parse(*field)
+		if err != nil {
+			return RedirectNotice{}, err
+		}
+
+		var text strings.Builder
+		if err := tmpl.Execute(&text, data); err != nil {
+			return RedirectNotice{}, err
+		}
+		*field = text.String()
+	}
+
+	return rendered, nil
+}
+
+// postRedirectNotice points a migrated source repository to its target. It
+// runs before the source is archived, as archived repositories cannot be
+// changed.
+func (md MigrationData) postRedirectNotice(ctx context.Context, logger *slog.Logger, ew *errWritter,
+	repository github.Repository, targetName string, notice RedirectNotice) {
+	data := redirectData{
+		SourceOrg:        md.orgs.source,
+		SourceRepository: *repository.Name,
+		TargetOrg:        md.orgs.target,
+		TargetRepository: targetName,
+		TargetURL:        md.orgs.targetGit.HTMLURL(md.orgs.target, targetName),
+		MigrationID:      ew.migrationID(),
+		Date:             time.Now().UTC().Format(time.DateOnly),
+	}
+
+	var err error
+	ew.logAndCallStep(logger, "rendering redirect notice", func() error {
+		notice, err = notice.render(data)
+		return err
+	})
+
+	if notice.Description != "" || notice.Homepage != "" {
+		ew.logAndCallStep(logger, "pointing source to target", func() error {
+			return md.orgs.sourceGC.EditRepositoryDetails(ctx, md.orgs.source, *repository.Name, notice.Description, notice.Homepage)
+		})
+	}
+
+	if notice.Topic != "" {
+		ew.logAndCallStep(logger, "adding topic at source", func() error {
+			return md.orgs.sourceGC.AddTopic(ctx, md.orgs.source, *repository.Name, notice.Topic)
+		})
+	}
+
+	if notice.ReadmeBanner != "" && repository.DefaultBranch != nil {
+		ew.logAndCallStep(logger, "adding README banner at source", func() error {
+			return md.orgs.sourceGC.AddReadmeBanner(ctx, md.orgs.source, *repository.Name, *repository.DefaultBranch,
+				notice.ReadmeBanner, "Add notice that this repository moved to "+data.TargetURL)
+		})
+	}
+
+	if notice.IssueTitle == "" {
+		return
+	}
+
+	if notice.DiscussionCategory != "" {
+		ew.logAndCallStep(logger, "opening redirect discussion at source", func() error {
+			return md.orgs.sourceGC.CreateDiscussion(ctx, md.orgs.source, *repository.Name, notice.DiscussionCategory,
+				notice.IssueTitle, notice.IssueBody)
+		})
+	} else {
+		ew.logAndCallStep(logger, "opening redirect issue at source", func() error {
+			return md.orgs.sourceGC.CreateNoticeIssue(ctx, md.orgs.source, *repository.Name,
+				notice.IssueTitle, notice.IssueBody, notice.PinIssue)
+		})
+	}
+}
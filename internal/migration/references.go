@@ -0,0 +1,485 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// How StepRewriteReferences lands the rewritten files
+const (
+	// RewriteModePullRequest pushes the changes to a branch and opens a pull
+	// request into the default branch
+	RewriteModePullRequest = "pull-request"
+	// RewriteModeCommit commits the changes to the default branch
+	RewriteModeCommit = "commit"
+)
+
+// RewriteModes are the names of the rewrite modes
+var RewriteModes = []string{RewriteModePullRequest, RewriteModeCommit}
+
+// ReferenceRewrite configures StepRewriteReferences
+type ReferenceRewrite struct {
+	// Mode is one of RewriteModes, empty for RewriteModePullRequest
+	Mode string
+	// OrgMappings maps other source organizations to their target
+	// organization. References to them only change organization.
+	OrgMappings map[string]string
+	// TeamMappings maps team slugs of the source organization to team slugs
+	// of the target. Teams that are not mapped keep their slug.
+	TeamMappings map[string]string
+}
+
+// Validate returns an error for an unknown mode
+func (r ReferenceRewrite) Validate() error {
+	if r.Mode != "" && !slices.Contains(RewriteModes, r.Mode) {
+		return fmt.Errorf("unknown rewrite mode %q, expected one of %s", r.Mode, strings.Join(RewriteModes, ", "))
+	}
+	return nil
+}
+
+// rewriteBranch is the branch RewriteModePullRequest pushes to
+const rewriteBranch = "migration/rewrite-org-references"
+
+// codeownersPaths are the locations GitHub reads CODEOWNERS from
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+var (
+	// usesPattern matches actions and reusable workflows of other
+	// repositories, e.g. uses: org/repo/path@ref
+	usesPattern = regexp.MustCompile(`^(\s*(?:-\s+)?uses:\s*["']?)([\w-]+)/([\w.-]+)([/@].*)$`)
+	// checkoutPattern matches the repository input of actions/checkout
+	checkoutPattern = regexp.MustCompile(`^(\s*repository:\s*["']?)([\w-]+)/([\w.-]+?)(["']?\s*(?:#.*)?)$`)
+	// ownerPattern matches the teams of a CODEOWNERS line
+	ownerPattern = regexp.MustCompile(`(^|\s)@([\w-]+)/([\w-]+)`)
+	// submodulePattern matches the url lines of .gitmodules
+	submodulePattern = regexp.MustCompile(`^(\s*url\s*=\s*)(\S+)(\s*)$`)
+	// scpPattern matches scp-like git URLs, e.g. git@github.com:org/repo.git
+	scpPattern = regexp.MustCompile(`^([\w.-]+@)([^:/]+):([\w-]+)/([\w.-]+?)(\.git)?/?$`)
+	// relativePattern matches submodule URLs relative to the repository,
+	// e.g. ../repo.git or ../../org/repo.git
+	relativePattern = regexp.MustCompile(`^\.\./(?:\.\./([\w-]+)/)?([\w.-]+?)(\.git)?/?$`)
+)
+
+// referenceRewriter rewrites references to source organizations in the files
+// of a target repository and collects the ones it cannot map
+type referenceRewriter struct {
+	md  MigrationData
+	ctx context.Context
+	// repositories and teams cache the resolved references of the source
+	// organization by lowercase name
+	repositories map[string]reference
+	teams        map[string]reference
+	unmapped     []string
+	err          error
+}
+
+// reference is where a repository or team of the source is at target. A
+// reference that cannot be mapped has a reason.
+type reference struct {
+	org, name string
+	reason    string
+}
+
+func (md MigrationData) newReferenceRewriter(ctx context.Context) *referenceRewriter {
+	return &referenceRewriter{md: md, ctx: ctx, repositories: make(map[string]reference), teams: make(map[string]reference)}
+}
+
+// mappedOrg returns the target of another source organization, if it is
+// mapped
+func (r *referenceRewriter) mappedOrg(org string) (string, bool) {
+	for source, target := range r.md.options.References.OrgMappings {
+		if strings.EqualFold(source, org) {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// repository returns where a repository is at target. Repositories of
+// organizations that are not migrated are returned unchanged.
+func (r *referenceRewriter) repository(org, name string) (reference, error) {
+	if !strings.EqualFold(org, r.md.orgs.source) {
+		if target, ok := r.mappedOrg(org); ok {
+			return reference{org: target, name: name}, nil
+		}
+		return reference{org: org, name: name}, nil
+	}
+
+	// every organization has its own .github repository, which is not
+	// migrated
+	if strings.EqualFold(name, ".github") {
+		return reference{org: r.md.orgs.target, name: name}, nil
+	}
+
+	key := strings.ToLower(name)
+	if ref, ok := r.repositories[key]; ok {
+		return ref, nil
+	}
+
+	ref, err := r.resolveRepository(name)
+	if err != nil {
+		return reference{}, err
+	}
+
+	r.repositories[key] = ref
+	return ref, nil
+}
+
+// resolveRepository routes and renames a repository of the source
+// organization like the migration does. Repositories the repository filter
+// leaves out are not migrated and cannot be mapped.
+func (r *referenceRewriter) resolveRepository(name string) (reference, error) {
+	md := r.md
+
+	repository, err := md.orgs.sourceGC.GetRepository(r.ctx, name, md.orgs.source)
+	if github.StatusCode(err) == 404 {
+		return reference{reason: "repository not found at source"}, nil
+	}
+	if err != nil {
+		return reference{}, err
+	}
+
+	if !md.options.Filter.Matches(*repository.Name) {
+		return reference{reason: "repository is not part of the migration"}, nil
+	}
+
+	ref := reference{org: md.orgs.home}
+	if !md.options.Routing.isEmpty() {
+		var properties map[string]any
+		if md.options.Routing.usesProperties() {
+			if properties, err = md.orgs.sourceGC.GetRepositoryCustomPropertyValues(r.ctx, md.orgs.source, *repository.Name); err != nil {
+				return reference{}, err
+			}
+		}
+
+		if route, ok := md.options.Routing.route(repository, properties); ok {
+			ref.org, ref.name = route.Target, route.Name
+		}
+	}
+
+	if ref.name == "" {
+		ref.name = md.targetName(*repository.Name)
+	}
+
+	return ref, nil
+}
+
+// team returns where a team is at target. Teams of other organizations are
+// returned unchanged, unless their organization is mapped.
+func (r *referenceRewriter) team(org, slug string) (reference, error) {
+	if !strings.EqualFold(org, r.md.orgs.source) {
+		if target, ok := r.mappedOrg(org); ok {
+			return reference{org: target, name: slug}, nil
+		}
+		return reference{org: org, name: slug}, nil
+	}
+
+	ref := reference{org: r.md.orgs.target, name: slug}
+	for source, target := range r.md.options.References.TeamMappings {
+		if strings.EqualFold(source, slug) {
+			ref.name = target
+		}
+	}
+
+	key := strings.ToLower(ref.name)
+	if cached, ok := r.teams[key]; ok {
+		return cached, nil
+	}
+
+	exists, err := r.md.orgs.targetGC.TeamExists(r.ctx, ref.org, ref.name)
+	if err != nil {
+		return reference{}, err
+	}
+	if !exists {
+		ref.reason = fmt.Sprintf("team %s/%s not found at target", ref.org, ref.name)
+	}
+
+	r.teams[key] = ref
+	return ref, nil
+}
+
+// rewriteLines applies f to every line of a file and returns the new content
+func (r *referenceRewriter) rewriteLines(file, content string, f func(line string, unmapped func(ref, reason string)) string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if r.err != nil {
+			break
+		}
+		lines[i] = f(line, func(ref, reason string) {
+			r.unmapped = append(r.unmapped, fmt.Sprintf("%s:%d: %s: %s", file, i+1, ref, reason))
+		})
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replaceRepository returns the target of org/name. Names that did not
+// change are kept as written. ok is false if the repository cannot be
+// mapped.
+func (r *referenceRewriter) replaceRepository(org, name string, unmapped func(ref, reason string)) (string, string, bool) {
+	ref, err := r.repository(org, name)
+	if err != nil {
+		r.err = err
+		return org, name, false
+	}
+	if ref.reason != "" {
+		unmapped(org+"/"+name, ref.reason)
+		return org, name, false
+	}
+
+	if strings.EqualFold(ref.org, org) {
+		ref.org = org
+	}
+	if strings.EqualFold(ref.name, name) {
+		ref.name = name
+	}
+	return ref.org, ref.name, true
+}
+
+// rewriteWorkflow rewrites the actions, reusable workflows and checked out
+// repositories of a workflow
+func (r *referenceRewriter) rewriteWorkflow(file, content string) string {
+	return r.rewriteLines(file, content, func(line string, unmapped func(ref, reason string)) string {
+		for _, pattern := range []*regexp.Regexp{usesPattern, checkoutPattern} {
+			if m := pattern.FindStringSubmatch(line); m != nil {
+				org, name, ok := r.replaceRepository(m[2], m[3], unmapped)
+				if !ok {
+					return line
+				}
+				return m[1] + org + "/" + name + m[4]
+			}
+		}
+		return line
+	})
+}
+
+// rewriteCodeowners rewrites the teams of a CODEOWNERS file
+func (r *referenceRewriter) rewriteCodeowners(file, content string) string {
+	return r.rewriteLines(file, content, func(line string, unmapped func(ref, reason string)) string {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			return line
+		}
+
+		return ownerPattern.ReplaceAllStringFunc(line, func(match string) string {
+			m := ownerPattern.FindStringSubmatch(match)
+			ref, err := r.team(m[2], m[3])
+			if err != nil {
+				r.err = err
+				return match
+			}
+			if ref.reason != "" {
+				unmapped("@"+m[2]+"/"+m[3], ref.reason)
+				return match
+			}
+			if strings.EqualFold(ref.org, m[2]) && strings.EqualFold(ref.name, m[3]) {
+				return match
+			}
+			return m[1] + "@" + ref.org + "/" + ref.name
+		})
+	})
+}
+
+// rewriteGitmodules rewrites the submodule URLs that point to the source
+func (r *referenceRewriter) rewriteGitmodules(file, content string) string {
+	return r.rewriteLines(file, content, func(line string, unmapped func(ref, reason string)) string {
+		m := submodulePattern.FindStringSubmatch(line)
+		if m == nil {
+			return line
+		}
+		return m[1] + r.rewriteSubmoduleURL(m[2], unmapped) + m[3]
+	})
+}
+
+// rewriteSubmoduleURL rewrites an HTTPS, SSH or relative submodule URL
+func (r *referenceRewriter) rewriteSubmoduleURL(rawURL string, unmapped func(ref, reason string)) string {
+	sourceHost, targetHost := gitHost(r.md.orgs.sourceGit), gitHost(r.md.orgs.targetGit)
+
+	if m := relativePattern.FindStringSubmatch(rawURL); m != nil {
+		org := m[1]
+		if org == "" {
+			org = r.md.orgs.source
+		}
+
+		newOrg, name, ok := r.replaceRepository(org, m[2], unmapped)
+		if !ok {
+			return rawURL
+		}
+		if m[1] == "" && strings.EqualFold(newOrg, r.md.orgs.target) {
+			return "../" + name + m[3]
+		}
+		return "../../" + newOrg + "/" + name + m[3]
+	}
+
+	if m := scpPattern.FindStringSubmatch(rawURL); m != nil {
+		if !strings.EqualFold(m[2], sourceHost) {
+			return rawURL
+		}
+
+		org, name, ok := r.replaceRepository(m[3], m[4], unmapped)
+		if !ok {
+			return rawURL
+		}
+		return m[1] + targetHost + ":" + org + "/" + name + m[5]
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || !strings.EqualFold(u.Hostname(), sourceHost) {
+		return rawURL
+	}
+
+	org, repository, ok := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if !ok || strings.Contains(repository, "/") {
+		return rawURL
+	}
+	name, suffix := strings.TrimSuffix(repository, ".git"), ""
+	if name != repository {
+		suffix = ".git"
+	}
+
+	org, name, ok = r.replaceRepository(org, name, unmapped)
+	if !ok {
+		return rawURL
+	}
+	if !strings.EqualFold(targetHost, sourceHost) {
+		u.Host = targetHost
+	}
+	u.Path = "/" + org + "/" + name + suffix
+
+	return u.String()
+}
+
+// gitHost returns the host name of a git endpoint
+func gitHost(host github.GitHost) string {
+	u, err := url.Parse(host.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// scanReferences reads the workflows, CODEOWNERS and .gitmodules of a target
+// repository and returns the rewritten files by path, with the references
+// that could not be mapped
+func (md MigrationData) scanReferences(ctx context.Context, targetName string, branch string) (map[string]string, []string, error) {
+	r := md.newReferenceRewriter(ctx)
+	changes := make(map[string]string)
+
+	rewrite := func(file string, f func(file, content string) string) error {
+		content, ok, err := md.orgs.targetGC.GetFileContent(ctx, md.orgs.target, targetName, file, branch)
+		if err != nil || !ok {
+			return err
+		}
+
+		rewritten := f(file, content)
+		if r.err != nil {
+			return r.err
+		}
+		if rewritten != content {
+			changes[file] = rewritten
+		}
+		return nil
+	}
+
+	workflows, err := md.orgs.targetGC.ListFiles(ctx, md.orgs.target, targetName, ".github/workflows", branch)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, workflow := range workflows {
+		if ext := path.Ext(workflow); ext != ".yml" && ext != ".yaml" {
+			continue
+		}
+		if err := rewrite(workflow, r.rewriteWorkflow); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, file := range codeownersPaths {
+		if err := rewrite(file, r.rewriteCodeowners); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := rewrite(".gitmodules", r.rewriteGitmodules); err != nil {
+		return nil, nil, err
+	}
+
+	return changes, r.unmapped, nil
+}
+
+// rewriteReferences points the references to source organizations in the
+// workflows, CODEOWNERS and .gitmodules of a target repository to their
+// targets, in a pull request or a commit to the default branch. References
+// that cannot be mapped are recorded in the status and left as they are.
+func (md MigrationData) rewriteReferences(ctx context.Context, logger *slog.Logger, ew *errWritter, repository github.Repository, targetName string) {
+	if repository.DefaultBranch == nil {
+		return
+	}
+	defaultBranch := *repository.DefaultBranch
+
+	var changes map[string]string
+	var unmapped []string
+	ew.logAndCallStep(logger, "scanning references at target", func() error {
+		var err error
+		changes, unmapped, err = md.scanReferences(ctx, targetName, defaultBranch)
+		return err
+	})
+
+	for _, ref := range unmapped {
+		logger.Warn("reference to source cannot be mapped", "repository", targetName, "reference", ref)
+	}
+	if ew.status != nil {
+		ew.status.UnmappedReferences = unmapped
+	}
+
+	if ew.err != nil || len(changes) == 0 {
+		return
+	}
+
+	files := make([]string, 0, len(changes))
+	for file := range changes {
+		files = append(files, file)
+	}
+	slices.Sort(files)
+
+	message := fmt.Sprintf("Point references to %s at the migrated repositories and teams", md.orgs.source)
+
+	branch := rewriteBranch
+	if md.options.References.Mode == RewriteModeCommit {
+		branch = defaultBranch
+	}
+
+	ew.logAndCallStep(logger, "committing rewritten references at target", func() error {
+		return md.orgs.targetGC.CommitFiles(ctx, md.orgs.target, targetName, defaultBranch, branch, message, changes)
+	})
+
+	if branch == defaultBranch {
+		return
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "This repository was migrated from %s/%s. References to its organization were rewritten in:\n\n", md.orgs.source, *repository.Name)
+	for _, file := range files {
+		fmt.Fprintf(&body, "- `%s`\n", file)
+	}
+	if len(unmapped) > 0 {
+		body.WriteString("\nThese references could not be mapped and were left as they are:\n\n")
+		for _, ref := range unmapped {
+			fmt.Fprintf(&body, "- `%s`\n", ref)
+		}
+	}
+
+	ew.logAndCallStep(logger, "opening pull request for rewritten references at target", func() error {
+		pullRequest, err := md.orgs.targetGC.CreatePullRequest(ctx, md.orgs.target, targetName, branch, defaultBranch, message, body.String())
+		if ew.status != nil && pullRequest != "" {
+			ew.status.ReferencesPullRequest = pullRequest
+		}
+		return err
+	})
+}
@@ -0,0 +1,105 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+func TestReferencePatterns(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		pattern *regexp.Regexp
+		line    string
+		// want are the submatches after the full match, nil if the line
+		// does not match
+		want []string
+	}{
+		{"uses action", usesPattern, "      - uses: source/setup@v1", []string{"      - uses: ", "source", "setup", "@v1"}},
+		{"uses quoted", usesPattern, `    uses: "source/setup@main"`, []string{`    uses: "`, "source", "setup", `@main"`}},
+		{"uses reusable workflow", usesPattern, "    uses: source/workflows/.github/workflows/build.yml@v2",
+			[]string{"    uses: ", "source", "workflows", "/.github/workflows/build.yml@v2"}},
+		{"uses local action", usesPattern, "      - uses: ./.github/actions/build", nil},
+		{"uses docker", usesPattern, "      - uses: docker://alpine:3", nil},
+		{"uses without ref", usesPattern, "      - uses: source/setup", nil},
+
+		{"checkout", checkoutPattern, "          repository: source/tools", []string{"          repository: ", "source", "tools", ""}},
+		{"checkout quoted with comment", checkoutPattern, "          repository: 'source/tools.js' # pinned",
+			[]string{"          repository: '", "source", "tools.js", "' # pinned"}},
+		{"checkout expression", checkoutPattern, "          repository: ${{ github.repository }}", nil},
+		{"checkout path", checkoutPattern, "          repository: source/tools/sub", nil},
+
+		{"scp", scpPattern, "git@github.com:source/lib.git", []string{"git@", "github.com", "source", "lib", ".git"}},
+		{"scp without suffix", scpPattern, "git@ghes.example.com:source/lib.v2/", []string{"git@", "ghes.example.com", "source", "lib.v2", ""}},
+		{"scp https", scpPattern, "https://github.com/source/lib.git", nil},
+		{"scp nested path", scpPattern, "git@github.com:source/group/lib.git", nil},
+
+		{"relative sibling", relativePattern, "../lib.git", []string{"", "lib", ".git"}},
+		{"relative other organization", relativePattern, "../../other/lib", []string{"other", "lib", ""}},
+		{"relative too deep", relativePattern, "../../../other/lib", nil},
+		{"relative to the same directory", relativePattern, "./lib", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := tc.pattern.FindStringSubmatch(tc.line)
+			if m != nil {
+				m = m[1:]
+			}
+			if !slices.Equal(m, tc.want) {
+				t.Errorf("got submatches %q, want %q", m, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveRepository(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutPrefix(r.URL.Path, "/api/v3/repos/source/")
+		if !ok || name == "missing" {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": name, "id": 1})
+	}))
+	defer server.Close()
+
+	pool, err := github.NewCredentialPool(github.NewPATCredential("source-pat", "token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var md MigrationData
+	md.orgs.source, md.orgs.target, md.orgs.home = "source", "target", "target"
+	md.options.TargetPrefix = "legacy-"
+	md.options.Filter = RepositoryFilter{Exclude: []string{"internal-*"}}
+	if md.orgs.sourceGC, err = github.NewGitHubClient(context.Background(), slog.Default(), pool,
+		github.ClientOptions{Name: "source", APIURL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		want reference
+	}{
+		{"api", reference{org: "target", name: "legacy-api"}},
+		{"missing", reference{reason: "repository not found at source"}},
+		{"internal-tools", reference{reason: "repository is not part of the migration"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ref, err := md.newReferenceRewriter(context.Background()).resolveRepository(tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ref != tc.want {
+				t.Errorf("got %+v, want %+v", ref, tc.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"log/slog"
 
-	"github.com/gateixeira/gei-migration-helper/internal/github"
 	"github.com/gateixeira/gei-migration-helper/pkg/logging"
 )
 
@@ -13,37 +12,35 @@ type RepoMigration struct {
 	md   MigrationData
 }
 
-func NewRepoMigration(ctx context.Context, name, sourceOrg, targetOrg, sourceToken, targetToken string, retries int) (RepoMigration, error) {
-	maxRetries = retries
-	sourceGC, err := github.NewGitHubClient(ctx, slog.Default(), sourceToken)
+func NewRepoMigration(ctx context.Context, name string, conn Connection, options Options) (RepoMigration, error) {
+	md, err := NewMigration(ctx, conn, options)
 	if err != nil {
-		slog.Info("error initializing source GitHub Client", err)
 		return RepoMigration{}, err
 	}
 
-	targetGC, err := github.NewGitHubClient(ctx, slog.Default(), targetToken)
-	if err != nil {
-		slog.Info("error initializing source GitHub Client", err)
-		return RepoMigration{}, err
-	}
-
-	return RepoMigration{name, MigrationData{orgs{sourceOrg, targetOrg, sourceGC, targetGC}, github.NewGEI(sourceOrg, targetOrg, sourceToken, targetToken)}}, nil
+	return RepoMigration{name, md}, nil
 }
 
 func (rm RepoMigration) Migrate(ctx context.Context) error {
 	logger := logging.NewLoggerFromContext(ctx, false)
 
-	repo, err := rm.md.orgs.sourceGC.GetRepository(ctx, rm.name, rm.md.orgs.source)
+	repo, err := rm.md.getSourceRepository(ctx, rm.name)
+
+	if err != nil {
+		slog.Info("error getting repository: "+rm.name, "error", err)
+		return err
+	}
 
+	md, err := rm.md.routeRepository(ctx, repo)
 	if err != nil {
-		slog.Info("error getting repository: "+*repo.Name, err)
+		slog.Error("error routing repository: "+rm.name, "error", err)
 		return err
 	}
 
-	err = rm.md.processRepoMigration(ctx, logger, repo)
+	err = md.processRepoMigration(ctx, logger, repo, nil, false)
 
 	if err != nil {
-		slog.Error("error migrating repository: "+*repo.Name, err)
+		slog.Error("error migrating repository: "+*repo.Name, "error", err)
 		return err
 	}
 
@@ -0,0 +1,276 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"gopkg.in/yaml.v3"
+)
+
+// Route is the target organization and, optionally, the target name of a
+// repository
+type Route struct {
+	Target string `yaml:"target"`
+	Name   string `yaml:"name"`
+}
+
+// RoutingRule routes the repositories that match all of its conditions.
+// Repository is a pattern as understood by path.Match, Property and Value
+// match a custom property of the repository.
+type RoutingRule struct {
+	Repository string `yaml:"repository"`
+	Topic      string `yaml:"topic"`
+	Property   string `yaml:"property"`
+	Value      string `yaml:"value"`
+	Target     string `yaml:"target"`
+}
+
+// Routing picks the target organization of every repository. Repositories
+// listed by name are routed first, then the first matching rule applies.
+// Repositories that are not routed are migrated to the target organization
+// of the migration.
+type Routing struct {
+	Repositories map[string]Route `yaml:"repositories"`
+	Rules        []RoutingRule    `yaml:"rules"`
+}
+
+// LoadRouting reads a routing table from a YAML file or from a CSV file with
+// the columns repository, target organization and, optionally, target name
+func LoadRouting(file string) (Routing, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Routing{}, err
+	}
+	defer f.Close()
+
+	var routing Routing
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		routing, err = readRoutingCSV(f)
+	} else {
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		err = decoder.Decode(&routing)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return Routing{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	if err := routing.Validate(); err != nil {
+		return Routing{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return routing, nil
+}
+
+func readRoutingCSV(r io.Reader) (Routing, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	routing := Routing{Repositories: make(map[string]Route)}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return routing, nil
+		}
+		if err != nil {
+			return Routing{}, err
+		}
+
+		if len(record) < 2 || len(record) > 3 {
+			return Routing{}, fmt.Errorf("line %d: expected repository,target[,name]", line)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "repository") {
+			// header
+			continue
+		}
+
+		route := Route{Target: strings.TrimSpace(record[1])}
+		if len(record) == 3 {
+			route.Name = strings.TrimSpace(record[2])
+		}
+		routing.Repositories[strings.TrimSpace(record[0])] = route
+	}
+}
+
+// Validate returns an error for the first incomplete entry
+func (r Routing) Validate() error {
+	for repository, route := range r.Repositories {
+		if repository == "" || route.Target == "" {
+			return fmt.Errorf("repository %q: repository and target are required", repository)
+		}
+	}
+
+	for i, rule := range r.Rules {
+		if rule.Target == "" {
+			return fmt.Errorf("rule %d: target is required", i+1)
+		}
+		if rule.Repository == "" && rule.Topic == "" && rule.Property == "" {
+			return fmt.Errorf("rule %d: at least one of repository, topic or property is required", i+1)
+		}
+		if rule.Value != "" && rule.Property == "" {
+			return fmt.Errorf("rule %d: value needs a property", i+1)
+		}
+		if _, err := path.Match(rule.Repository, ""); err != nil {
+			return fmt.Errorf("rule %d: invalid repository pattern %q: %w", i+1, rule.Repository, err)
+		}
+	}
+
+	return nil
+}
+
+// forTarget returns a copy of md that migrates to another organization with
+// the same target credentials. Names of repositories routed to target are
+// added to the repository mappings.
+func (md MigrationData) forTarget(target string) MigrationData {
+	routed := md
+	routed.orgs.target = target
+	routed.gei = md.gei.WithTargetOrg(target)
+
+	routed.options.RepositoryMappings = maps.Clone(md.options.RepositoryMappings)
+	for repository, route := range md.options.Routing.Repositories {
+		if route.Name != "" && strings.EqualFold(route.Target, target) {
+			if routed.options.RepositoryMappings == nil {
+				routed.options.RepositoryMappings = make(map[string]string)
+			}
+			routed.options.RepositoryMappings[repository] = route.Name
+		}
+	}
+
+	return routed
+}
+
+// routeRepository returns the migration of the target a single repository
+// is routed to
+func (md MigrationData) routeRepository(ctx context.Context, repository github.Repository) (MigrationData, error) {
+	routing := md.options.Routing
+	if routing.isEmpty() {
+		return md, nil
+	}
+
+	if err := md.requireGitHubSource(); err != nil {
+		return MigrationData{}, fmt.Errorf("routing: %w", err)
+	}
+
+	var properties map[string]map[string]any
+	if routing.usesProperties() {
+		var err error
+		properties, err = md.orgs.sourceGC.GetCustomPropertyValues(ctx, md.orgs.source)
+		if err != nil {
+			return MigrationData{}, fmt.Errorf("error fetching custom properties: %w", err)
+		}
+	}
+
+	if route, ok := routing.route(repository, properties[*repository.Name]); ok {
+		return md.forTarget(route.Target), nil
+	}
+
+	return md.forTarget(md.orgs.target), nil
+}
+
+func (r Routing) isEmpty() bool {
+	return len(r.Repositories) == 0 && len(r.Rules) == 0
+}
+
+// usesProperties reports whether custom property values are needed to route
+func (r Routing) usesProperties() bool {
+	return slices.ContainsFunc(r.Rules, func(rule RoutingRule) bool { return rule.Property != "" })
+}
+
+// targets returns the target organizations of the table
+func (r Routing) targets() []string {
+	var targets []string
+	add := func(target string) {
+		if !slices.ContainsFunc(targets, func(t string) bool { return strings.EqualFold(t, target) }) {
+			targets = append(targets, target)
+		}
+	}
+
+	for _, route := range r.Repositories {
+		add(route.Target)
+	}
+	for _, rule := range r.Rules {
+		add(rule.Target)
+	}
+	slices.Sort(targets)
+
+	return targets
+}
+
+// route returns the route of a repository, if the table has one.
+// properties are the custom property values of the repository.
+func (r Routing) route(repository github.Repository, properties map[string]any) (Route, bool) {
+	if route, ok := r.Repositories[*repository.Name]; ok {
+		return route, true
+	}
+
+	for _, rule := range r.Rules {
+		if rule.matches(repository, properties) {
+			return Route{Target: rule.Target}, true
+		}
+	}
+
+	return Route{}, false
+}
+
+func (rule RoutingRule) matches(repository github.Repository, properties map[string]any) bool {
+	if rule.Repository != "" {
+		if ok, _ := path.Match(rule.Repository, *repository.Name); !ok {
+			return false
+		}
+	}
+
+	if rule.Topic != "" && !slices.ContainsFunc(repository.Topics, func(topic string) bool { return strings.EqualFold(topic, rule.Topic) }) {
+		return false
+	}
+
+	if rule.Property != "" {
+		value, ok := properties[rule.Property]
+		if !ok || (rule.Value != "" && !hasValue(value, rule.Value)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasValue reports whether a custom property value is want or, for
+// multi_select properties, contains it
+func hasValue(value any, want string) bool {
+	switch value := value.(type) {
+	case string:
+		return value == want
+	case []string:
+		return slices.Contains(value, want)
+	}
+	return false
+}
+
+// routeRepositories routes repositories according to the routing table of md
+// for the commands that work on migrated repositories
+func (md MigrationData) routeRepositories(ctx context.Context, repositories []github.Repository) (OrgMigration, error) {
+	om, err := newOrgMigration(md)
+	if err != nil {
+		return OrgMigration{}, err
+	}
+
+	if err := om.resolveRoutes(ctx, repositories); err != nil {
+		return OrgMigration{}, err
+	}
+
+	return om, nil
+}
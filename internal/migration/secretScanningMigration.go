@@ -3,6 +3,7 @@ package migration
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"github.com/gateixeira/gei-migration-helper/internal/github"
 	"github.com/gateixeira/gei-migration-helper/pkg/logging"
@@ -12,52 +13,53 @@ type SecretScanningMigration struct {
 	md MigrationData
 }
 
-func NewSecretScanningMigration(ctx context.Context, sourceOrg, targetOrg, sourceToken, targetToken string) (SecretScanningMigration, error) {
-	sourceGC, err := github.NewGitHubClient(ctx, slog.Default(), sourceToken)
+func NewSecretScanningMigration(ctx context.Context, conn Connection, options Options) (SecretScanningMigration, error) {
+	md, err := NewMigration(ctx, conn, options)
 	if err != nil {
-		slog.Info("error initializing source GitHub Client", err)
 		return SecretScanningMigration{}, err
 	}
 
-	targetGC, err := github.NewGitHubClient(ctx, slog.Default(), sourceToken)
-	if err != nil {
-		slog.Info("error initializing source GitHub Client", err)
-		return SecretScanningMigration{}, err
+	return SecretScanningMigration{md}, nil
+}
+
+// Migrate migrates secret scanning alerts for a single repository or, if
+// repository is empty, for all repositories of the organization. A failing
+// repository does not stop the others; failures are listed in the returned
+// result.
+func (scm SecretScanningMigration) Migrate(ctx context.Context, repository string) (migrationResult, error) {
+	if err := scm.md.requireGitHubSource(); err != nil {
+		return migrationResult{}, err
 	}
 
-	return SecretScanningMigration{MigrationData{orgs{sourceOrg, targetOrg, sourceGC, targetGC}, github.NewGEI(sourceOrg, targetOrg, sourceToken, targetToken)}}, nil
-}
+	repositories, err := scm.md.sourceRepositories(ctx, repository)
+	if err != nil {
+		return migrationResult{}, err
+	}
 
-func (scm SecretScanningMigration) Migrate(ctx context.Context, repository string) error {
-	logger := logging.NewLoggerFromContext(ctx, false)
+	mr := migrationResult{
+		SourceOrg: scm.md.orgs.source,
+		TargetOrg: scm.md.orgs.target,
+	}
 
-	var repositories []github.Repository
-	if repository == "" {
-		slog.Info("fetching repositories from source organization")
+	scm.md.processRepositories(ctx, &mr, repositories, scm.md.options.Concurrency, scm.Process, nil)
 
-		repositories, _ = scm.md.orgs.sourceGC.GetRepositories(ctx, scm.md.orgs.source)
-	} else {
-		repo, err := scm.md.orgs.sourceGC.GetRepository(ctx, repository, scm.md.orgs.source)
+	mr.Timestamp = time.Now().UTC()
+	mr.Interrupted = ctx.Err() != nil
 
-		if err != nil {
-			slog.Error("error getting repository: "+repository, err)
-			return err
-		}
+	return mr, nil
+}
 
-		repositories = append(repositories, repo)
-	}
+func (scm SecretScanningMigration) Process(repository github.Repository, ctx context.Context) (repoStatus, error) {
+	status := newRepoStatus(repository)
+	logger := logging.NewLoggerFromContext(ctx, false)
 
-	for _, repository := range repositories {
-		if *repository.Name == ".github" {
-			continue
-		}
-		err := scm.md.CheckAndMigrateSecretScanning(ctx, logger, repository)
+	err := scm.md.CheckAndMigrateSecretScanning(ctx, logger, repository, &status)
+	status.finish(err)
 
-		if err != nil {
-			slog.Error("error migrating secret scanning for repository: " + *repository.Name)
-			continue
-		}
+	if err != nil {
+		slog.Error("error migrating secret scanning for repository: "+*repository.Name, "error", err)
+		return status, err
 	}
 
-	return nil
+	return status, nil
 }
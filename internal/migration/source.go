@@ -0,0 +1,141 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// SourceProvider is a source other than GitHub, such as Azure DevOps or
+// Bitbucket Server. Repositories are migrated with the GEI extension of the
+// provider and the GitHub specific source steps (GHAS, workflows, archiving)
+// are skipped. The target steps are the same as for GitHub sources.
+type SourceProvider interface {
+	Name() string
+	// Extension is the gh CLI extension that migrates the repositories
+	Extension() string
+	GetRepositories(ctx context.Context) ([]github.Repository, error)
+	GetRepository(ctx context.Context, name string) (github.Repository, error)
+	// MigrateRepo migrates a repository to the target organization as
+	// targetRepository and returns the migration ID, if one was reported
+	MigrateRepo(ctx context.Context, repository, targetRepository string) (string, error)
+	// DisableRepo makes a migrated repository unusable at source, the
+	// equivalent of archiving a GitHub source repository
+	DisableRepo(ctx context.Context, repository string) error
+}
+
+// ErrUnsupportedSource is returned by operations that only apply to GitHub
+// sources
+var ErrUnsupportedSource = errors.New("operation is only supported for GitHub sources")
+
+// getSourceRepositories returns the repositories of the source that match
+// the repository filter
+func (md MigrationData) getSourceRepositories(ctx context.Context) ([]github.Repository, error) {
+	var repositories []github.Repository
+	var err error
+	if md.provider != nil {
+		repositories, err = md.provider.GetRepositories(ctx)
+	} else {
+		repositories, err = md.orgs.sourceGC.GetRepositories(ctx, md.orgs.source)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return md.options.Filter.apply(repositories), nil
+}
+
+// getSourceRepository returns a repository of the source
+func (md MigrationData) getSourceRepository(ctx context.Context, name string) (github.Repository, error) {
+	if md.provider != nil {
+		return md.provider.GetRepository(ctx, name)
+	}
+
+	return md.orgs.sourceGC.GetRepository(ctx, name, md.orgs.source)
+}
+
+// requireGitHubSource returns ErrUnsupportedSource for sources other than
+// GitHub
+func (md MigrationData) requireGitHubSource() error {
+	if md.provider != nil {
+		return fmt.Errorf("%s source: %w", md.provider.Name(), ErrUnsupportedSource)
+	}
+
+	return nil
+}
+
+// processProviderRepoMigration migrates a repository of a SourceProvider,
+// sets it up at target and disables it at source. Like processRepoMigration,
+// cancelling ctx only stops repositories that were not handed to the
+// provider yet.
+func (md MigrationData) processProviderRepoMigration(ctx context.Context, logger *slog.Logger, repository github.Repository, status *repoStatus, resume bool) error {
+	interrupt := ctx
+	ctx = context.WithoutCancel(ctx)
+	if deadline, ok := interrupt.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	targetName := md.targetName(*repository.Name)
+	if status != nil && targetName != *repository.Name {
+		status.TargetName = targetName
+	}
+
+	logger.Info("migration", "repository", *repository.Name, "target", targetName, "source", md.provider.Name())
+
+	if interrupt.Err() != nil {
+		status.fail("migrating", ErrInterrupted)
+		return ErrInterrupted
+	}
+
+	ew := errWritter{status: status}
+
+	if resume {
+		logger.Info("repository was migrated in an earlier run, skipping the migration", "repository", *repository.Name)
+	} else {
+		ew.logAndCallStep(logger, "migrating", func() error {
+			migrationID, err := md.provider.MigrateRepo(ctx, *repository.Name, targetName)
+			if status != nil && migrationID != "" {
+				status.MigrationID = migrationID
+			}
+			return err
+		})
+	}
+
+	if _, err := md.setUpTarget(ctx, logger, &ew, targetName); err != nil {
+		return err
+	}
+
+	if md.enabled(StepTagProvenance) && ew.err == nil {
+		// missing provenance does not fail a migrated repository
+		pw := errWritter{status: status, optional: true}
+		pw.logAndCallStep(logger, "tagging provenance at target", func() error {
+			return md.tagProvenance(ctx, repository, targetName, ew.migrationID())
+		})
+	}
+
+	if !md.skip(StepArchiveSource) {
+		ew.logAndCallStep(logger, "disabling repository at source", func() error {
+			return md.provider.DisableRepo(ctx, *repository.Name)
+		})
+	}
+
+	if status != nil {
+		if targetRepository, err := md.orgs.targetGC.GetRepository(ctx, targetName, md.orgs.target); err == nil {
+			after := newRepoState(targetRepository)
+			status.After = &after
+		}
+	}
+
+	if ew.err != nil {
+		logger.Error("error", "error", ew.err)
+		return ew.err
+	}
+
+	return nil
+}
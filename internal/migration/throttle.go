@@ -0,0 +1,81 @@
+package migration
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/pkg/worker"
+)
+
+// Concurrency controls how many repositories are processed in parallel. The
+// number of workers scales between MinWorkers and MaxWorkers depending on the
+// rate limit headroom of the source and target clients.
+type Concurrency struct {
+	MinWorkers int
+	MaxWorkers int
+	JobTimeout time.Duration
+	// Limiter, if set, is shared with other migrations and caps the number
+	// of repositories processed at the same time across all of them
+	Limiter *worker.Limiter
+}
+
+const (
+	throttleInterval = 30 * time.Second
+	// below lowHeadroom only MinWorkers run, above highHeadroom MaxWorkers run
+	// and in between the number of workers is scaled linearly
+	lowHeadroom  = 0.1
+	highHeadroom = 0.5
+)
+
+func (c Concurrency) workersForHeadroom(headroom float64) int {
+	minWorkers := max(1, min(c.MinWorkers, c.MaxWorkers))
+
+	switch {
+	case headroom <= lowHeadroom:
+		return minWorkers
+	case headroom >= highHeadroom:
+		return c.MaxWorkers
+	}
+
+	scale := (headroom - lowHeadroom) / (highHeadroom - lowHeadroom)
+	return minWorkers + int(scale*float64(c.MaxWorkers-minWorkers))
+}
+
+// adaptConcurrency resizes the pool according to the rate limit headroom
+// every throttleInterval until ctx is done
+func adaptConcurrency[J, R any](ctx context.Context, pool *worker.Pool[J, R], rateLimits *github.RateLimitMonitor, c Concurrency) {
+	if rateLimits == nil || c.MinWorkers >= c.MaxWorkers {
+		return
+	}
+
+	ticker := time.NewTicker(throttleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		headroom := rateLimits.Headroom()
+		budgets := rateLimits.Budgets()
+		descriptions := make([]string, len(budgets))
+		for i, budget := range budgets {
+			descriptions[i] = budget.String()
+		}
+		slog.Info("rate limit budget", "headroom", headroom, "budgets", strings.Join(descriptions, ", "))
+
+		current := pool.Progress().Workers
+		workers := pool.SetWorkers(c.workersForHeadroom(headroom))
+
+		if workers < current {
+			slog.Warn("throttling: reducing workers", "from", current, "to", workers, "headroom", headroom)
+		} else if workers > current {
+			slog.Info("throttling: increasing workers", "from", current, "to", workers, "headroom", headroom)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package migration
+
+import "testing"
+
+func TestWorkersForHeadroom(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		concurrency Concurrency
+		headroom    float64
+		want        int
+	}{
+		{"exhausted", Concurrency{MinWorkers: 2, MaxWorkers: 10}, 0, 2},
+		{"at the low threshold", Concurrency{MinWorkers: 2, MaxWorkers: 10}, lowHeadroom, 2},
+		{"between the thresholds", Concurrency{MinWorkers: 2, MaxWorkers: 10}, 0.2, 4},
+		{"closer to the high threshold", Concurrency{MinWorkers: 2, MaxWorkers: 10}, 0.4, 8},
+		{"at the high threshold", Concurrency{MinWorkers: 2, MaxWorkers: 10}, highHeadroom, 10},
+		{"full", Concurrency{MinWorkers: 2, MaxWorkers: 10}, 1, 10},
+		{"at least one worker", Concurrency{MinWorkers: 0, MaxWorkers: 10}, 0, 1},
+		{"minimum above maximum", Concurrency{MinWorkers: 8, MaxWorkers: 4}, 0, 4},
+		{"no scaling", Concurrency{MinWorkers: 4, MaxWorkers: 4}, 0.2, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.concurrency.workersForHeadroom(tc.headroom); got != tc.want {
+				t.Errorf("got %d workers, want %d", got, tc.want)
+			}
+		})
+	}
+}
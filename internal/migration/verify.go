@@ -0,0 +1,263 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+const (
+	verifyPass    = "pass"
+	verifyFail    = "fail"
+	verifySkipped = "skipped"
+)
+
+// maxListedRefs is the number of mismatching refs named in a check message
+const maxListedRefs = 10
+
+// verifyCheck is the comparison of one property of a repository at source
+// and target. Checks that could not be read on one side are skipped.
+type verifyCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Source  string `json:"source,omitempty"`
+	Target  string `json:"target,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// verified records the checks of a repository and marks it as degraded if
+// one of them failed
+func (rs *repoStatus) verified(checks []verifyCheck) {
+	rs.Verification = checks
+	rs.Degraded = rs.Degraded || slices.ContainsFunc(checks, func(check verifyCheck) bool { return check.Status == verifyFail })
+}
+
+// Verify compares the migrated repositories with their source, a single
+// repository or, if repository is empty, all repositories of the source
+// organization. Repositories that differ are listed as degraded, the ones
+// that do not exist at target as failed.
+func (om OrgMigration) Verify(ctx context.Context, repository string) (migrationResult, error) {
+	if err := om.md.requireGitHubSource(); err != nil {
+		return migrationResult{}, err
+	}
+
+	repositories, err := om.md.sourceRepositories(ctx, repository)
+	if err != nil {
+		return migrationResult{}, err
+	}
+
+	if err := om.resolveRoutes(ctx, repositories); err != nil {
+		return migrationResult{}, err
+	}
+
+	mr := migrationResult{
+		SourceOrg: om.md.orgs.source,
+		TargetOrg: om.md.orgs.target,
+	}
+
+	om.md.processRepositories(ctx, &mr, repositories, om.md.options.Concurrency, om.verifyRepository, nil)
+
+	mr.Timestamp = time.Now().UTC()
+	mr.Interrupted = ctx.Err() != nil
+
+	slog.Info("verification finished", "verified", len(mr.Migrated), "degraded", len(mr.Degraded), "failed", len(mr.Failed))
+
+	return mr, nil
+}
+
+func (om OrgMigration) verifyRepository(repository github.Repository, ctx context.Context) (repoStatus, error) {
+	md := om.migrationFor(repository)
+	status := newRepoStatus(repository)
+	targetName := md.targetName(*repository.Name)
+	if targetName != *repository.Name {
+		status.TargetName = targetName
+	}
+	if md.orgs.target != om.md.orgs.target {
+		status.TargetOrg = md.orgs.target
+	}
+
+	if _, err := md.orgs.targetGC.GetRepository(ctx, targetName, md.orgs.target); err != nil {
+		status.fail("verify", err)
+		status.finish(err)
+		return status, err
+	}
+
+	status.verified(md.compareWithSource(ctx, *repository.Name, targetName, true))
+	status.finish(nil)
+
+	if status.Degraded {
+		slog.Warn("repository differs from its source", "name", *repository.Name, "target", md.orgs.target+"/"+targetName)
+	}
+
+	return status, nil
+}
+
+// compareWithSource compares the refs, counts and alerts of a repository at
+// source and target. Secret scanning alerts are only compared if
+// secretScanning is set, as they are migrated by a separate command.
+func (md MigrationData) compareWithSource(ctx context.Context, sourceName, targetName string, secretScanning bool) []verifyCheck {
+	var checks []verifyCheck
+
+	source, sourceErr := md.orgs.sourceGC.GetRepositorySnapshot(ctx, md.orgs.source, sourceName)
+	target, targetErr := md.orgs.targetGC.GetRepositorySnapshot(ctx, md.orgs.target, targetName)
+	if err := firstError(sourceErr, targetErr); err != nil {
+		for _, name := range []string{"branches", "tags", "default branch", "commits", "issues", "pull requests", "releases"} {
+			checks = append(checks, verifyCheck{Name: name, Status: verifySkipped, Message: err.Error()})
+		}
+	} else {
+		checks = append(checks,
+			compareValues("branches", len(source.Branches), len(target.Branches)),
+			compareRefs("branch heads", source.Branches, target.Branches),
+			compareValues("tags", len(source.Tags), len(target.Tags)),
+			compareRefs("tag heads", source.Tags, target.Tags),
+			compareValues("default branch", source.DefaultBranch, target.DefaultBranch),
+			compareValues("commits", source.Commits, target.Commits),
+			compareValues("issues", source.Issues, target.Issues),
+			compareValues("pull requests", source.PullRequests, target.PullRequests),
+			compareValues("releases", source.Releases, target.Releases),
+		)
+	}
+
+	if md.options.VerifyGit {
+		checks = append(checks, md.compareGitRefs(ctx, sourceName, targetName))
+	}
+
+	sourceAnalyses, sourceAlerts, sourceErr := md.orgs.sourceGC.GetCodeScanningCounts(ctx, md.orgs.source, sourceName)
+	targetAnalyses, targetAlerts, targetErr := md.orgs.targetGC.GetCodeScanningCounts(ctx, md.orgs.target, targetName)
+	if err := firstError(sourceErr, targetErr); err != nil {
+		checks = append(checks,
+			verifyCheck{Name: "code scanning analyses", Status: verifySkipped, Message: err.Error()},
+			verifyCheck{Name: "code scanning alerts", Status: verifySkipped, Message: err.Error()})
+	} else {
+		checks = append(checks,
+			compareValues("code scanning analyses", sourceAnalyses, targetAnalyses),
+			compareValues("code scanning alerts", formatCounts(sourceAlerts), formatCounts(targetAlerts)))
+	}
+
+	if !secretScanning {
+		checks = append(checks, verifyCheck{Name: "secret scanning alerts", Status: verifySkipped,
+			Message: "compared by the verify command after migrate-secret-scanning"})
+		return checks
+	}
+
+	sourceSecrets, sourceErr := md.orgs.sourceGC.GetSecretScanningAlertCounts(ctx, md.orgs.source, sourceName)
+	targetSecrets, targetErr := md.orgs.targetGC.GetSecretScanningAlertCounts(ctx, md.orgs.target, targetName)
+	if err := firstError(sourceErr, targetErr); err != nil {
+		checks = append(checks, verifyCheck{Name: "secret scanning alerts", Status: verifySkipped, Message: err.Error()})
+	} else {
+		checks = append(checks, compareValues("secret scanning alerts", formatCounts(sourceSecrets), formatCounts(targetSecrets)))
+	}
+
+	return checks
+}
+
+// compareGitRefs mirror clones the repository from source and target into a
+// temporary directory and compares all refs, including tags and notes. Pull
+// request merge refs are left out as GitHub computes them on each side.
+func (md MigrationData) compareGitRefs(ctx context.Context, sourceName, targetName string) verifyCheck {
+	dir, err := os.MkdirTemp("", "gei-verify-")
+	if err != nil {
+		return verifyCheck{Name: "git refs", Status: verifySkipped, Message: err.Error()}
+	}
+	defer os.RemoveAll(dir)
+
+	source, sourceErr := md.orgs.sourceGit.MirrorRefs(ctx, md.orgs.source, sourceName, filepath.Join(dir, "source.git"))
+	var target map[string]string
+	var targetErr error
+	if sourceErr == nil {
+		target, targetErr = md.orgs.targetGit.MirrorRefs(ctx, md.orgs.target, targetName, filepath.Join(dir, "target.git"))
+	}
+	if err := firstError(sourceErr, targetErr); err != nil {
+		return verifyCheck{Name: "git refs", Status: verifySkipped, Message: err.Error()}
+	}
+
+	for _, refs := range []map[string]string{source, target} {
+		for ref := range refs {
+			if strings.HasPrefix(ref, "refs/pull/") && strings.HasSuffix(ref, "/merge") {
+				delete(refs, ref)
+			}
+		}
+	}
+
+	check := compareRefs("git refs", source, target)
+	check.Source, check.Target = strconv.Itoa(len(source)), strconv.Itoa(len(target))
+	return check
+}
+
+// firstError returns the first error that is not nil, labelled with the side
+// it came from
+func firstError(sourceErr, targetErr error) error {
+	if sourceErr != nil {
+		return fmt.Errorf("source: %w", sourceErr)
+	}
+	if targetErr != nil {
+		return fmt.Errorf("target: %w", targetErr)
+	}
+	return nil
+}
+
+func compareValues[T comparable](name string, source, target T) verifyCheck {
+	check := verifyCheck{Name: name, Status: verifyPass, Source: fmt.Sprint(source), Target: fmt.Sprint(target)}
+	if source != target {
+		check.Status = verifyFail
+	}
+	return check
+}
+
+// compareRefs checks that every ref of the source points to the same object
+// at target
+func compareRefs(name string, source, target map[string]string) verifyCheck {
+	var mismatches []string
+	for ref, sha := range source {
+		switch targetSHA, ok := target[ref]; {
+		case !ok:
+			mismatches = append(mismatches, ref+" (missing)")
+		case targetSHA != sha:
+			mismatches = append(mismatches, ref)
+		}
+	}
+	for ref := range target {
+		if _, ok := source[ref]; !ok {
+			mismatches = append(mismatches, ref+" (not at source)")
+		}
+	}
+
+	if len(mismatches) == 0 {
+		return verifyCheck{Name: name, Status: verifyPass}
+	}
+
+	slices.Sort(mismatches)
+	message := strings.Join(mismatches[:min(len(mismatches), maxListedRefs)], ", ")
+	if len(mismatches) > maxListedRefs {
+		message += fmt.Sprintf(" and %d more", len(mismatches)-maxListedRefs)
+	}
+
+	return verifyCheck{Name: name, Status: verifyFail, Message: strconv.Itoa(len(mismatches)) + " refs differ: " + message}
+}
+
+// formatCounts formats counts by key as "key=count" sorted by key
+func formatCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + strconv.Itoa(counts[key])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,139 @@
+package migration
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+)
+
+// git runs git in dir and fails the test on errors
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(cmd.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com", "GIT_CONFIG_GLOBAL=/dev/null")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// gitRefsFixture creates a work tree with a commit, a branch, a tag and a
+// note and pushes it to the bare repositories source/repo.git and
+// target/repo.git below root
+func gitRefsFixture(t *testing.T) (root, work string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root = t.TempDir()
+	work = filepath.Join(root, "work")
+	git(t, root, "init", "--quiet", "--initial-branch=main", work)
+	git(t, work, "commit", "--quiet", "--allow-empty", "-m", "initial")
+	git(t, work, "branch", "feature")
+	git(t, work, "tag", "v1.0.0")
+	git(t, work, "notes", "add", "-m", "reviewed")
+
+	for _, org := range []string{"source", "target"} {
+		bare := filepath.Join(root, org, "repo.git")
+		git(t, root, "init", "--quiet", "--bare", bare)
+		git(t, work, "push", "--quiet", "--mirror", bare)
+	}
+
+	return root, work
+}
+
+func verifyGitData(t *testing.T, root string) MigrationData {
+	t.Helper()
+
+	var md MigrationData
+	md.orgs.source, md.orgs.target = "source", "target"
+	for _, host := range []*github.GitHost{&md.orgs.sourceGit, &md.orgs.targetGit} {
+		var err error
+		if *host, err = github.NewGitHostAt("file://"+filepath.ToSlash(root), nil); err != nil {
+			t.Fatalf("NewGitHostAt: %v", err)
+		}
+	}
+	return md
+}
+
+func TestCompareGitRefsPass(t *testing.T) {
+	root, _ := gitRefsFixture(t)
+
+	check := verifyGitData(t, root).compareGitRefs(context.Background(), "repo", "repo")
+	if check.Status != verifyPass {
+		t.Fatalf("got %+v, want a passing check", check)
+	}
+	// main, feature, v1.0.0 and the notes
+	if check.Source != "4" || check.Target != "4" {
+		t.Errorf("got %s refs at source and %s at target, want 4", check.Source, check.Target)
+	}
+}
+
+func TestCompareGitRefsDiverged(t *testing.T) {
+	root, work := gitRefsFixture(t)
+	source := filepath.Join(root, "source", "repo.git")
+
+	// the branch moves, the tag points elsewhere and the note changes at
+	// source after the target was migrated
+	git(t, work, "checkout", "--quiet", "feature")
+	git(t, work, "commit", "--quiet", "--allow-empty", "-m", "late push")
+	git(t, work, "tag", "--force", "v1.0.0")
+	git(t, work, "notes", "add", "--force", "-m", "reviewed again", "main")
+	git(t, work, "push", "--quiet", "--force", source, "feature", "refs/tags/v1.0.0", "refs/notes/commits")
+	// a branch that only exists at target
+	git(t, filepath.Join(root, "target", "repo.git"), "branch", "extra", "main")
+
+	check := verifyGitData(t, root).compareGitRefs(context.Background(), "repo", "repo")
+	if check.Status != verifyFail {
+		t.Fatalf("got %+v, want a failing check", check)
+	}
+
+	want := "4 refs differ: refs/heads/extra (not at source), refs/heads/feature, refs/notes/commits, refs/tags/v1.0.0"
+	if check.Message != want {
+		t.Errorf("got message %q, want %q", check.Message, want)
+	}
+	if check.Source != "4" || check.Target != "5" {
+		t.Errorf("got %s refs at source and %s at target, want 4 and 5", check.Source, check.Target)
+	}
+}
+
+func TestCompareGitRefsMissingRepository(t *testing.T) {
+	root, _ := gitRefsFixture(t)
+
+	check := verifyGitData(t, root).compareGitRefs(context.Background(), "repo", "missing")
+	if check.Status != verifySkipped || !strings.HasPrefix(check.Message, "target: ") {
+		t.Errorf("got %+v, want a check skipped because of the target", check)
+	}
+}
+
+func TestNewGitHostAt(t *testing.T) {
+	for _, tc := range []struct {
+		url   string
+		valid bool
+	}{
+		{"file:///srv/git", true},
+		{"https://git.example.com/", true},
+		{"http://localhost:3000", true},
+		{"file://", false},
+		{"https://", false},
+		{"ssh://git@example.com", false},
+		{"/srv/git", false},
+	} {
+		host, err := github.NewGitHostAt(tc.url, nil)
+		if (err == nil) != tc.valid {
+			t.Errorf("NewGitHostAt(%q): got error %v, want valid %t", tc.url, err, tc.valid)
+		}
+		if err == nil && strings.HasSuffix(host.BaseURL, "/") {
+			t.Errorf("NewGitHostAt(%q): base URL %q ends with a slash", tc.url, host.BaseURL)
+		}
+	}
+}
@@ -0,0 +1,522 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/gei-migration-helper/internal/github"
+	"github.com/gateixeira/gei-migration-helper/pkg/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// Checks of the workflow lint
+const (
+	lintSyntax      = "syntax"
+	lintRunner      = "runner"
+	lintSecret      = "secret"
+	lintVariable    = "variable"
+	lintAction      = "action"
+	lintEnvironment = "environment"
+)
+
+// workflowFinding is a reason a workflow will fail at target
+type workflowFinding struct {
+	Workflow string `json:"workflow"`
+	Job      string `json:"job,omitempty"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+}
+
+var (
+	secretPattern   = regexp.MustCompile(`\bsecrets\.([A-Za-z_][A-Za-z0-9_]*)`)
+	variablePattern = regexp.MustCompile(`\bvars\.([A-Za-z_][A-Za-z0-9_]*)`)
+	// hostedRunnerPattern matches the labels of the standard GitHub-hosted
+	// runners, e.g. ubuntu-latest or macos-14
+	hostedRunnerPattern = regexp.MustCompile(`(?i)^(ubuntu|windows|macos)-(latest|[0-9.]+)(-arm|-arm64|-large|-xlarge)?$`)
+)
+
+// targetActions are the Actions settings of a target organization the
+// workflows of its repositories are linted against
+type targetActions struct {
+	secrets      []github.OrgActionsValue
+	variables    []github.OrgActionsValue
+	runnerGroups []github.RunnerGroup
+	policy       github.ActionsPolicy
+}
+
+// repoActions are the Actions settings of a target repository, names by
+// their lowercase form
+type repoActions struct {
+	secrets      map[string]bool
+	variables    map[string]bool
+	environments map[string]bool
+	// runners holds the labels of every runner the repository can use, by
+	// runner group name, with "" for repository runners
+	runners map[string][][]string
+	policy  github.ActionsPolicy
+}
+
+func (md MigrationData) loadTargetActions(ctx context.Context) (targetActions, error) {
+	var actions targetActions
+	var err error
+
+	if actions.secrets, err = md.orgs.targetGC.GetOrgSecrets(ctx, md.orgs.target); err != nil {
+		return targetActions{}, fmt.Errorf("error reading organization secrets: %w", err)
+	}
+	if actions.variables, err = md.orgs.targetGC.GetOrgVariables(ctx, md.orgs.target); err != nil {
+		return targetActions{}, fmt.Errorf("error reading organization variables: %w", err)
+	}
+	if actions.runnerGroups, err = md.orgs.targetGC.GetRunnerGroups(ctx, md.orgs.target); err != nil {
+		return targetActions{}, fmt.Errorf("error reading runner groups: %w", err)
+	}
+	if actions.policy, err = md.orgs.targetGC.GetOrgActionsPolicy(ctx, md.orgs.target); err != nil {
+		return targetActions{}, fmt.Errorf("error reading actions policy: %w", err)
+	}
+
+	return actions, nil
+}
+
+// loadRoutedTargetActions reads the settings of every target organization
+// repositories are routed to, once per organization, by lower case name
+func (om OrgMigration) loadRoutedTargetActions(ctx context.Context, repositories []github.Repository) (map[string]targetActions, error) {
+	actions := make(map[string]targetActions)
+	for _, repository := range repositories {
+		md := om.migrationFor(repository)
+		target := strings.ToLower(md.orgs.target)
+		if _, ok := actions[target]; ok {
+			continue
+		}
+
+		org, err := md.loadTargetActions(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", md.orgs.target, err)
+		}
+		actions[target] = org
+	}
+
+	return actions, nil
+}
+
+// visible reports whether a repository can use an organization secret,
+// variable or runner group of the given visibility
+func visible(visibility string, selected []int64, repository github.Repository) bool {
+	switch visibility {
+	case "all":
+		return true
+	case "private":
+		return repository.Visibility == nil || *repository.Visibility != "public"
+	default:
+		return slices.Contains(selected, *repository.ID)
+	}
+}
+
+// loadRepoActions reads the settings of a target repository and merges them
+// with the organization settings it can use
+func (md MigrationData) loadRepoActions(ctx context.Context, org targetActions, repository github.Repository) (repoActions, error) {
+	actions := repoActions{
+		secrets:      map[string]bool{"github_token": true},
+		variables:    make(map[string]bool),
+		environments: make(map[string]bool),
+		runners:      make(map[string][][]string),
+	}
+	add := func(set map[string]bool, names []string) {
+		for _, name := range names {
+			set[strings.ToLower(name)] = true
+		}
+	}
+
+	for _, secret := range org.secrets {
+		if visible(secret.Visibility, secret.SelectedRepositoryIDs, repository) {
+			add(actions.secrets, []string{secret.Name})
+		}
+	}
+	for _, variable := range org.variables {
+		if visible(variable.Visibility, variable.SelectedRepositoryIDs, repository) {
+			add(actions.variables, []string{variable.Name})
+		}
+	}
+	for _, group := range org.runnerGroups {
+		public := repository.Visibility != nil && *repository.Visibility == "public"
+		if visible(group.Visibility, group.SelectedRepositoryIDs, repository) && (!public || group.AllowsPublicRepositories) {
+			actions.runners[strings.ToLower(group.Name)] = group.Runners
+		}
+	}
+
+	name := *repository.Name
+	gc := md.orgs.targetGC
+
+	secrets, err := gc.GetRepoSecretNames(ctx, md.orgs.target, name)
+	if err != nil {
+		return repoActions{}, err
+	}
+	add(actions.secrets, secrets)
+
+	variables, err := gc.GetRepoVariableNames(ctx, md.orgs.target, name)
+	if err != nil {
+		return repoActions{}, err
+	}
+	add(actions.variables, variables)
+
+	environments, err := gc.GetEnvironmentNames(ctx, md.orgs.target, name)
+	if err != nil {
+		return repoActions{}, err
+	}
+	add(actions.environments, environments)
+
+	// a value of any environment is accepted, jobs are not matched to the
+	// environment they run in
+	for _, environment := range environments {
+		secrets, err := gc.GetEnvironmentSecretNames(ctx, *repository.ID, environment)
+		if err != nil {
+			return repoActions{}, err
+		}
+		add(actions.secrets, secrets)
+
+		variables, err := gc.GetEnvironmentVariableNames(ctx, *repository.ID, environment)
+		if err != nil {
+			return repoActions{}, err
+		}
+		add(actions.variables, variables)
+	}
+
+	if actions.runners[""], err = gc.GetRepoRunnerLabels(ctx, md.orgs.target, name); err != nil {
+		return repoActions{}, err
+	}
+
+	if actions.policy, err = gc.GetRepoActionsPolicy(ctx, md.orgs.target, name); err != nil {
+		return repoActions{}, err
+	}
+
+	return actions, nil
+}
+
+// workflowFile is the part of a workflow the lint reads
+type workflowFile struct {
+	Jobs map[string]workflowJob `yaml:"jobs"`
+}
+
+type workflowJob struct {
+	RunsOn      yaml.Node `yaml:"runs-on"`
+	Environment yaml.Node `yaml:"environment"`
+	// Uses calls a reusable workflow
+	Uses  string `yaml:"uses"`
+	Steps []struct {
+		Uses string `yaml:"uses"`
+	} `yaml:"steps"`
+}
+
+// nodeStrings returns the strings of a scalar or sequence node
+func nodeStrings(node *yaml.Node) []string {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}
+	case yaml.SequenceNode:
+		var values []string
+		for _, item := range node.Content {
+			if item.Kind == yaml.ScalarNode {
+				values = append(values, item.Value)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// mappingValue returns the value of a key of a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func isExpression(value string) bool {
+	return strings.Contains(value, "${{")
+}
+
+// lintWorkflow checks a workflow against the Actions settings of its target
+// organization and repository
+func (md MigrationData) lintWorkflow(file, content string, org targetActions, repo repoActions) []workflowFinding {
+	var findings []workflowFinding
+	finding := func(job, check, format string, args ...any) {
+		findings = append(findings, workflowFinding{Workflow: file, Job: job, Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var workflow workflowFile
+	if err := yaml.Unmarshal([]byte(content), &workflow); err != nil {
+		finding("", lintSyntax, "%v", err)
+		return findings
+	}
+
+	if !org.policy.Enabled || !repo.policy.Enabled {
+		finding("", lintAction, "GitHub Actions is disabled for the repository")
+	}
+
+	for _, pattern := range []struct {
+		regexp  *regexp.Regexp
+		defined map[string]bool
+		check   string
+	}{{secretPattern, repo.secrets, lintSecret}, {variablePattern, repo.variables, lintVariable}} {
+		var missing []string
+		for _, match := range pattern.regexp.FindAllStringSubmatch(content, -1) {
+			if !pattern.defined[strings.ToLower(match[1])] && !slices.Contains(missing, match[1]) {
+				missing = append(missing, match[1])
+				finding("", pattern.check, "%s %s is not defined for the repository", pattern.check, match[1])
+			}
+		}
+	}
+
+	jobs := make([]string, 0, len(workflow.Jobs))
+	for job := range workflow.Jobs {
+		jobs = append(jobs, job)
+	}
+	slices.Sort(jobs)
+
+	for _, name := range jobs {
+		job := workflow.Jobs[name]
+
+		if message := repo.runnerProblem(&job.RunsOn); message != "" {
+			finding(name, lintRunner, "%s", message)
+		}
+
+		environment := &job.Environment
+		if value := mappingValue(environment, "name"); value != nil {
+			environment = value
+		}
+		if environment.Kind == yaml.ScalarNode && environment.Value != "" && !isExpression(environment.Value) &&
+			!repo.environments[strings.ToLower(environment.Value)] {
+			finding(name, lintEnvironment, "environment %s does not exist", environment.Value)
+		}
+
+		uses := []string{job.Uses}
+		for _, step := range job.Steps {
+			uses = append(uses, step.Uses)
+		}
+		for _, action := range uses {
+			if action == "" || isExpression(action) || strings.HasPrefix(action, "./") || strings.HasPrefix(action, "docker://") {
+				continue
+			}
+			if !actionAllowed(org.policy, md.orgs.target, action) || !actionAllowed(repo.policy, md.orgs.target, action) {
+				finding(name, lintAction, "%s is not allowed by the actions policy", action)
+			}
+		}
+	}
+
+	return findings
+}
+
+// runnerProblem returns why no runner the repository can use matches a
+// runs-on value, or an empty string if one does
+func (repo repoActions) runnerProblem(runsOn *yaml.Node) string {
+	var group string
+	labels := nodeStrings(runsOn)
+	if runsOn.Kind == yaml.MappingNode {
+		if value := mappingValue(runsOn, "group"); value != nil {
+			group = value.Value
+		}
+		labels = nil
+		if value := mappingValue(runsOn, "labels"); value != nil {
+			labels = nodeStrings(value)
+		}
+	}
+
+	if isExpression(group) || slices.ContainsFunc(labels, isExpression) {
+		return ""
+	}
+
+	if group == "" && len(labels) == 1 && hostedRunnerPattern.MatchString(labels[0]) {
+		return ""
+	}
+	if group == "" && len(labels) == 0 {
+		return ""
+	}
+
+	var candidates [][]string
+	if group != "" {
+		runners, ok := repo.runners[strings.ToLower(group)]
+		if !ok {
+			return fmt.Sprintf("runner group %s is not available to the repository", group)
+		}
+		// larger runners of the group are not listed, any label may match
+		if len(labels) == 0 || len(runners) == 0 {
+			return ""
+		}
+		candidates = runners
+	} else {
+		for _, runners := range repo.runners {
+			candidates = append(candidates, runners...)
+		}
+	}
+
+	for _, runner := range candidates {
+		if !slices.ContainsFunc(labels, func(label string) bool {
+			return !slices.ContainsFunc(runner, func(l string) bool { return strings.EqualFold(l, label) })
+		}) {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("no self-hosted runner available to the repository has the labels %s", strings.Join(labels, ", "))
+}
+
+// actionAllowed reports whether an action or reusable workflow, as written
+// in uses, is allowed by a policy of an organization
+func actionAllowed(policy github.ActionsPolicy, org string, uses string) bool {
+	owner, _, _ := strings.Cut(uses, "/")
+	switch {
+	case policy.AllowedActions == "" || policy.AllowedActions == "all":
+		return true
+	case strings.EqualFold(owner, org):
+		return true
+	case policy.AllowedActions == "local_only":
+		return false
+	case policy.GitHubOwnedAllowed && (strings.EqualFold(owner, "actions") || strings.EqualFold(owner, "github")):
+		return true
+	case policy.VerifiedAllowed:
+		// whether the creator of an action is verified is not exposed by the
+		// API, so these are not flagged
+		return true
+	}
+
+	return slices.ContainsFunc(policy.PatternsAllowed, func(pattern string) bool { return actionMatches(pattern, uses) })
+}
+
+// actionMatches matches uses against an allowed actions pattern, e.g.
+// octo-org/*, octo-org/action@v2 or octo-org/*@*, where * matches anything
+func actionMatches(pattern, uses string) bool {
+	name, ref, _ := strings.Cut(uses, "@")
+	namePattern, refPattern, ok := strings.Cut(pattern, "@")
+	if !ok {
+		refPattern = "*"
+	}
+
+	return globMatches(namePattern, name, true) && globMatches(refPattern, ref, false)
+}
+
+func globMatches(pattern, value string, foldCase bool) bool {
+	expression := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSpace(pattern)), `\*`, ".*") + "$"
+	if foldCase {
+		expression = "(?i)" + expression
+	}
+	matched, err := regexp.MatchString(expression, value)
+	return err == nil && matched
+}
+
+// lintRepositoryWorkflows reads the given workflows of a target repository
+// and lints them. The findings are sorted by workflow.
+func (md MigrationData) lintRepositoryWorkflows(ctx context.Context, org targetActions, targetName string, workflows []github.Workflow) ([]workflowFinding, error) {
+	repository, err := md.orgs.targetGC.GetRepository(ctx, targetName, md.orgs.target)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := md.loadRepoActions(ctx, org, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []workflowFinding
+	for _, workflow := range workflows {
+		if workflow.Path == nil {
+			continue
+		}
+
+		content, ok, err := md.orgs.targetGC.GetFileContent(ctx, md.orgs.target, targetName, *workflow.Path, "")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		findings = append(findings, md.lintWorkflow(*workflow.Path, content, org, repo)...)
+	}
+
+	return findings, nil
+}
+
+// LintWorkflows checks the workflows of the migrated repositories, a single
+// repository or, if repository is empty, all repositories of the
+// organization, against the Actions settings of the target: runner labels
+// and groups, secrets, variables, the allowed actions policy and
+// environments. Repositories routed to another organization are checked
+// there. Repositories with findings are listed as degraded.
+func (md MigrationData) LintWorkflows(ctx context.Context, repository string) (migrationResult, error) {
+	if err := md.requireGitHubSource(); err != nil {
+		return migrationResult{}, err
+	}
+
+	repositories, err := md.sourceRepositories(ctx, repository)
+	if err != nil {
+		return migrationResult{}, err
+	}
+
+	om, err := md.routeRepositories(ctx, repositories)
+	if err != nil {
+		return migrationResult{}, err
+	}
+
+	orgs, err := om.loadRoutedTargetActions(ctx, repositories)
+	if err != nil {
+		return migrationResult{}, err
+	}
+
+	mr := migrationResult{
+		SourceOrg: md.orgs.source,
+		TargetOrg: md.orgs.target,
+	}
+
+	md.processRepositories(ctx, &mr, repositories, md.options.Concurrency, func(repository github.Repository, ctx context.Context) (repoStatus, error) {
+		target := om.migrationFor(repository)
+		status, err := target.lintRepository(ctx, orgs[strings.ToLower(target.orgs.target)], repository)
+		if !strings.EqualFold(target.orgs.target, md.orgs.target) {
+			status.TargetOrg = target.orgs.target
+		}
+		return status, err
+	}, nil)
+
+	mr.Timestamp = time.Now().UTC()
+	mr.Interrupted = ctx.Err() != nil
+
+	slog.Info("workflow lint finished", "passed", len(mr.Migrated), "findings", len(mr.Degraded), "failed", len(mr.Failed))
+
+	return mr, nil
+}
+
+func (md MigrationData) lintRepository(ctx context.Context, org targetActions, repository github.Repository) (repoStatus, error) {
+	status := newRepoStatus(repository)
+	logger := logging.NewLoggerFromContext(ctx, false)
+	targetName := md.targetName(*repository.Name)
+	if targetName != *repository.Name {
+		status.TargetName = targetName
+	}
+
+	workflows, err := md.orgs.targetGC.GetAllWorkflowsForRepository(ctx, md.orgs.target, targetName)
+	if err == nil {
+		status.WorkflowFindings, err = md.lintRepositoryWorkflows(ctx, org, targetName, workflows)
+	}
+	if err != nil {
+		status.fail("linting workflows at target", err)
+		status.finish(err)
+		return status, err
+	}
+
+	status.Degraded = len(status.WorkflowFindings) > 0
+	for _, finding := range status.WorkflowFindings {
+		logger.Warn("workflow will fail at target", "repository", targetName, "workflow", finding.Workflow,
+			"job", finding.Job, "check", finding.Check, "message", finding.Message)
+	}
+
+	status.finish(nil)
+	return status, nil
+}
@@ -1,45 +1,370 @@
 package worker
 
 import (
+	"container/heap"
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/gateixeira/gei-migration-helper/pkg/logging"
 )
 
-type Processor func(interface{}, context.Context) error
+// Processor processes a single job. The context carries the worker ID, the
+// number of times the job was deferred and, if the pool has a job timeout,
+// the job deadline.
+type Processor[J, R any] func(J, context.Context) (R, error)
 
-type Error struct {
-	Err    error
-	Entity interface{}
+// Result is the outcome of a job
+type Result[J, R any] struct {
+	Job      J
+	Value    R
+	Err      error
+	Duration time.Duration
 }
 
-type Worker struct {
-	Processor Processor
-	jobs      chan interface{}
-	results   chan<- Error
+// Progress is a snapshot of the pool counters
+type Progress struct {
+	Queued    int `json:"queued"`
+	Running   int `json:"running"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// Deferred counts how often jobs were moved to the back of the queue
+	Deferred int `json:"deferred"`
+	Workers  int `json:"workers"`
 }
 
-func New(processor Processor, jobs chan interface{}, results chan<- Error) (*Worker, error) {
+// PanicError is returned for jobs whose processor panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panicked: %v\n%s", e.Value, e.Stack)
+}
+
+var (
+	ErrPoolClosed = errors.New("pool is closed")
+	// ErrJobTimeout is returned for jobs that did not finish before the job
+	// timeout. It wraps context.DeadlineExceeded.
+	ErrJobTimeout = fmt.Errorf("job timed out: %w", context.DeadlineExceeded)
+	// ErrNotStarted is returned for jobs that were cancelled while waiting
+	// for the limiter of the pool
+	ErrNotStarted = errors.New("job was not started")
+	// ErrDeferred is wrapped by processors to move their job to the back of
+	// the queue. The result is delivered and the job runs again once the jobs
+	// queued before it were started.
+	ErrDeferred = errors.New("job deferred")
+)
+
+type deferralsKey struct{}
+
+// Deferrals returns how often the job of a processor was deferred. ok is
+// false if ctx does not belong to a job of a pool, which cannot be deferred.
+func Deferrals(ctx context.Context) (n int, ok bool) {
+	n, ok = ctx.Value(deferralsKey{}).(int)
+	return n, ok
+}
+
+// Limiter caps the number of jobs running at the same time across all pools
+// that share it
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter creates a limiter that lets n jobs run at the same time
+func NewLimiter(n int) (*Limiter, error) {
+	if n < 1 {
+		return nil, errors.New("at least one slot is required")
+	}
+
+	return &Limiter{slots: make(chan struct{}, n)}, nil
+}
+
+func (l *Limiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) release() {
+	<-l.slots
+}
+
+// Pool runs jobs on up to a fixed number of workers. Jobs with a higher
+// priority are started first, jobs with the same priority in submission order.
+type Pool[J, R any] struct {
+	processor Processor[J, R]
+	workers   int
+	timeout   time.Duration
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    jobQueue[J]
+	seq      int
+	closed   bool
+	limit    int
+	progress Progress
+
+	limiter *Limiter
+}
+
+// NewPool creates a pool with the given number of workers. A timeout of zero
+// means jobs have no deadline.
+func NewPool[J, R any](workers int, timeout time.Duration, processor Processor[J, R]) (*Pool[J, R], error) {
 	if processor == nil {
 		return nil, errors.New("processor is nil")
 	}
 
-	return &Worker{
-		Processor: processor,
-		jobs:      jobs,
-		results:   results,
-	}, nil
+	if workers < 1 {
+		return nil, errors.New("at least one worker is required")
+	}
+
+	p := &Pool[J, R]{
+		processor: processor,
+		workers:   workers,
+		timeout:   timeout,
+		limit:     workers,
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	return p, nil
+}
+
+// Submit queues a job
+func (p *Pool[J, R]) Submit(job J, priority int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	heap.Push(&p.queue, &queuedJob[J]{job: job, priority: priority, seq: p.seq})
+	p.seq++
+	p.progress.Queued++
+	p.cond.Signal()
+
+	return nil
+}
+
+// Close signals that no more jobs will be submitted. Workers exit once the
+// queue is drained.
+func (p *Pool[J, R]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.cond.Broadcast()
+}
+
+// Progress returns a snapshot of the pool counters
+func (p *Pool[J, R]) Progress() Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	progress := p.progress
+	progress.Workers = p.limit
+	return progress
+}
+
+// SetWorkers changes how many jobs may run at the same time, between one and
+// the number of workers the pool was created with. Lowering it does not stop
+// running jobs; workers above the new limit wait once their job finishes.
+func (p *Pool[J, R]) SetWorkers(n int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.limit = max(1, min(n, p.workers))
+	p.cond.Broadcast()
+
+	return p.limit
+}
+
+// SetLimiter makes the pool share limiter with other pools. A job only runs
+// when the limiter has a free slot, the time spent waiting for it does not
+// count against the job timeout. It has to be called before Start.
+func (p *Pool[J, R]) SetLimiter(limiter *Limiter) {
+	p.limiter = limiter
+}
+
+// Start starts the workers and returns the channel results are delivered on.
+// The channel is closed when the pool is closed and all jobs are processed,
+// or when ctx is cancelled and the running jobs returned. Jobs still queued
+// when ctx is cancelled are not started.
+func (p *Pool[J, R]) Start(ctx context.Context) <-chan Result[J, R] {
+	results := make(chan Result[J, R], p.workers)
+
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.cond.Broadcast()
+	})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= p.workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			p.work(context.WithValue(ctx, logging.IDKey, id), results)
+		}(i)
+	}
+
+	go func() {
+		wg.Wait()
+		stop()
+		close(results)
+	}()
+
+	return results
 }
 
-func (w *Worker) Start(ctx context.Context) {
+func (p *Pool[J, R]) work(ctx context.Context, results chan<- Result[J, R]) {
 	slog.Debug("worker started", "id", ctx.Value(logging.IDKey))
-	for entity := range w.jobs {
+	for {
+		job, ok := p.next(ctx)
+		if !ok {
+			slog.Debug("worker finished", "id", ctx.Value(logging.IDKey))
+			return
+		}
+
 		slog.Debug("job received")
-		err := w.Processor(entity, ctx)
-		w.results <- Error{err, entity}
+		result := p.run(context.WithValue(ctx, deferralsKey{}, job.deferrals), job.job)
+
+		p.mu.Lock()
+		p.progress.Running--
+		if errors.Is(result.Err, ErrDeferred) {
+			// requeued before the result is delivered, so the pool cannot
+			// drain in between
+			heap.Push(&p.queue, &queuedJob[J]{job: job.job, priority: job.priority, seq: p.seq, deferrals: job.deferrals + 1})
+			p.seq++
+			p.progress.Queued++
+			p.progress.Deferred++
+		} else if result.Err != nil {
+			p.progress.Failed++
+		} else {
+			p.progress.Succeeded++
+		}
+		p.cond.Broadcast()
+		p.mu.Unlock()
+
+		results <- result
 		slog.Debug("job finished")
 	}
-	slog.Debug("worker finished", "id", ctx.Value(logging.IDKey))
+}
+
+// next blocks until a job is available. It returns false when the pool is
+// drained or ctx is cancelled.
+func (p *Pool[J, R]) next(ctx context.Context) (*queuedJob[J], bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for (p.queue.Len() == 0 && !p.closed || p.progress.Running >= p.limit) && ctx.Err() == nil {
+		p.cond.Wait()
+	}
+
+	if ctx.Err() != nil || p.queue.Len() == 0 {
+		return nil, false
+	}
+
+	job := heap.Pop(&p.queue).(*queuedJob[J])
+	p.progress.Queued--
+	p.progress.Running++
+
+	return job, true
+}
+
+// run processes a job, recovering panics and enforcing the job timeout. When
+// a job exceeds its timeout, its context expires and run waits for the
+// processor to return, so that no more than the allowed number of jobs ever
+// run. A job that fails after its timeout is reported as ErrJobTimeout.
+// With a limiter, run first waits for a free slot.
+// Cancelling ctx does not abandon the job; the processor decides how to react.
+func (p *Pool[J, R]) run(ctx context.Context, job J) Result[J, R] {
+	if p.limiter != nil {
+		if err := p.limiter.acquire(ctx); err != nil {
+			return Result[J, R]{Job: job, Err: ErrNotStarted}
+		}
+		defer p.limiter.release()
+	}
+
+	started := time.Now()
+	jobCtx := ctx
+	var timeout <-chan time.Time
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	done := make(chan Result[J, R], 1)
+	go func() {
+		result := Result[J, R]{Job: job}
+		defer func() {
+			if r := recover(); r != nil {
+				result.Err = &PanicError{Value: r, Stack: debug.Stack()}
+				slog.Error("job panicked", "panic", r)
+			}
+			done <- result
+		}()
+
+		result.Value, result.Err = p.processor(job, jobCtx)
+	}()
+
+	select {
+	case result := <-done:
+		result.Duration = time.Since(started)
+		return result
+	case <-timeout:
+		slog.Error("job timed out, waiting for it to stop", "timeout", p.timeout)
+	}
+
+	result := <-done
+	result.Duration = time.Since(started)
+	if result.Err != nil {
+		result.Err = fmt.Errorf("%w: %w", ErrJobTimeout, result.Err)
+	}
+	return result
+}
+
+type queuedJob[J any] struct {
+	job       J
+	priority  int
+	seq       int
+	deferrals int
+}
+
+type jobQueue[J any] []*queuedJob[J]
+
+func (q jobQueue[J]) Len() int { return len(q) }
+
+func (q jobQueue[J]) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q jobQueue[J]) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *jobQueue[J]) Push(x interface{}) { *q = append(*q, x.(*queuedJob[J])) }
+
+func (q *jobQueue[J]) Pop() interface{} {
+	old := *q
+	n := len(old)
+	job := old[n-1]
+	*q = old[:n-1]
+	return job
 }
@@ -0,0 +1,407 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrency records how many jobs run at the same time
+type concurrency struct {
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (c *concurrency) enter() {
+	n := c.running.Add(1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			return
+		}
+	}
+}
+
+func (c *concurrency) leave() {
+	c.running.Add(-1)
+}
+
+func newPool[J, R any](t *testing.T, workers int, timeout time.Duration, processor Processor[J, R]) *Pool[J, R] {
+	t.Helper()
+
+	pool, err := NewPool(workers, timeout, processor)
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+	return pool
+}
+
+func collect[J, R any](results <-chan Result[J, R]) []Result[J, R] {
+	var all []Result[J, R]
+	for result := range results {
+		all = append(all, result)
+	}
+	return all
+}
+
+func TestNewPoolValidation(t *testing.T) {
+	if _, err := NewPool[int, int](1, 0, nil); err == nil {
+		t.Error("expected an error for a nil processor")
+	}
+
+	if _, err := NewPool(0, 0, func(int, context.Context) (int, error) { return 0, nil }); err == nil {
+		t.Error("expected an error for zero workers")
+	}
+
+	if _, err := NewLimiter(0); err == nil {
+		t.Error("expected an error for a limiter without slots")
+	}
+}
+
+func TestPriorityOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+
+	pool := newPool(t, 1, 0, func(job string, ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, job)
+		return job, nil
+	})
+
+	for _, job := range []struct {
+		name     string
+		priority int
+	}{{"low-1", 0}, {"high-1", 10}, {"low-2", 0}, {"mid", 5}, {"high-2", 10}} {
+		if err := pool.Submit(job.name, job.priority); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	pool.Close()
+
+	results := collect(pool.Start(context.Background()))
+	if len(results) != 5 {
+		t.Fatalf("got %d results, want 5", len(results))
+	}
+
+	want := []string{"high-1", "high-2", "mid", "low-1", "low-2"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got order %v, want %v", order, want)
+		}
+	}
+
+	if progress := pool.Progress(); progress.Succeeded != 5 || progress.Queued != 0 || progress.Running != 0 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+}
+
+func TestSubmitAfterClose(t *testing.T) {
+	pool := newPool(t, 1, 0, func(job int, ctx context.Context) (int, error) { return job, nil })
+	pool.Close()
+
+	if err := pool.Submit(1, 0); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("got %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestDeferredJobsAreRequeued(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	var deferrals []int
+
+	pool := newPool(t, 1, 0, func(job string, ctx context.Context) (string, error) {
+		n, ok := Deferrals(ctx)
+		if !ok {
+			t.Error("the job context has no deferrals")
+		}
+
+		mu.Lock()
+		order = append(order, job)
+		if job == "busy" {
+			deferrals = append(deferrals, n)
+		}
+		mu.Unlock()
+
+		if job == "busy" && n < 2 {
+			return "", errors.Join(ErrDeferred, errors.New("still busy"))
+		}
+		return job, nil
+	})
+
+	for _, job := range []string{"busy", "idle-1", "idle-2"} {
+		pool.Submit(job, 0)
+	}
+	pool.Close()
+
+	results := collect(pool.Start(context.Background()))
+
+	var deferred, succeeded int
+	for _, result := range results {
+		switch {
+		case errors.Is(result.Err, ErrDeferred):
+			deferred++
+		case result.Err == nil:
+			succeeded++
+		default:
+			t.Errorf("unexpected error %v", result.Err)
+		}
+	}
+	if deferred != 2 || succeeded != 3 {
+		t.Errorf("got %d deferred and %d succeeded results, want 2 and 3", deferred, succeeded)
+	}
+
+	want := []string{"busy", "idle-1", "idle-2", "busy", "busy"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got order %v, want %v", order, want)
+		}
+	}
+	if deferrals[0] != 0 || deferrals[1] != 1 || deferrals[2] != 2 {
+		t.Errorf("got deferrals %v, want [0 1 2]", deferrals)
+	}
+
+	if progress := pool.Progress(); progress.Deferred != 2 || progress.Succeeded != 3 || progress.Failed != 0 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+}
+
+func TestDeferralsOutsideOfPool(t *testing.T) {
+	if _, ok := Deferrals(context.Background()); ok {
+		t.Error("a context without a job has deferrals")
+	}
+}
+
+func TestPanicsAreRecovered(t *testing.T) {
+	pool := newPool(t, 2, 0, func(job int, ctx context.Context) (int, error) {
+		if job == 1 {
+			panic("boom")
+		}
+		return job, nil
+	})
+
+	for job := 1; job <= 3; job++ {
+		pool.Submit(job, 0)
+	}
+	pool.Close()
+
+	results := collect(pool.Start(context.Background()))
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	for _, result := range results {
+		var panicErr *PanicError
+		if result.Job == 1 {
+			if !errors.As(result.Err, &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+				t.Errorf("got %v, want a PanicError", result.Err)
+			}
+		} else if result.Err != nil {
+			t.Errorf("job %d: unexpected error %v", result.Job, result.Err)
+		}
+	}
+
+	if progress := pool.Progress(); progress.Failed != 1 || progress.Succeeded != 2 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+}
+
+func TestTimedOutJobsAreWaitedFor(t *testing.T) {
+	var c concurrency
+	var stopped atomic.Int32
+
+	pool := newPool(t, 1, 20*time.Millisecond, func(job int, ctx context.Context) (int, error) {
+		c.enter()
+		defer c.leave()
+
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("the job context has no deadline")
+		}
+
+		if job == 1 {
+			<-ctx.Done()
+			// cleanup after the deadline still counts as running
+			time.Sleep(20 * time.Millisecond)
+			stopped.Add(1)
+			return 0, ctx.Err()
+		}
+		return job, nil
+	})
+
+	pool.Submit(1, 0)
+	pool.Submit(2, 0)
+	pool.Close()
+
+	for result := range pool.Start(context.Background()) {
+		if result.Job != 1 {
+			if result.Err != nil {
+				t.Errorf("job %d: unexpected error %v", result.Job, result.Err)
+			}
+			continue
+		}
+
+		if !errors.Is(result.Err, ErrJobTimeout) || !errors.Is(result.Err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want ErrJobTimeout", result.Err)
+		}
+		if stopped.Load() != 1 {
+			t.Error("the result was delivered before the job stopped")
+		}
+	}
+
+	if peak := c.peak.Load(); peak != 1 {
+		t.Errorf("%d jobs ran at the same time with one worker", peak)
+	}
+}
+
+func TestJobsFinishingAfterTimeoutSucceed(t *testing.T) {
+	pool := newPool(t, 1, 10*time.Millisecond, func(job int, ctx context.Context) (int, error) {
+		time.Sleep(30 * time.Millisecond)
+		return job, nil
+	})
+
+	pool.Submit(1, 0)
+	pool.Close()
+
+	results := collect(pool.Start(context.Background()))
+	if len(results) != 1 || results[0].Err != nil || results[0].Value != 1 {
+		t.Errorf("got %+v, want the value of the job", results)
+	}
+}
+
+func TestSetWorkers(t *testing.T) {
+	var c concurrency
+
+	pool := newPool(t, 4, 0, func(job int, ctx context.Context) (int, error) {
+		c.enter()
+		defer c.leave()
+		time.Sleep(5 * time.Millisecond)
+		return job, nil
+	})
+
+	if n := pool.SetWorkers(0); n != 1 {
+		t.Errorf("SetWorkers(0) = %d, want 1", n)
+	}
+	if n := pool.SetWorkers(10); n != 4 {
+		t.Errorf("SetWorkers(10) = %d, want 4", n)
+	}
+	if n := pool.SetWorkers(2); n != 2 {
+		t.Errorf("SetWorkers(2) = %d, want 2", n)
+	}
+
+	for job := 0; job < 12; job++ {
+		pool.Submit(job, 0)
+	}
+	pool.Close()
+
+	results := pool.Start(context.Background())
+	<-results
+	// scaling down does not stop running jobs
+	pool.SetWorkers(1)
+	collect(results)
+
+	if peak := c.peak.Load(); peak > 2 {
+		t.Errorf("%d jobs ran at the same time with a limit of 2", peak)
+	}
+	if progress := pool.Progress(); progress.Workers != 1 || progress.Succeeded != 12 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+}
+
+func TestSharedLimiter(t *testing.T) {
+	limiter, err := NewLimiter(2)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
+	}
+
+	var c concurrency
+	process := func(job int, ctx context.Context) (int, error) {
+		c.enter()
+		defer c.leave()
+		time.Sleep(5 * time.Millisecond)
+		return job, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		pool := newPool(t, 3, 0, process)
+		pool.SetLimiter(limiter)
+		for job := 0; job < 6; job++ {
+			pool.Submit(job, 0)
+		}
+		pool.Close()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range pool.Start(context.Background()) {
+				if result.Err != nil {
+					t.Errorf("unexpected error %v", result.Err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak := c.peak.Load(); peak > 2 {
+		t.Errorf("%d jobs ran at the same time with a limiter of 2", peak)
+	}
+}
+
+func TestCancelledWhileWaitingForLimiter(t *testing.T) {
+	limiter, _ := NewLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	started := make(chan struct{})
+	pool := newPool(t, 2, 0, func(job int, jobCtx context.Context) (int, error) {
+		close(started)
+		<-jobCtx.Done()
+		return job, nil
+	})
+	pool.SetLimiter(limiter)
+	pool.Submit(1, 0)
+	pool.Submit(2, 0)
+	pool.Close()
+
+	results := pool.Start(ctx)
+	<-started
+	// job 2 waits for the slot held by job 1
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	var notStarted int
+	for result := range results {
+		if errors.Is(result.Err, ErrNotStarted) {
+			notStarted++
+		}
+	}
+	if notStarted != 1 {
+		t.Errorf("got %d jobs that were not started, want 1", notStarted)
+	}
+}
+
+func TestCancelledPoolDoesNotStartQueuedJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var ran atomic.Int32
+	pool := newPool(t, 1, 0, func(job int, ctx context.Context) (int, error) {
+		ran.Add(1)
+		cancel()
+		return job, nil
+	})
+
+	for job := 0; job < 5; job++ {
+		pool.Submit(job, 0)
+	}
+	pool.Close()
+
+	results := collect(pool.Start(ctx))
+	if ran.Load() != 1 || len(results) != 1 {
+		t.Errorf("%d jobs ran and %d results were delivered after cancelling, want 1", ran.Load(), len(results))
+	}
+	if progress := pool.Progress(); progress.Queued != 4 {
+		t.Errorf("got %d queued jobs, want 4", progress.Queued)
+	}
+}